@@ -0,0 +1,198 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/spf13/cobra"
+)
+
+var calendarsDeleteCmdYesFlag bool
+
+var colorRegex = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// calendarsCmd represents the calendars command
+var calendarsCmd = &cobra.Command{
+	Use:   "calendars",
+	Short: "Manage the calendars on the remote",
+	Long: `List, create, rename, delete and color the calendars on the remote.
+
+Calendars can be given by name or by path, use the path when several
+calendars share a name.`,
+}
+
+// calendarsListCmd represents the calendars list command
+var calendarsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the calendars on the remote",
+	Long: `List the calendars on the remote with their path, name, supported components,
+number of todos, the taskwarrior project they are synced with and whether they
+are read-only. Calendars without a project are not synced.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		rs, err := sync.NewRemoteService(cmd.Context())
+		if err != nil {
+			panic(err)
+		}
+		calendars, err := sync.ListCalendars(rs)
+		if err != nil {
+			panic(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tNAME\tCOMPONENTS\tTODOS\tPROJECT\tREAD-ONLY\tCOLOR")
+		for _, c := range calendars {
+			project := "-"
+			if c.Synced {
+				project = c.Project
+				if project == "" {
+					project = "(none)"
+				}
+			}
+			components := strings.Join(c.Components, ",")
+			if components == "" {
+				components = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%t\t%s\n", c.Path, c.Name, components, c.Items, project, c.ReadOnly, c.Color)
+		}
+		w.Flush()
+	},
+}
+
+// calendarsCreateCmd represents the calendars create command
+var calendarsCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a calendar for todos",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rs, err := sync.NewRemoteService(cmd.Context())
+		if err != nil {
+			panic(err)
+		}
+		cal, err := rs.CreateCalendar(args[0])
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("Calendar created", "name", cal.Name, "path", cal.Path)
+	},
+}
+
+// calendarsRenameCmd represents the calendars rename command
+var calendarsRenameCmd = &cobra.Command{
+	Use:   "rename <calendar> <new-name>",
+	Short: "Rename a calendar",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		rs, cal := findCalendar(cmd, args[0])
+		oldName := cal.Name
+		cal.Name = args[1]
+		if err := rs.UpdateCalendar(cal); err != nil {
+			panic(err)
+		}
+		slog.Info("Calendar renamed", "path", cal.Path, "from", oldName, "to", cal.Name)
+	},
+}
+
+// calendarsSetColorCmd represents the calendars set-color command
+var calendarsSetColorCmd = &cobra.Command{
+	Use:   "set-color <calendar> <#RRGGBB|none>",
+	Short: "Set the color of a calendar",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		color := args[1]
+		if color == "none" {
+			color = ""
+		} else if !colorRegex.MatchString(color) {
+			panic(fmt.Errorf("Color %q is not a #RRGGBB color", color))
+		}
+
+		rs, cal := findCalendar(cmd, args[0])
+		cal.Color = strings.ToUpper(color)
+		if err := rs.UpdateCalendar(cal); err != nil {
+			panic(err)
+		}
+		slog.Info("Calendar color set", "path", cal.Path, "color", cal.Color)
+	},
+}
+
+// calendarsDeleteCmd represents the calendars delete command
+var calendarsDeleteCmd = &cobra.Command{
+	Use:   "delete <calendar>",
+	Short: "Delete a calendar and its todos",
+	Long: `Delete a calendar and all of its todos from the remote. The local tasks in the
+calendar are listed first and the deletion has to be confirmed. The local
+tasks are kept and unlinked from the deleted todos, so the next sync creates
+them on the remote again unless they are deleted too.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rs, cal := findCalendar(cmd, args[0])
+
+		store, err := sync.NewLocalStore()
+		if err != nil {
+			panic(err)
+		}
+		tasks, err := sync.TasksInCalendar(store, rs, cal)
+		if err != nil {
+			panic(err)
+		}
+		items, err := rs.Backend.ListItems(cal)
+		if err != nil {
+			panic(err)
+		}
+
+		fmt.Printf("Calendar %q (%s) holds %d todos.\n", cal.Name, cal.Path, len(items))
+		if len(tasks) > 0 {
+			fmt.Printf("%d local tasks are affected:\n", len(tasks))
+			sync.PrintTable(tasks)
+		}
+		if !calendarsDeleteCmdYesFlag && !sync.Confirm("Would you like to delete the calendar?") {
+			return
+		}
+
+		if err := rs.DeleteCalendar(cal); err != nil {
+			panic(err)
+		}
+		slog.Info("Calendar deleted", "name", cal.Name, "path", cal.Path)
+
+		unlinked, err := sync.UnlinkTasks(store, cal, tasks)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("Local tasks unlinked", "num", unlinked)
+	},
+}
+
+// findCalendar connects to the remote and finds a calendar by path or
+// name
+func findCalendar(cmd *cobra.Command, pathOrName string) (*remote.Service, remote.Calendar) {
+	rs, err := sync.NewRemoteService(cmd.Context())
+	if err != nil {
+		panic(err)
+	}
+	cal, err := rs.FindCalendar(pathOrName)
+	if err != nil {
+		panic(err)
+	}
+	return rs, cal
+}
+
+func init() {
+	calendarsDeleteCmd.Flags().BoolVarP(&calendarsDeleteCmdYesFlag, "yes", "y", false, "Delete without asking")
+
+	calendarsCmd.AddCommand(calendarsListCmd)
+	calendarsCmd.AddCommand(calendarsCreateCmd)
+	calendarsCmd.AddCommand(calendarsRenameCmd)
+	calendarsCmd.AddCommand(calendarsSetColorCmd)
+	calendarsCmd.AddCommand(calendarsDeleteCmd)
+	rootCmd.AddCommand(calendarsCmd)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/karsai5/tw-caldav/internal/credentials"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// credentialsCmd represents the credentials command
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Manage the encrypted credentials file",
+	Long: `The password doesn't have to be kept in plain text in .env. It is looked up
+in this order:
+
+  pass                    from .env, --pass or TW_CALDAV_PASS
+  pass_command            output of a command, such as "pass show caldav"
+  credentials_file        encrypted with a passphrase, see "credentials save"
+  ~/.netrc                the entry for the host of url
+
+The passphrase of the credentials file is asked for on the terminal, or read
+from credentials_passphrase.`,
+}
+
+// credentialsSaveCmd represents the credentials save command
+var credentialsSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "Encrypt the user and password into the credentials file",
+	Long: `Encrypt the user and password into the credentials file, asking for the
+password and a passphrase to encrypt it with.
+
+  tw-caldav credentials save --user me`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pass, err := credentials.PromptPassword()
+		if err != nil {
+			panic(err)
+		}
+		file, err := credentials.Save(credentials.Credentials{
+			Username: viper.GetString("user"),
+			Password: pass,
+		})
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("Saved credentials", "file", file)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credentialsCmd)
+	credentialsCmd.AddCommand(credentialsSaveCmd)
+}
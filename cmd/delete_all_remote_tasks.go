@@ -24,10 +24,9 @@ package cmd
 import (
 	"log/slog"
 
-	"github.com/karsai5/tw-caldav/internal/caldav"
+	"github.com/karsai5/tw-caldav/internal/sync"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // deleteAllRemoteTasks represents the test command
@@ -41,7 +40,7 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		client, err := caldav.NewClient(viper.GetString("url"), viper.GetString("user"), viper.GetString("pass"))
+		client, err := sync.NewRemoteService(cmd.Context())
 		if err != nil {
 			panic(err)
 		}
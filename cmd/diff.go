@@ -0,0 +1,121 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/karsai5/tw-caldav/internal/sync"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+)
+
+var diffCmdRawFlag bool
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <uuid|remote-path>",
+	Short: "Show how a task differs between taskwarrior and the remote",
+	Long: `Fetch a task from taskwarrior and the remote and show the synced fields side
+by side. Fields only set locally or that differ are marked with -, fields only
+set remotely or that differ with +. A task that keeps being updated on every
+sync shows which field doesn't survive the round trip.
+
+With --raw the taskwarrior JSON and the VTODO are printed as well.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+			text.DisableColors()
+		}
+
+		pair, err := sync.FindTaskPair(cmd.Context(), args[0])
+		if err != nil {
+			panic(err)
+		}
+
+		if pair.Local != nil {
+			fmt.Printf("--- local  %s\n", *pair.Local.LocalId())
+		} else {
+			fmt.Println("--- local  (not found)")
+		}
+		if pair.Remote != nil {
+			fmt.Printf("+++ remote %s\n", *pair.Remote.RemotePath())
+		} else {
+			fmt.Println("+++ remote (not found)")
+		}
+
+		switch {
+		case pair.Local == nil:
+			printFields(os.Stdout, task.Fields(pair.Remote), "+", text.FgGreen)
+		case pair.Remote == nil:
+			printFields(os.Stdout, task.Fields(pair.Local), "-", text.FgRed)
+		default:
+			printDiff(os.Stdout, pair.Local, pair.Remote)
+		}
+
+		if !diffCmdRawFlag {
+			return
+		}
+		if pair.Local != nil {
+			raw, err := pair.RawLocal()
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("\nLocal:\n%s\n", raw)
+		}
+		if pair.Remote != nil {
+			raw, err := pair.RawRemote()
+			if err != nil {
+				panic(err)
+			}
+			fmt.Printf("\nRemote:\n%s", raw)
+		}
+	},
+}
+
+// printDiff prints every field of the local task, with the fields that
+// differ followed by their remote value
+func printDiff(w io.Writer, localTask task.Task, remoteTask task.Task) {
+	changed := map[string]task.FieldDiff{}
+	diff := task.Diff(localTask, remoteTask)
+	for _, d := range diff {
+		changed[d.Name] = d
+	}
+
+	for _, f := range task.Fields(localTask) {
+		d, isChanged := changed[f.Name]
+		if !isChanged {
+			fmt.Fprintf(w, "  %s: %s\n", f.Name, f.Value)
+			continue
+		}
+		fmt.Fprintln(w, text.FgRed.Sprintf("- %s: %s", f.Name, f.Value))
+		if d.PresentB {
+			fmt.Fprintln(w, text.FgGreen.Sprintf("+ %s: %s", d.Name, d.B))
+		}
+	}
+	for _, d := range diff {
+		if !d.PresentA {
+			fmt.Fprintln(w, text.FgGreen.Sprintf("+ %s: %s", d.Name, d.B))
+		}
+	}
+
+	if len(diff) == 0 {
+		fmt.Fprintln(w, "Tasks are equal")
+	}
+}
+
+func printFields(w io.Writer, fields []task.Field, marker string, color text.Color) {
+	for _, f := range fields {
+		fmt.Fprintln(w, color.Sprintf("%s %s: %s", marker, f.Name, f.Value))
+	}
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffCmdRawFlag, "raw", false, "Print the taskwarrior JSON and the VTODO too")
+	rootCmd.AddCommand(diffCmd)
+}
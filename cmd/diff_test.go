@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+func TestPrintDiff(t *testing.T) {
+	text.DisableColors()
+	t.Cleanup(text.EnableColors)
+
+	path := "/cal/home/6d1f0f4e.ics"
+	id := "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60"
+	localTask := task.ShellTask{Task: &task.Internaltask{Description: "Water the plants", Project: "home", Status: task.StatusPending, LocalId: &id}}
+
+	tests := []struct {
+		name   string
+		remote *task.Internaltask
+		want   string
+	}{
+		{
+			name:   "equal",
+			remote: &task.Internaltask{Description: "Water the plants", Project: "home", Status: task.StatusPending, LocalId: &id},
+			want: `  desc: Water the plants
+  proj: home
+  priority: 
+  tags: 
+  status: pending
+  local: 6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60
+Tasks are equal
+`,
+		},
+		{
+			name:   "changed, added and removed fields",
+			remote: &task.Internaltask{Description: "Water the garden", Project: "home", Status: task.StatusPending, RemotePath: &path},
+			want: `- desc: Water the plants
++ desc: Water the garden
+  proj: home
+  priority: 
+  tags: 
+  status: pending
+- local: 6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60
++ remote: /cal/home/6d1f0f4e.ics
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			printDiff(&out, localTask, task.ShellTask{Task: tt.remote})
+			if out.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintFields(t *testing.T) {
+	text.DisableColors()
+	t.Cleanup(text.EnableColors)
+
+	var out strings.Builder
+	printFields(&out, []task.Field{{Name: "desc", Value: "Water the plants"}, {Name: "proj", Value: "home"}}, "+", text.FgGreen)
+	if want := "+ desc: Water the plants\n+ proj: home\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
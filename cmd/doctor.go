@@ -0,0 +1,55 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the setup for common problems",
+	Long: `Check the taskwarrior version, the UDAs tw-caldav needs in .taskrc, the
+connection to the remote, whether the remote has calendars that accept todos
+and the clock skew between this machine and the server. Every failure comes
+with a fix. Nothing is changed, not even the default calendar is created.
+
+The exit code is 1 when a check fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice == 0 {
+			text.DisableColors()
+		}
+
+		failed := false
+		for _, check := range sync.Doctor(cmd.Context()) {
+			result := check.Result.String()
+			switch check.Result {
+			case sync.CheckPass:
+				result = text.FgGreen.Sprint(result)
+			case sync.CheckFail:
+				result = text.FgRed.Sprint(result)
+				failed = true
+			}
+			fmt.Printf("[%s] %s: %s\n", result, check.Name, check.Detail)
+			if check.Fix != "" {
+				fmt.Printf("       fix: %s\n", check.Fix)
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
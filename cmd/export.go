@@ -0,0 +1,58 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/spf13/cobra"
+)
+
+var exportCmdFilterFlag string
+var exportCmdOutputFlag string
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write taskwarrior tasks to an .ics file",
+	Long: `Write taskwarrior tasks as a VCALENDAR of VTODOs, mapped the same way they
+are synced. Any calendar or task app that reads .ics files can import it.
+
+  tw-caldav export --filter "project:home" -o home.ics
+
+Without a filter the tasks that take part in syncing are exported. The
+calendar is named after the project when all tasks share one, export one
+project at a time to keep projects when importing the file again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := sync.NewLocalStore()
+		if err != nil {
+			panic(err)
+		}
+
+		buf := new(bytes.Buffer)
+		num, err := sync.Export(store, buf, exportCmdFilterFlag)
+		if err != nil {
+			panic(err)
+		}
+
+		if exportCmdOutputFlag == "" || exportCmdOutputFlag == "-" {
+			os.Stdout.Write(buf.Bytes())
+			return
+		}
+		if err := os.WriteFile(exportCmdOutputFlag, buf.Bytes(), 0o644); err != nil {
+			panic(err)
+		}
+		slog.Info("Tasks exported", "num", num, "file", exportCmdOutputFlag)
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportCmdFilterFlag, "filter", "f", "", "Taskwarrior filter selecting the tasks to export")
+	exportCmd.Flags().StringVarP(&exportCmdOutputFlag, "output", "o", "-", "File to write, - for stdout")
+	rootCmd.AddCommand(exportCmd)
+}
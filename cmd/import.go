@@ -0,0 +1,53 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/spf13/cobra"
+)
+
+var importCmdProjectFlag string
+var importCmdDryRunFlag bool
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import file.ics",
+	Short: "Create or update taskwarrior tasks from an .ics file",
+	Long: `Create or update taskwarrior tasks from the VTODOs of an .ics file, such as
+one exported from another task app.
+
+Todos are matched to tasks by their UID, so importing the same file again
+updates the tasks instead of creating duplicates. Tasks are put in the
+project named by the calendar in the file, or the one given with --project.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := sync.NewLocalStore()
+		if err != nil {
+			panic(err)
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			panic(err)
+		}
+		defer file.Close()
+
+		result, err := sync.Import(store, file, importCmdProjectFlag, importCmdDryRunFlag)
+		if err != nil {
+			panic(err)
+		}
+		slog.Info("Import finished", "created", result.Created, "updated", result.Updated, "unchanged", result.Unchanged, "dryRun", importCmdDryRunFlag)
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVarP(&importCmdProjectFlag, "project", "p", "", "Project to put the imported tasks in")
+	importCmd.Flags().BoolVarP(&importCmdDryRunFlag, "dry-run", "n", false, "Only show what would be imported")
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateIdentityCmdDryRunFlag bool
+
+// migrateIdentityCmd represents the migrate-identity command
+var migrateIdentityCmd = &cobra.Command{
+	Use:   "migrate-identity",
+	Short: "Move taskwarrior ids out of remote descriptions",
+	Long: `Older versions of tw-caldav stored the taskwarrior uuid of each task as a
+taskwarrior_id= marker in the DESCRIPTION of the remote todo.
+
+This command rewrites every remote todo that still has the marker so the uuid
+is stored in the X-TASKWARRIOR-UUID property instead, and removes the marker
+from the description.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := sync.NewRemoteService(cmd.Context())
+		if err != nil {
+			panic(err)
+		}
+
+		todos, err := client.GetAllTodos()
+		if err != nil {
+			panic(err)
+		}
+
+		migrated := 0
+		for _, t := range todos {
+			if !t.HasLegacyIdentity() {
+				continue
+			}
+			if migrateIdentityCmdDryRunFlag {
+				slog.Info("Would migrate todo", "task", t.Description(), "path", t.Path)
+				migrated++
+				continue
+			}
+			if err := t.MigrateIdentity(); err != nil {
+				slog.Error("Error migrating todo", "path", t.Path, "err", err)
+				continue
+			}
+			slog.Info("Todo migrated", "task", t.Description(), "path", t.Path, "uuid", *t.LocalId())
+			migrated++
+		}
+
+		slog.Info("Migration finished", "migrated", migrated, "total", len(todos))
+	},
+}
+
+func init() {
+	migrateIdentityCmd.Flags().BoolVarP(&migrateIdentityCmdDryRunFlag, "dry-run", "n", false, "Only list the todos that would be migrated")
+	rootCmd.AddCommand(migrateIdentityCmd)
+}
@@ -4,11 +4,16 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/karsai5/tw-caldav/internal/credentials"
+
 	"github.com/lmittmann/tint"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -32,7 +37,14 @@ to quickly create a Cobra application.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	err := rootCmd.Execute()
+	// Ctrl-C cancels requests to the server, a second one quits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -40,10 +52,10 @@ func Execute() {
 
 func init() {
 	slog.SetDefault(slog.New(
-		tint.NewHandler(os.Stdout, &tint.Options{
+		credentials.NewRedactingHandler(tint.NewHandler(os.Stdout, &tint.Options{
 			Level:      slog.LevelDebug,
 			TimeFormat: time.Kitchen,
-		}),
+		})),
 	))
 
 	// Here you will define your flags and configuration settings.
@@ -51,13 +63,15 @@ func init() {
 	// will be global for your application.
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.tw-caldav-sync.yaml)")
-	rootCmd.PersistentFlags().String("url", "", "URL to CalDav server")
+	rootCmd.PersistentFlags().String("url", "", "CalDav server url, hostname or email address")
 	rootCmd.PersistentFlags().String("user", "", "CalDav user")
 	rootCmd.PersistentFlags().String("pass", "", "CalDav pass")
+	rootCmd.PersistentFlags().String("pass-command", "", "Command that prints the CalDav pass")
 
 	viper.BindPFlag("url", rootCmd.PersistentFlags().Lookup("url"))
 	viper.BindPFlag("user", rootCmd.PersistentFlags().Lookup("user"))
 	viper.BindPFlag("pass", rootCmd.PersistentFlags().Lookup("pass"))
+	viper.BindPFlag("pass_command", rootCmd.PersistentFlags().Lookup("pass-command"))
 
 	viper.SetEnvPrefix("tw_caldav")
 	viper.AutomaticEnv()
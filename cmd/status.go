@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Linus Karsai <linus@linusk.com.au>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/state"
+	"github.com/karsai5/tw-caldav/internal/sync"
+
+	"github.com/spf13/cobra"
+)
+
+var statusCmdJsonFlag bool
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether local tasks and the remote are in sync",
+	Long: `Show the last sync, the changes waiting on each side, tasks changed on both
+sides since the last sync, tasks the last sync couldn't sync, the calendars in
+use and whether the remote can be reached. Nothing is changed.
+
+The exit code is 0 when everything is in sync, 1 when there are changes to
+sync and 2 when the remote can't be reached or the last sync failed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		status := sync.GetStatus(cmd.Context())
+
+		if statusCmdJsonFlag {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(status); err != nil {
+				panic(err)
+			}
+		} else {
+			printStatus(status)
+		}
+		os.Exit(status.ExitCode())
+	},
+}
+
+func printStatus(status sync.Status) {
+	fmt.Printf("Last sync:      %s\n", describeRun(status.LastSuccess))
+	if status.LastRun != nil && status.LastRun.Error != "" {
+		fmt.Printf("Last attempt:   failed %s: %s\n", status.LastRun.Started.Local().Format(time.DateTime), status.LastRun.Error)
+	}
+	if status.Reachable {
+		fmt.Println("Server:         reachable")
+	} else {
+		fmt.Println("Server:         unreachable")
+	}
+	if status.Error != "" {
+		fmt.Printf("Error:          %s\n", status.Error)
+	}
+	if !status.Reachable || status.Error != "" {
+		printQuarantined(status)
+		return
+	}
+
+	fmt.Printf("Local changes:  %s\n", describePending(status.Local))
+	fmt.Printf("Remote changes: %s\n", describePending(status.Remote))
+	fmt.Printf("Conflicts:      %d\n", len(status.Conflicts))
+	for _, c := range status.Conflicts {
+		fmt.Printf("  %s %s\n", c.Uuid, c.Description)
+	}
+	printQuarantined(status)
+
+	fmt.Println("Calendars:")
+	for _, c := range status.Calendars {
+		project := c.Project
+		if project == "" {
+			project = "(none)"
+		}
+		fmt.Printf("  %s -> %s %q, %d todos\n", project, c.Path, c.Name, c.Todos)
+	}
+}
+
+func printQuarantined(status sync.Status) {
+	fmt.Printf("Quarantined:    %d\n", len(status.Quarantined))
+	for _, id := range slices.Sorted(maps.Keys(status.Quarantined)) {
+		fmt.Printf("  %s: %s\n", id, status.Quarantined[id])
+	}
+}
+
+func describeRun(run *state.Run) string {
+	if run == nil {
+		return "never"
+	}
+	return fmt.Sprintf("%s, took %s, %d changes", run.Started.Local().Format(time.DateTime), run.Duration.Round(time.Millisecond), run.Changes)
+}
+
+func describePending(p sync.PendingChanges) string {
+	if p.Total() == 0 {
+		return "in sync"
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete", p.Create, p.Update, p.Delete)
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusCmdJsonFlag, "json", false, "Print the status as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -10,6 +10,7 @@ import (
 )
 
 var syncCmdInteractiveFlag bool
+var syncCmdAllowEmptyRemoteFlag bool
 
 // TODO: Add command option to backup tasks before syncing
 var syncCmdBackupTasksFlag bool
@@ -25,12 +26,13 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		syncProcess, err := sync.NewSyncProcess()
+		syncProcess, err := sync.NewSyncProcess(cmd.Context())
 		if err != nil {
 			panic(err)
 		}
 
 		syncProcess.Interactive = syncCmdInteractiveFlag
+		syncProcess.AllowEmptyRemote = syncCmdAllowEmptyRemoteFlag
 
 		if err = syncProcess.Sync(); err != nil {
 			panic(err)
@@ -41,5 +43,6 @@ to quickly create a Cobra application.`,
 func init() {
 	syncCmd.Flags().BoolVarP(&syncCmdInteractiveFlag, "interactive", "i", false, "Ask before making any changes")
 	syncCmd.Flags().BoolVarP(&syncCmdBackupTasksFlag, "backup", "b", false, "Backup local tasks before making changes")
+	syncCmd.Flags().BoolVar(&syncCmdAllowEmptyRemoteFlag, "allow-empty-remote", false, "Sync with a vdir or ics remote that has no todos, deleting local tasks synced to it")
 	rootCmd.AddCommand(syncCmd)
 }
@@ -0,0 +1,208 @@
+// Package auth adds credentials to the requests sent to a server. Every
+// request goes through the same Transport, so each authentication method
+// works for all of them.
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/karsai5/tw-caldav/internal/credentials"
+
+	"github.com/spf13/viper"
+)
+
+// Authenticator adds credentials to requests
+type Authenticator interface {
+	// Authorize adds credentials to a request before it is sent
+	Authorize(req *http.Request) error
+	// Challenge is called when the server answers 401 Unauthorized. It
+	// reports whether the request should be sent again, after new
+	// credentials have been prepared.
+	Challenge(resp *http.Response) (bool, error)
+}
+
+// New returns the authenticator selected with the auth key: "basic" (the
+// default) or "digest" with the credentials found by credentials.Get,
+// "bearer" with a token, or "none". A bearer token is refreshed when
+// oauth2_token_url is set.
+func New() (Authenticator, error) {
+	switch method := viper.GetString("auth"); method {
+	case "", "basic":
+		user, pass, err := credentials.Get()
+		if err != nil {
+			return nil, fmt.Errorf("While getting credentials: %w", err)
+		}
+		return &Basic{Username: user, Password: pass}, nil
+	case "digest":
+		user, pass, err := credentials.Get()
+		if err != nil {
+			return nil, fmt.Errorf("While getting credentials: %w", err)
+		}
+		return &Digest{Username: user, Password: pass}, nil
+	case "bearer":
+		return newBearer()
+	case "none":
+		return None{}, nil
+	default:
+		return nil, fmt.Errorf("Unknown auth method %q", method)
+	}
+}
+
+// ClientCertificates returns the TLS client certificate configured with
+// client_cert and client_key, for servers that require mutual TLS. It can
+// be combined with any authenticator.
+func ClientCertificates() ([]tls.Certificate, error) {
+	certFile := viper.GetString("client_cert")
+	keyFile := viper.GetString("client_key")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if keyFile == "" {
+		// The key may be in the same PEM file as the certificate
+		keyFile = certFile
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("While loading client certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// Transport authorizes the requests sent through it to Origin. A request
+// is sent once more when the authenticator can answer a 401 challenge.
+type Transport struct {
+	Base http.RoundTripper
+	Auth Authenticator
+	// Origin is the scheme and host of the configured server. Requests to
+	// other origins, such as redirect targets, are sent without
+	// credentials unless they use https on the same host, or the host was
+	// trusted with Trust.
+	Origin *url.URL
+
+	mu      sync.RWMutex
+	trusted []string
+}
+
+// Trust allows credentials to be sent to the host of u as well, such as
+// the calendar home set the configured server points to. Only https
+// hosts can be trusted.
+func (t *Transport) Trust(u *url.URL) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("Credentials are only sent to other hosts over https, not to %s", u.Redacted())
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.trusted = append(t.trusted, strings.ToLower(u.Hostname()))
+	return nil
+}
+
+// authorizes reports whether credentials may be sent to a url
+func (t *Transport) authorizes(u *url.URL) bool {
+	if u.Scheme == "https" && t.isTrusted(u.Hostname()) {
+		return true
+	}
+	if t.Origin == nil || !strings.EqualFold(u.Hostname(), t.Origin.Hostname()) {
+		return false
+	}
+	if u.Scheme == "https" {
+		return true
+	}
+	return u.Scheme == t.Origin.Scheme && u.Port() == t.Origin.Port()
+}
+
+func (t *Transport) isTrusted(host string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return slices.Contains(t.trusted, strings.ToLower(host))
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.authorizes(req.URL) {
+		slog.Warn("Sending request without credentials, it isn't for the configured server", "url", req.URL.Redacted())
+		return t.base().RoundTrip(req)
+	}
+
+	resp, err := t.send(req, req.Body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// The body was used up and can't be sent again
+		return resp, nil
+	}
+
+	retry, err := t.Auth.Challenge(resp)
+	if !retry && err == nil {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.send(req, body)
+}
+
+func (t *Transport) send(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	authorized := req.Clone(req.Context())
+	authorized.Body = body
+	if err := t.Auth.Authorize(authorized); err != nil {
+		return nil, fmt.Errorf("While authorizing request: %w", err)
+	}
+	return t.base().RoundTrip(authorized)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// Basic sends the username and password with every request
+type Basic struct {
+	Username string
+	Password string
+}
+
+// Authorize implements Authenticator.
+func (b *Basic) Authorize(req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// Challenge implements Authenticator.
+func (b *Basic) Challenge(resp *http.Response) (bool, error) {
+	return false, nil
+}
+
+// None sends requests without credentials, such as when a client
+// certificate is enough
+type None struct{}
+
+// Authorize implements Authenticator.
+func (None) Authorize(req *http.Request) error {
+	return nil
+}
+
+// Challenge implements Authenticator.
+func (None) Challenge(resp *http.Response) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// recorder answers every request with 200 and keeps the Authorization
+// header it was sent with
+type recorder struct {
+	authorization string
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.authorization = req.Header.Get("Authorization")
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestTransportOrigin(t *testing.T) {
+	origin := &url.URL{Scheme: "https", Host: "dav.example.com"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://dav.example.com/calendars/", true},
+		{"https://DAV.example.com/calendars/", true},
+		{"https://dav.example.com:8443/calendars/", true},
+		{"http://dav.example.com/calendars/", false},
+		{"https://example.com/calendars/", false},
+		{"https://dav.example.com.evil.test/", false},
+		{"https://other.test/.well-known/caldav", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			base := &recorder{}
+			transport := &Transport{Base: base, Auth: &Basic{Username: "user", Password: "pass"}, Origin: origin}
+			req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if got := base.authorization != ""; got != tt.want {
+				t.Errorf("authorized = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransportPlainOrigin(t *testing.T) {
+	origin := &url.URL{Scheme: "http", Host: "localhost:5232"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://localhost:5232/user/", true},
+		{"http://localhost:8080/user/", false},
+		{"https://localhost/user/", true},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := (&Transport{Origin: origin}).authorizes(u); got != tt.want {
+			t.Errorf("authorizes(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	u, _ := url.Parse("https://dav.example.com/")
+	if (&Transport{}).authorizes(u) {
+		t.Error("authorized without an origin")
+	}
+}
+
+func TestTransportTrust(t *testing.T) {
+	transport := &Transport{Origin: &url.URL{Scheme: "https", Host: "caldav.icloud.com"}}
+	home, _ := url.Parse("https://p42-caldav.icloud.com:443/123456789/calendars/")
+	if err := transport.Trust(home); err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := url.Parse("http://plain.example.com/calendars/")
+	if err := transport.Trust(plain); err == nil {
+		t.Error("plain http host was trusted")
+	}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://caldav.icloud.com/", true},
+		{"https://p42-caldav.icloud.com/123456789/calendars/work/", true},
+		{"https://P42-CALDAV.icloud.com/123456789/calendars/", true},
+		{"http://p42-caldav.icloud.com/123456789/calendars/", false},
+		{"https://p43-caldav.icloud.com/123456789/calendars/", false},
+		{"https://plain.example.com/calendars/", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := transport.authorizes(u); got != tt.want {
+			t.Errorf("authorizes(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/credentials"
+	"github.com/karsai5/tw-caldav/internal/state"
+
+	"github.com/spf13/viper"
+)
+
+// tokenExpiryMargin refreshes tokens a little before they expire, so they
+// don't expire while a request is on its way
+const tokenExpiryMargin = time.Minute
+
+// Bearer sends a token with every request. With a TokenURL the token is
+// an OAuth2 access token, refreshed with the refresh token when it
+// expires or the server rejects it.
+type Bearer struct {
+	Token string
+
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	// CacheFile keeps refreshed tokens between runs
+	CacheFile string
+	// HTTPClient sends the token requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	mu     sync.Mutex
+	cached *cachedToken
+}
+
+type cachedToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+func (t *cachedToken) valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(tokenExpiryMargin).Before(t.Expiry)
+}
+
+// newBearer reads the token and oauth2_* keys. Refreshed tokens are
+// cached in the state directory.
+func newBearer() (*Bearer, error) {
+	b := &Bearer{
+		Token:        viper.GetString("token"),
+		TokenURL:     viper.GetString("oauth2_token_url"),
+		ClientID:     viper.GetString("oauth2_client_id"),
+		ClientSecret: viper.GetString("oauth2_client_secret"),
+		RefreshToken: viper.GetString("oauth2_refresh_token"),
+	}
+	credentials.Register(b.Token)
+	credentials.Register(b.ClientSecret)
+	credentials.Register(b.RefreshToken)
+	if b.TokenURL == "" {
+		if b.Token == "" {
+			return nil, fmt.Errorf("Bearer auth needs a token or oauth2_token_url")
+		}
+		return b, nil
+	}
+
+	dir, err := state.Dir()
+	if err != nil {
+		return nil, err
+	}
+	b.CacheFile = filepath.Join(dir, "oauth2-token.json")
+	return b, nil
+}
+
+// Authorize implements Authenticator.
+func (b *Bearer) Authorize(req *http.Request) error {
+	token, err := b.accessToken(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Challenge implements Authenticator. A rejected OAuth2 token is refreshed
+// once, the server may have revoked it before it expired.
+func (b *Bearer) Challenge(resp *http.Response) (bool, error) {
+	if b.TokenURL == "" {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rejected := strings.TrimPrefix(resp.Request.Header.Get("Authorization"), "Bearer ")
+	if b.cached != nil && b.cached.AccessToken != rejected {
+		// Another request has refreshed the token already
+		return true, nil
+	}
+	if err := b.refresh(resp.Request.Context()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *Bearer) accessToken(ctx context.Context) (string, error) {
+	if b.TokenURL == "" {
+		return b.Token, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cached == nil {
+		b.cached = b.loadCache()
+	}
+	if !b.cached.valid() {
+		if err := b.refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+	return b.cached.AccessToken, nil
+}
+
+func (b *Bearer) loadCache() *cachedToken {
+	token := &cachedToken{AccessToken: b.Token, RefreshToken: b.RefreshToken}
+	data, err := os.ReadFile(b.CacheFile)
+	if err != nil {
+		return token
+	}
+	cached := cachedToken{}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return token
+	}
+	if cached.RefreshToken == "" {
+		cached.RefreshToken = b.RefreshToken
+	}
+	credentials.Register(cached.AccessToken)
+	credentials.Register(cached.RefreshToken)
+	return &cached
+}
+
+// refresh gets a new access token with the refresh token grant
+func (b *Bearer) refresh(ctx context.Context) error {
+	refreshToken := b.RefreshToken
+	if b.cached != nil && b.cached.RefreshToken != "" {
+		// Servers that rotate refresh tokens invalidate the configured one
+		refreshToken = b.cached.RefreshToken
+	}
+	if refreshToken == "" {
+		return fmt.Errorf("No oauth2_refresh_token to refresh the access token with")
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	}
+	if b.ClientID != "" {
+		form.Set("client_id", b.ClientID)
+	}
+	if b.ClientSecret != "" {
+		form.Set("client_secret", b.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("While refreshing oauth2 token: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("While refreshing oauth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body := struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Error        string `json:"error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("While reading oauth2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return fmt.Errorf("Failed to refresh oauth2 token, status code: %d %s", resp.StatusCode, body.Error)
+	}
+
+	token := &cachedToken{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	credentials.Register(token.AccessToken)
+	credentials.Register(token.RefreshToken)
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	b.cached = token
+	return b.saveCache()
+}
+
+func (b *Bearer) saveCache() error {
+	if b.CacheFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(b.cached)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.CacheFile), 0o700); err != nil {
+		return fmt.Errorf("While saving oauth2 token: %w", err)
+	}
+	tmp := b.CacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("While saving oauth2 token: %w", err)
+	}
+	return os.Rename(tmp, b.CacheFile)
+}
@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokenServer hands out access-1, access-2… and rotates the refresh token
+// with every refresh
+type tokenServer struct {
+	refreshes []string
+	expiresIn int64
+	fail      bool
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	w.Header().Set("Content-Type", "application/json")
+	if s.fail || r.Form.Get("grant_type") != "refresh_token" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		return
+	}
+	s.refreshes = append(s.refreshes, r.Form.Get("refresh_token"))
+	n := len(s.refreshes)
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  fmt.Sprintf("access-%d", n),
+		"refresh_token": fmt.Sprintf("refresh-%d", n),
+		"expires_in":    s.expiresIn,
+	})
+}
+
+// davServer only accepts the given access token
+func davServer(t *testing.T, accepted *string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+*accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestBearer(t *testing.T, tokens *tokenServer, cache *cachedToken) *Bearer {
+	t.Helper()
+	srv := httptest.NewServer(tokens)
+	t.Cleanup(srv.Close)
+	b := &Bearer{
+		Token:        "configured",
+		TokenURL:     srv.URL,
+		ClientID:     "tw-caldav",
+		RefreshToken: "refresh-0",
+		CacheFile:    filepath.Join(t.TempDir(), "oauth2-token.json"),
+	}
+	if cache != nil {
+		data, _ := json.Marshal(cache)
+		if err := os.WriteFile(b.CacheFile, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+func get(t *testing.T, b *Bearer, srv *httptest.Server) (int, error) {
+	t.Helper()
+	origin, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &Transport{Auth: b, Origin: origin}}
+	resp, err := client.Get(srv.URL + "/calendars/")
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestBearerStaticToken(t *testing.T) {
+	accepted := "static"
+	srv := davServer(t, &accepted)
+	if status, err := get(t, &Bearer{Token: "static"}, srv); err != nil || status != http.StatusOK {
+		t.Errorf("status = %d, err = %v", status, err)
+	}
+	accepted = "other"
+	if status, err := get(t, &Bearer{Token: "static"}, srv); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("status = %d, err = %v, want the 401 passed on", status, err)
+	}
+}
+
+func TestBearerRefresh(t *testing.T) {
+	tests := []struct {
+		name          string
+		cache         *cachedToken
+		accepted      string
+		wantRefreshes []string
+	}{
+		{
+			name:          "no cache",
+			accepted:      "access-1",
+			wantRefreshes: []string{"refresh-0"},
+		},
+		{
+			name:     "cached token is reused",
+			cache:    &cachedToken{AccessToken: "cached", RefreshToken: "refresh-7", Expiry: time.Now().Add(time.Hour)},
+			accepted: "cached",
+		},
+		{
+			name:          "expired token is refreshed with the cached refresh token",
+			cache:         &cachedToken{AccessToken: "cached", RefreshToken: "refresh-7", Expiry: time.Now().Add(-time.Hour)},
+			accepted:      "access-1",
+			wantRefreshes: []string{"refresh-7"},
+		},
+		{
+			name:          "token about to expire is refreshed",
+			cache:         &cachedToken{AccessToken: "cached", RefreshToken: "refresh-7", Expiry: time.Now().Add(tokenExpiryMargin / 2)},
+			accepted:      "access-1",
+			wantRefreshes: []string{"refresh-7"},
+		},
+		{
+			name:          "rejected token is refreshed",
+			cache:         &cachedToken{AccessToken: "revoked", RefreshToken: "refresh-7", Expiry: time.Now().Add(time.Hour)},
+			accepted:      "access-1",
+			wantRefreshes: []string{"refresh-7"},
+		},
+		{
+			name:          "configured refresh token is used when the cache has none",
+			cache:         &cachedToken{AccessToken: "cached", Expiry: time.Now().Add(-time.Hour)},
+			accepted:      "access-1",
+			wantRefreshes: []string{"refresh-0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := &tokenServer{expiresIn: 3600}
+			b := newTestBearer(t, tokens, tt.cache)
+			srv := davServer(t, &tt.accepted)
+
+			status, err := get(t, b, srv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != http.StatusOK {
+				t.Errorf("status = %d", status)
+			}
+			if got := strings.Join(tokens.refreshes, ","); got != strings.Join(tt.wantRefreshes, ",") {
+				t.Errorf("refreshed with %q, want %q", got, strings.Join(tt.wantRefreshes, ","))
+			}
+
+			// The token is cached for the next run
+			again := &Bearer{TokenURL: b.TokenURL, RefreshToken: b.RefreshToken, CacheFile: b.CacheFile}
+			if status, err := get(t, again, srv); err != nil || status != http.StatusOK {
+				t.Errorf("next run: status = %d, err = %v", status, err)
+			}
+			if len(tokens.refreshes) != len(tt.wantRefreshes) {
+				t.Errorf("next run refreshed the cached token")
+			}
+		})
+	}
+}
+
+func TestBearerCacheFile(t *testing.T) {
+	tokens := &tokenServer{expiresIn: 3600}
+	b := newTestBearer(t, tokens, nil)
+	accepted := "access-1"
+	if _, err := get(t, b, davServer(t, &accepted)); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(b.CacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("cache file mode = %o, want 600", perm)
+	}
+	data, _ := os.ReadFile(b.CacheFile)
+	cached := cachedToken{}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatal(err)
+	}
+	if cached.AccessToken != "access-1" || cached.RefreshToken != "refresh-1" {
+		t.Errorf("cached %+v", cached)
+	}
+	if until := time.Until(cached.Expiry); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("expiry in %v, want an hour", until)
+	}
+}
+
+func TestBearerFailedRefresh(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  *tokenServer
+		refresh string
+		wantErr string
+	}{
+		{"token endpoint refuses", &tokenServer{fail: true}, "refresh-0", "invalid_grant"},
+		{"no refresh token", &tokenServer{}, "", "No oauth2_refresh_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBearer(t, tt.tokens, &cachedToken{AccessToken: "expired", Expiry: time.Now().Add(-time.Hour)})
+			b.RefreshToken = tt.refresh
+			accepted := "access-1"
+
+			_, err := get(t, b, davServer(t, &accepted))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Digest answers the server's digest challenge (RFC 7616). The first
+// request is sent without credentials, later ones reuse the nonce.
+type Digest struct {
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	challenge map[string]string
+	count     int
+}
+
+// Authorize implements Authenticator.
+func (d *Digest) Authorize(req *http.Request) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.challenge == nil {
+		return nil
+	}
+
+	newHash, err := digestHash(d.challenge["algorithm"])
+	if err != nil {
+		return err
+	}
+	h := func(parts ...string) string {
+		hash := newHash()
+		hash.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	d.count++
+	realm := d.challenge["realm"]
+	nonce := d.challenge["nonce"]
+	nc := fmt.Sprintf("%08x", d.count)
+	cnonce := newCnonce()
+	uri := req.URL.RequestURI()
+
+	ha1 := h(d.Username, realm, d.Password)
+	if strings.HasSuffix(strings.ToLower(d.challenge["algorithm"]), "-sess") {
+		ha1 = h(ha1, nonce, cnonce)
+	}
+	ha2 := h(req.Method, uri)
+
+	qop := ""
+	if slices.Contains(strings.Split(strings.ReplaceAll(d.challenge["qop"], " ", ""), ","), "auth") {
+		qop = "auth"
+	}
+
+	var response string
+	if qop == "" {
+		response = h(ha1, nonce, ha2)
+	} else {
+		response = h(ha1, nonce, nc, cnonce, qop, ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%q", d.Username),
+		fmt.Sprintf("realm=%q", realm),
+		fmt.Sprintf("nonce=%q", nonce),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("response=%q", response),
+	}
+	if algorithm := d.challenge["algorithm"]; algorithm != "" {
+		fields = append(fields, "algorithm="+algorithm)
+	}
+	if opaque, exists := d.challenge["opaque"]; exists {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	req.Header.Set("Authorization", "Digest "+strings.Join(fields, ", "))
+	return nil
+}
+
+// Challenge implements Authenticator. The request is only sent again for
+// a new nonce, a second challenge for the same nonce means the
+// credentials are wrong.
+func (d *Digest) Challenge(resp *http.Response) (bool, error) {
+	var challenge map[string]string
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		if params, found := strings.CutPrefix(header, "Digest "); found {
+			challenge = parseAuthParams(params)
+			break
+		}
+	}
+	if challenge == nil {
+		return false, fmt.Errorf("Server doesn't support digest authentication")
+	}
+	if _, err := digestHash(challenge["algorithm"]); err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	stale := strings.EqualFold(challenge["stale"], "true")
+	if d.challenge != nil && d.challenge["nonce"] == challenge["nonce"] && !stale {
+		return false, nil
+	}
+	d.challenge = challenge
+	d.count = 0
+	return true, nil
+}
+
+func digestHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New, nil
+	case "SHA-256":
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("Unsupported digest algorithm %q", algorithm)
+	}
+}
+
+func newCnonce() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// parseAuthParams parses the comma separated key=value pairs of a
+// WWW-Authenticate challenge, values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			return params
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		rest = strings.TrimLeft(rest, " ")
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			value = b.String()
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+			value = strings.TrimSpace(value)
+		}
+		params[key] = value
+	}
+}
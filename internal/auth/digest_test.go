@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"maps"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		params string
+		want   map[string]string
+	}{
+		{
+			params: `realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			want: map[string]string{
+				"realm":     "http-auth@example.org",
+				"qop":       "auth, auth-int",
+				"algorithm": "SHA-256",
+				"nonce":     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+				"opaque":    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+			},
+		},
+		{
+			params: `Realm = "a \"quoted\" realm" ,stale=TRUE,,nonce=abc`,
+			want:   map[string]string{"realm": `a "quoted" realm`, "stale": "TRUE", "nonce": "abc"},
+		},
+		{params: `realm="unterminated`, want: map[string]string{"realm": "unterminated"}},
+		{params: `nonce=`, want: map[string]string{"nonce": ""}},
+		{params: "", want: map[string]string{}},
+		{params: "token68", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params, func(t *testing.T) {
+			if got := parseAuthParams(tt.params); !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func challengeResponse(header string) *http.Response {
+	return &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{"Www-Authenticate": {`Basic realm="x"`, header}}}
+}
+
+func TestDigestAuthorize(t *testing.T) {
+	const nonce = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+
+	tests := []struct {
+		name      string
+		challenge string
+		hash      func() hash.Hash
+		qop       string
+		sess      bool
+	}{
+		{"md5", `realm="http-auth@example.org", qop="auth, auth-int", algorithm=MD5, nonce="` + nonce + `", opaque="abc"`, md5.New, "auth", false},
+		{"sha-256", `realm="http-auth@example.org", qop="auth", algorithm=SHA-256, nonce="` + nonce + `"`, sha256.New, "auth", false},
+		{"md5 without qop", `realm="http-auth@example.org", nonce="` + nonce + `"`, md5.New, "", false},
+		{"md5-sess", `realm="http-auth@example.org", qop="auth", algorithm=MD5-sess, nonce="` + nonce + `"`, md5.New, "auth", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Digest{Username: "Mufasa", Password: "Circle of Life"}
+			req, _ := http.NewRequest(http.MethodGet, "https://example.org/dir/index.html?x=1", nil)
+			if err := d.Authorize(req); err != nil || req.Header.Get("Authorization") != "" {
+				t.Fatalf("authorized before a challenge: %v", err)
+			}
+
+			retry, err := d.Challenge(challengeResponse("Digest " + tt.challenge))
+			if err != nil || !retry {
+				t.Fatalf("Challenge() = %v, %v", retry, err)
+			}
+			if err := d.Authorize(req); err != nil {
+				t.Fatal(err)
+			}
+
+			header, found := strings.CutPrefix(req.Header.Get("Authorization"), "Digest ")
+			if !found {
+				t.Fatalf("Authorization = %q", req.Header.Get("Authorization"))
+			}
+			got := parseAuthParams(header)
+			if got["username"] != "Mufasa" || got["uri"] != "/dir/index.html?x=1" || got["nonce"] != nonce || got["qop"] != tt.qop {
+				t.Errorf("fields %v", got)
+			}
+
+			h := func(parts ...string) string {
+				hash := tt.hash()
+				hash.Write([]byte(strings.Join(parts, ":")))
+				return hex.EncodeToString(hash.Sum(nil))
+			}
+			ha1 := h("Mufasa", "http-auth@example.org", "Circle of Life")
+			if tt.sess {
+				ha1 = h(ha1, nonce, got["cnonce"])
+			}
+			ha2 := h(http.MethodGet, "/dir/index.html?x=1")
+			want := h(ha1, nonce, ha2)
+			if tt.qop != "" {
+				if got["nc"] != "00000001" {
+					t.Errorf("nc = %q", got["nc"])
+				}
+				want = h(ha1, nonce, got["nc"], got["cnonce"], tt.qop, ha2)
+			}
+			if got["response"] != want {
+				t.Errorf("response = %q, want %q", got["response"], want)
+			}
+		})
+	}
+}
+
+func TestDigestChallenge(t *testing.T) {
+	d := &Digest{Username: "u", Password: "p"}
+
+	if _, err := d.Challenge(challengeResponse(`Bearer realm="x"`)); err == nil {
+		t.Error("accepted a challenge without digest")
+	}
+	if _, err := d.Challenge(challengeResponse(`Digest realm="x", nonce="1", algorithm=SHA-512-256`)); err == nil {
+		t.Error("accepted an unsupported algorithm")
+	}
+
+	steps := []struct {
+		challenge string
+		retry     bool
+	}{
+		{`Digest realm="x", nonce="1"`, true},
+		{`Digest realm="x", nonce="1"`, false},
+		{`Digest realm="x", nonce="1", stale=true`, true},
+		{`Digest realm="x", nonce="2"`, true},
+	}
+	for _, step := range steps {
+		retry, err := d.Challenge(challengeResponse(step.challenge))
+		if err != nil || retry != step.retry {
+			t.Errorf("Challenge(%s) = %v, %v, want %v", step.challenge, retry, err, step.retry)
+		}
+	}
+}
@@ -1,365 +1,505 @@
 package caldav
 
 import (
-	"bytes"
 	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"slices"
+	"net/url"
 	"strings"
 	"time"
 
-	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/auth"
+	"github.com/karsai5/tw-caldav/internal/remote"
 
 	"github.com/emersion/go-ical"
-	"github.com/emersion/go-webdav"
 	"github.com/emersion/go-webdav/caldav"
 )
 
-func NewClient(path string, username string, pass string) (*CalDavService, error) {
-	client := webdav.HTTPClientWithBasicAuth(nil, username, pass)
-	calDavClient, err := caldav.NewClient(client, path)
-
+// NewClient connects to the calendar home set discovered from a hostname,
+// an email address or a url. A url that discovery fails for is used as the
+// calendar home set, as it had to be before discovery.
+//
+// Requests are cancelled with ctx.
+func NewClient(ctx context.Context, path string, authenticator auth.Authenticator) (*CalDavService, error) {
+	httpClient, transport, err := newHTTPClient(authenticator, path)
 	if err != nil {
 		return nil, err
 	}
+	return connect(ctx, httpClient, transport, path)
+}
 
-	cd := CalDavService{
-		Client:    calDavClient,
-		BaseURL:   path,
-		Username:  username,
-		Password:  pass,
-		Calendars: make(CalendarNameToPathMap),
+// connect discovers the calendar home set. Servers such as iCloud keep it
+// on another host than the one configured, that host is trusted with the
+// credentials too.
+func connect(ctx context.Context, httpClient *http.Client, transport *auth.Transport, path string) (*CalDavService, error) {
+	home, err := Discover(ctx, httpClient, path)
+	if err != nil {
+		u, parseErr := url.Parse(path)
+		if parseErr != nil || u.Scheme == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, err
+		}
+		slog.Debug("Discovery failed, using url as calendar home set", "url", path, "err", err)
+		home = path
+	}
+	if !strings.HasSuffix(home, "/") {
+		home += "/"
+	}
+	homeURL, err := url.Parse(home)
+	if err != nil {
+		return nil, fmt.Errorf("While parsing calendar home set: %w", err)
+	}
+	if !strings.EqualFold(homeURL.Hostname(), transport.Origin.Hostname()) {
+		if err := transport.Trust(homeURL); err != nil {
+			slog.Warn("Calendar home set is sent requests without credentials", "url", homeURL.Redacted(), "err", err)
+		}
 	}
 
-	err = cd.PopulateCalendarMap()
+	calDavClient, err := caldav.NewClient(httpClient, home)
 	if err != nil {
 		return nil, err
 	}
 
-	err = cd.CreateDefaultCalendarIfDoesNotExist()
-	if err != nil {
+	cd := CalDavService{
+		Client:     calDavClient,
+		HTTPClient: httpClient,
+		BaseURL:    home,
+		ctx:        ctx,
+	}
+	if cd.Quirks, err = cd.quirks(); err != nil {
 		return nil, err
 	}
 
 	return &cd, nil
 }
 
-type CalendarNameToPathMap map[string]caldav.Calendar
-
 type CalDavService struct {
-	Client    *caldav.Client
-	BaseURL   string
-	Username  string
-	Password  string
-	Calendars CalendarNameToPathMap
+	Client     *caldav.Client
+	HTTPClient *http.Client
+	// BaseURL is the full url of the calendar home set
+	BaseURL string
+	Quirks  Quirks
+
+	// ctx cancels requests, remote.Backend methods don't take a context
+	ctx context.Context
 }
 
-var DEFAULT_CALENDAR = "default"
+var _ remote.Backend = &CalDavService{}
 
-func (cd *CalDavService) PopulateCalendarMap() error {
-	calendars, err := cd.Client.FindCalendars(context.TODO(), "")
+// ListCalendars implements remote.Backend. go-webdav doesn't read colors
+// or privileges, so the calendar home set is asked for them directly.
+func (cd *CalDavService) ListCalendars() ([]remote.Calendar, error) {
+	req, err := http.NewRequestWithContext(cd.ctx, "PROPFIND", cd.BaseURL, strings.NewReader(calendarsPropfind))
 	if err != nil {
-		return fmt.Errorf("While getting calendars: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "1")
+
+	resp, err := cd.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("While getting calendars: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("failed to get calendars, status code: %d", resp.StatusCode)
 	}
-	// clear existing calendars
-	for key := range cd.Calendars {
-		delete(cd.Calendars, key)
+	var ms calendarsMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("While parsing calendars: %w", err)
 	}
 
-	for _, c := range calendars {
-		if c.Name == "" {
-			slog.Error("Cannot use calendar without name", "path", c.Path)
+	result := []remote.Calendar{}
+	for _, r := range ms.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, fmt.Errorf("While parsing calendar path: %w", err)
+		}
+		cal := remote.Calendar{Path: href.Path}
+		isCalendar := false
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			prop := ps.Prop
+			if prop.ResourceType.Calendar != nil {
+				isCalendar = true
+			}
+			if name := strings.TrimSpace(prop.DisplayName); name != "" {
+				cal.Name = name
+			}
+			for _, comp := range prop.ComponentSet.Comps {
+				cal.Components = append(cal.Components, comp.Name)
+			}
+			if color := normalizeColor(prop.Color); color != "" {
+				cal.Color = color
+			}
+			if prop.Privileges != nil {
+				cal.ReadOnly = !prop.Privileges.canWrite()
+			}
+		}
+		if !isCalendar {
 			continue
 		}
-		if existingCalendar, exists := cd.Calendars[c.Name]; exists {
-			return fmt.Errorf("Two calendars found with the same name '%s' %s %s", c.Name, existingCalendar, c.Path)
+		if cd.Quirks.SeparateComponents && !cal.SupportsTodos() {
+			continue
 		}
-		cd.Calendars[c.Name] = c
+		result = append(result, cal)
 	}
-	return nil
+	return result, nil
 }
 
-func (cd *CalDavService) CreateDefaultCalendarIfDoesNotExist() error {
-	if _, exists := cd.Calendars[DEFAULT_CALENDAR]; exists {
-		return nil
-	}
-
-	_, err := cd.CreateCalendar(DEFAULT_CALENDAR, DEFAULT_CALENDAR)
-	if err != nil {
-		return err
-	}
-	slog.Info("Default calendar created remotely")
+const calendarsPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav" xmlns:A="http://apple.com/ns/ical/">
+  <D:prop>
+    <D:resourcetype/>
+    <D:displayname/>
+    <D:current-user-privilege-set/>
+    <C:supported-calendar-component-set/>
+    <A:calendar-color/>
+  </D:prop>
+</D:propfind>`
+
+type calendarsMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+				} `xml:"DAV: resourcetype"`
+				DisplayName  string `xml:"DAV: displayname"`
+				ComponentSet struct {
+					Comps []struct {
+						Name string `xml:"name,attr"`
+					} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+				} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+				Color      string        `xml:"http://apple.com/ns/ical/ calendar-color"`
+				Privileges *privilegeSet `xml:"DAV: current-user-privilege-set"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
 
-	return nil
+type privilegeSet struct {
+	Privileges []struct {
+		Inner struct {
+			XMLName xml.Name
+		} `xml:",any"`
+	} `xml:"DAV: privilege"`
 }
 
-func (cd *CalDavService) FindOrCreateCalendar(name string) (calendar string, err error) {
-	cal, exists := cd.Calendars[name]
-	if exists {
-		return cal.Path, nil
+// canWrite reports whether the privileges allow changing items
+func (p *privilegeSet) canWrite() bool {
+	for _, privilege := range p.Privileges {
+		switch privilege.Inner.XMLName.Local {
+		case "all", "write", "write-content", "bind":
+			return true
+		}
 	}
+	return false
+}
 
-	return cd.CreateCalendar(name, name)
+// normalizeColor turns the #RRGGBBAA colors some servers use into #RRGGBB
+func normalizeColor(color string) string {
+	color = strings.TrimSpace(color)
+	if len(color) == 9 && strings.HasPrefix(color, "#") {
+		return color[:7]
+	}
+	return color
 }
 
-func (cd *CalDavService) CreateCalendar(path, name string) (finalPath string, err error) {
+// CreateCalendar implements remote.Backend.
+func (cd *CalDavService) CreateCalendar(name string) (remote.Calendar, error) {
+	componentSet := `
+   <C:supported-calendar-component-set>
+     <C:comp name="VTODO"/>
+   </C:supported-calendar-component-set>`
+	if cd.Quirks.NoComponentSet {
+		componentSet = ""
+	}
 	body := `
 	<C:mkcalendar xmlns:D="DAV:"
            xmlns:C="urn:ietf:params:xml:ns:caldav">
   <D:set>
  <D:prop>
-   <D:displayname>` + xmlEscape(name) + `</D:displayname>
-   <C:supported-calendar-component-set>
-     <C:comp name="VTODO"/>
-   </C:supported-calendar-component-set>
+   <D:displayname>` + xmlEscape(name) + `</D:displayname>` + componentSet + `
  </D:prop>
   </D:set>
 </C:mkcalendar>
 	`
 
-	finalPath = cd.BaseURL + "/" + path
+	// The name is escaped as a single path segment of the home set
+	finalPath, err := cd.resolve("./" + url.PathEscape(name) + "/")
+	if err != nil {
+		return remote.Calendar{}, err
+	}
 	slog.Debug("Creating calendar", "name", name, "path", finalPath)
-	req, err := http.NewRequest("MKCALENDAR", finalPath, strings.NewReader(body))
+	req, err := http.NewRequestWithContext(cd.ctx, "MKCALENDAR", finalPath, strings.NewReader(body))
 	if err != nil {
-		return finalPath, fmt.Errorf("failed to create request: %w", err)
+		return remote.Calendar{}, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/xml")
-	req.SetBasicAuth(cd.Username, cd.Password)
 
 	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := cd.do(req)
 	if err != nil {
-		return finalPath, fmt.Errorf("failed to send request: %w", err)
+		return remote.Calendar{}, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check for success
 	if resp.StatusCode != http.StatusCreated {
-		return finalPath, fmt.Errorf("failed to create calendar, status code: %d", resp.StatusCode)
+		return remote.Calendar{}, fmt.Errorf("failed to create calendar, status code: %d", resp.StatusCode)
 	}
 
-	// TODO: optimise this so that we don't have to recreate the calendar
-	// map completely every time a new calendar is created
-	err = cd.PopulateCalendarMap()
+	// Look the calendar up again for the properties the server set
+	calendars, err := cd.ListCalendars()
 	if err != nil {
-		return "", err
+		return remote.Calendar{}, err
 	}
-
-	return cd.Calendars[name].Path, nil
-}
-
-func (cd *CalDavService) CreateNewTodo(t task.Task) (finalPath string, err error) {
-	syncTime := time.Now()
-	taskCalendar := t.Project()
-	if taskCalendar == "" {
-		taskCalendar = DEFAULT_CALENDAR
+	created, err := url.Parse(finalPath)
+	if err != nil {
+		return remote.Calendar{}, err
 	}
-
-	foundCalendar, exists := cd.Calendars[taskCalendar]
-	calendarPath := ""
-
-	if exists {
-		calendarPath = foundCalendar.Path
-	} else {
-		path, err := cd.CreateCalendar(t.Project(), t.Project())
-		if err != nil {
-			return finalPath, err
+	for _, c := range calendars {
+		if strings.TrimSuffix(c.Path, "/") == strings.TrimSuffix(created.EscapedPath(), "/") ||
+			strings.TrimSuffix(c.Path, "/") == strings.TrimSuffix(created.Path, "/") {
+			return c, nil
 		}
-		calendarPath = path
 	}
-
-	icalPath := fmt.Sprintf("%s%s.ical", calendarPath, *t.LocalId())
-
-	cal := ical.NewCalendar()
-	cal.Component.Name = "VCALENDAR"
-
-	addStringProp(&cal.Component.Props, "PRODID", "-//Karsai5//tw-caldav 2025.6.7//EN")
-	addTimeProp(&cal.Component.Props, "DTSTAMP", syncTime)
-	addStringProp(&cal.Component.Props, "VERSION", "2.0")
-	addStringProp(&cal.Component.Props, "UID", *t.LocalId())
-
-	todo := ical.NewComponent("VTODO")
-
-	addTimeProp(&todo.Props, "DTSTAMP", time.Now())
-	updatePropsWithInformationFromTask(&todo.Props, t)
-
-	cal.Component.Children = append(cal.Component.Children, todo)
-
-	buf := new(bytes.Buffer)
-	encoder := ical.NewEncoder(buf)
-	encoder.Encode(cal)
-	slog.Debug("Creating caldav ical", "path", icalPath, "ical", buf.String())
-
-	res, err := cd.Client.PutCalendarObject(context.TODO(), icalPath, cal)
-	if err != nil {
-		return "", err
+	for _, c := range calendars {
+		if c.Name == name {
+			return c, nil
+		}
 	}
-
-	return res.Path, nil
+	return remote.Calendar{}, fmt.Errorf("Created calendar %q could not be found", name)
 }
 
-func updatePropsWithInformationFromTask(props *ical.Props, t task.Task) {
-	addStringProp(props, "SUMMARY", t.Description())
-
-	if status := statusToCalDavStatus(t.Status()); status != "" {
-		addStringProp(props, "STATUS", status)
-	}
-
-	addTimeProp(props, "LAST-MODIFIED", time.Now())
-
-	if t.Due() != nil {
-		addTimeProp(props, "DUE", *t.Due())
-		addTimeProp(props, "DTSTART", *t.Due())
+// UpdateCalendar implements remote.Backend.
+func (cd *CalDavService) UpdateCalendar(cal remote.Calendar) error {
+	props := `<D:displayname>` + xmlEscape(cal.Name) + `</D:displayname>`
+	remove := ""
+	if cal.Color != "" {
+		props += `<A:calendar-color>` + xmlEscape(cal.Color) + `</A:calendar-color>`
 	} else {
-		props.Del("DUE")
-		props.Del("DTSTART")
+		remove = `<D:remove><D:prop><A:calendar-color/></D:prop></D:remove>`
 	}
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:A="http://apple.com/ns/ical/">
+  <D:set><D:prop>` + props + `</D:prop></D:set>` + remove + `
+</D:propertyupdate>`
 
-	if t.Priority() != task.PriorityUnset {
-		addStringProp(props, "PRIORITY", fmt.Sprintf("%d", t.Priority()))
-	} else {
-		props.Del("PRIORITY")
+	calURL, err := cd.resolve(cal.Path)
+	if err != nil {
+		return err
 	}
-
-	if t.LocalId() != nil {
-		addStringProp(props, "UID", *t.LocalId())
+	slog.Debug("Updating calendar", "path", cal.Path, "name", cal.Name, "color", cal.Color)
+	req, err := http.NewRequestWithContext(cd.ctx, "PROPPATCH", calURL, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/xml")
 
-	if len(t.Tags()) > 0 {
-		tmpProps := *props
-		tmpProps["CATEGORIES"] = []ical.Prop{
-			{
-				Name:  "CATEGORIES",
-				Value: strings.Join(t.Tags(), ","),
-			},
-		}
+	resp, err := cd.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to update calendar, status code: %d", resp.StatusCode)
 	}
 
-	desc := fmt.Sprintf("taskwarrior_id=%s", *t.LocalId())
-	if existingDescription := props.Get("DESCRIPTION"); existingDescription != nil {
-		if strings.Index(existingDescription.Value, "taskwarrior_id=") < 0 {
-			desc = fmt.Sprintf("%s\n%s", existingDescription.Value, desc)
+	// A multistatus can still hold a failed property
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var ms struct {
+		Statuses []string `xml:"response>propstat>status"`
+	}
+	if err := xml.Unmarshal(data, &ms); err == nil {
+		for _, status := range ms.Statuses {
+			if !strings.Contains(status, " 200 ") && !strings.Contains(status, " 204 ") {
+				return fmt.Errorf("failed to update calendar: %s", strings.TrimSpace(status))
+			}
 		}
 	}
-	addStringProp(props, "DESCRIPTION", desc)
+	return nil
 }
 
-func statusToCalDavStatus(s task.Status) string {
-	switch s {
-	case task.StatusComplete:
-		return "COMPLETED"
-	case task.StatusDeleted:
-		return "CANCELLED"
-	default:
-		return ""
-	}
+// DeleteCalendar implements remote.Backend.
+func (cd *CalDavService) DeleteCalendar(cal remote.Calendar) error {
+	slog.Debug("Deleting calendar", "path", cal.Path)
+	return cd.Client.RemoveAll(cd.ctx, cal.Path)
+}
 
+// ListItems implements remote.Backend.
+func (cd *CalDavService) ListItems(cal remote.Calendar) ([]remote.Item, error) {
+	query := &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+		CompFilter:  caldav.CompFilter{Name: "VCALENDAR", Comps: []caldav.CompFilter{{Name: "VTODO"}}},
+	}
+	objects, err := cd.Client.QueryCalendar(cd.ctx, cal.Path, query)
+	if err != nil {
+		return nil, err
+	}
+	items := []remote.Item{}
+	for _, obj := range objects {
+		items = append(items, toItem(obj))
+	}
+	return items, nil
 }
 
-func addStringProp(props *ical.Props, name string, value string) {
-	prop := ical.NewProp(name)
-	prop.SetText(value)
-	props.Set(prop)
+// GetItem implements remote.Backend.
+func (cd *CalDavService) GetItem(path string) (remote.Item, error) {
+	obj, err := cd.Client.GetCalendarObject(cd.ctx, path)
+	if err != nil {
+		return remote.Item{}, fmt.Errorf("While getting calendar object: %w", err)
+	}
+	return toItem(*obj), nil
 }
 
-func addTimeProp(props *ical.Props, name string, value time.Time) {
-	prop := ical.NewProp(name)
-	prop.SetDateTime(value)
-	props.Set(prop)
+// CreateItem implements remote.Backend.
+func (cd *CalDavService) CreateItem(cal remote.Calendar, uid string, data *ical.Calendar) (remote.Item, error) {
+	return cd.UpdateItem(fmt.Sprintf("%s%s.ical", cal.Path, uid), data)
 }
 
-func (cd *CalDavService) GetAllTodos() (todos []Todo, err error) {
-	calendars, err := cd.Client.FindCalendars(context.TODO(), "")
+// UpdateItem implements remote.Backend.
+func (cd *CalDavService) UpdateItem(path string, data *ical.Calendar) (remote.Item, error) {
+	obj, err := cd.Client.PutCalendarObject(cd.ctx, path, cd.Quirks.encode(data))
 	if err != nil {
-		return todos, fmt.Errorf("While getting calendars: %w", err)
+		return remote.Item{}, err
 	}
-
-	for _, cal := range calendars {
-		calTodos, err := cd.GetTodosForCalendar(cal.Path)
-		if err != nil {
-			return todos, fmt.Errorf("While getting todos for calendar: %w", err)
-		}
-		for _, calTodo := range calTodos {
-			todo, err := cd.mapTodo(&cal, &calTodo)
-			if err != nil {
-				return todos, fmt.Errorf("While creating todo: %w", err)
-			}
-			todos = append(todos, *todo)
-		}
+	if cd.Quirks.RewritesLastModified {
+		return cd.GetItem(path)
 	}
-	return todos, nil
+	obj.Data = data
+	return toItem(*obj), nil
 }
 
-func (cd *CalDavService) GetTodo(project string, icalPath string) (Todo, error) {
-	// path, _ := getpathAndFilename(icalPath)
-	// path = path[:len(path)-1]
-	//
-	// slog.Debug("test", "calendar", cd.Calendars, "path", path)
-
-	if project == "" {
-		project = "default"
+// MoveItem implements remote.Backend. Servers that can't MOVE, by their
+// profile or by answering 405 or 501, get the item deleted and created
+// again in the other calendar.
+func (cd *CalDavService) MoveItem(path string, to remote.Calendar) (string, error) {
+	newPath := to.Path + path[strings.LastIndex(path, "/")+1:]
+	if cd.Quirks.MoveByRecreate {
+		return newPath, cd.recreate(path, newPath)
 	}
 
-	calendar, exists := cd.Calendars[project]
-	if !exists {
-		return Todo{}, fmt.Errorf("No calendar found for %q", project)
+	source, err := cd.resolve(path)
+	if err != nil {
+		return "", err
 	}
-
-	calObj, err := cd.Client.GetCalendarObject(context.TODO(), icalPath)
+	destination, err := cd.resolve(newPath)
 	if err != nil {
-		return Todo{}, fmt.Errorf("While getting calendar object: %w", err)
+		return "", err
 	}
-
-	todo, err := cd.mapTodo(&calendar, calObj)
+	req, err := http.NewRequestWithContext(cd.ctx, "MOVE", source, nil)
 	if err != nil {
-		return Todo{}, fmt.Errorf("While mapping todo: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("Destination", destination)
+	req.Header.Set("Overwrite", "F")
+	resp, err := cd.do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
 
-	return *todo, nil
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return newPath, nil
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		slog.Debug("MOVE not supported, deleting and creating instead", "path", path, "status", resp.StatusCode)
+		return newPath, cd.recreate(path, newPath)
+	default:
+		return "", fmt.Errorf("failed to move item, status code: %d", resp.StatusCode)
+	}
 }
 
-func (cd *CalDavService) GetTodosForCalendar(calendarPath string) ([]caldav.CalendarObject, error) {
-	query := &caldav.CalendarQuery{
-		CompRequest: caldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
-		CompFilter:  caldav.CompFilter{Name: "VCALENDAR", Comps: []caldav.CompFilter{{Name: "VTODO"}}},
-	}
-	objects, err := cd.Client.QueryCalendar(context.TODO(), calendarPath, query)
+// recreate moves an item by deleting it and creating it at the new path.
+// The item is put back when it can't be created at the new path.
+func (cd *CalDavService) recreate(path string, newPath string) error {
+	item, err := cd.GetItem(path)
 	if err != nil {
-		return []caldav.CalendarObject{}, err
+		return err
+	}
+	if err := cd.DeleteItem(path); err != nil {
+		return fmt.Errorf("While deleting item to move it: %w", err)
 	}
-	return objects, nil
+	if _, err := cd.UpdateItem(newPath, item.Data); err != nil {
+		if _, restoreErr := cd.UpdateItem(path, item.Data); restoreErr != nil {
+			return fmt.Errorf("While creating moved item, it could not be restored at %s: %w", path, errors.Join(err, restoreErr))
+		}
+		return fmt.Errorf("While creating moved item: %w", err)
+	}
+	return nil
 }
 
-func (cd *CalDavService) mapTodo(cal *caldav.Calendar, calObj *caldav.CalendarObject) (*Todo, error) {
-	if cal == nil {
-		return nil, fmt.Errorf("cal can't be nil")
+// DeleteItem implements remote.Backend.
+func (cd *CalDavService) DeleteItem(path string) error {
+	return cd.Client.RemoveAll(cd.ctx, path)
+}
+
+// do sends a request that go-webdav has no method for
+func (cd *CalDavService) do(req *http.Request) (*http.Response, error) {
+	return cd.HTTPClient.Do(req)
+}
+
+// ServerTime returns the time of the server from the Date header of its
+// answer to OPTIONS
+func (cd *CalDavService) ServerTime() (time.Time, error) {
+	header, err := cd.options()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("While getting server time: %w", err)
 	}
-	if calObj == nil {
-		return nil, fmt.Errorf("calObj can't be nil")
+	date := header.Get("Date")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("Server sent no Date header")
 	}
+	return http.ParseTime(date)
+}
 
-	vTodoIndex := slices.IndexFunc(calObj.Data.Children, func(child *ical.Component) bool {
-		if child.Name == "VTODO" {
-			return true
-		}
-		return false
-	})
-
-	if vTodoIndex < 0 {
-		return nil, fmt.Errorf("Could not find VTODO in calObj")
+// options returns the headers of the answer to OPTIONS on the calendar
+// home set
+func (cd *CalDavService) options() (http.Header, error) {
+	req, err := http.NewRequestWithContext(cd.ctx, http.MethodOptions, cd.BaseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	resp, err := cd.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
 
-	todo := Todo{
-		calDavService:  cd,
-		Calendar:       cal,
-		CalendarObject: calObj,
-		TodoComponent:  calObj.Data.Children[vTodoIndex],
-		Path:           calObj.Path,
+// resolve turns a path returned by the server into a full url
+func (cd *CalDavService) resolve(path string) (string, error) {
+	base, err := url.Parse(cd.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("While parsing url: %w", err)
 	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("While parsing path: %w", err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
 
-	return &todo, nil
+func toItem(obj caldav.CalendarObject) remote.Item {
+	return remote.Item{
+		Path:    obj.Path,
+		ETag:    obj.ETag,
+		ModTime: obj.ModTime,
+		Data:    obj.Data,
+	}
 }
 
 func xmlEscape(input string) string {
@@ -0,0 +1,244 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// maxRedirects limits the redirects followed from .well-known/caldav
+const maxRedirects = 5
+
+// lookupSRV finds the context url in the _caldavs._tcp SRV record of a
+// domain
+var lookupSRV = caldav.DiscoverContextURL
+
+// Discover finds the calendar home set of the user (RFC 6764). The input
+// can be a hostname, an email address or a url. A url with a path is
+// tried first as is, so the url of a calendar home keeps working.
+//
+// The context path is found with the _caldavs._tcp SRV record or
+// /.well-known/caldav, then current-user-principal leads to
+// calendar-home-set. The full url of the calendar home set is returned.
+// Credentials are only sent to the host of the input during discovery, a
+// server on another host has to be given as the url. The calendar home set
+// may be on another host, NewClient trusts it once it is found.
+func Discover(ctx context.Context, httpClient *http.Client, input string) (string, error) {
+	candidates, err := contextURLs(ctx, input)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []error
+	for _, candidate := range candidates {
+		home, err := findHomeSet(ctx, httpClient, candidate)
+		if err == nil {
+			slog.Debug("Discovered calendar home set", "from", candidate, "home", home)
+			return home, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+	}
+	return "", fmt.Errorf("While discovering calendars for %q: %w", input, errors.Join(errs...))
+}
+
+// contextURLs returns the urls to look for the principal at, in order
+func contextURLs(ctx context.Context, input string) ([]string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("No url to discover calendars from")
+	}
+
+	candidates := []string{}
+	host := input
+	if strings.Contains(input, "://") {
+		u, err := url.Parse(input)
+		if err != nil {
+			return nil, fmt.Errorf("While parsing url: %w", err)
+		}
+		if strings.Trim(u.Path, "/") != "" {
+			candidates = append(candidates, input)
+		}
+		host = u.Scheme + "://" + u.Host
+	} else {
+		if _, domain, found := strings.Cut(input, "@"); found {
+			host = domain
+		}
+		if srv, err := lookupSRV(ctx, host); err == nil {
+			candidates = append(candidates, srv)
+		}
+		host = "https://" + host
+	}
+
+	return append(candidates, host+"/.well-known/caldav", host+"/"), nil
+}
+
+// findHomeSet asks the server for the principal and its calendar home set
+func findHomeSet(ctx context.Context, httpClient *http.Client, contextURL string) (string, error) {
+	endpoint, principal, err := findPrincipal(ctx, httpClient, contextURL)
+	if err != nil {
+		return "", fmt.Errorf("While finding principal: %w", err)
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	principalURL := base.ResolveReference(&url.URL{Path: principal}).String()
+
+	home, err := findCalendarHomeSet(ctx, httpClient, principalURL)
+	if err != nil {
+		return "", fmt.Errorf("While finding calendar home set: %w", err)
+	}
+	if home == "" {
+		return "", fmt.Errorf("Server has no calendar home set for %s", principal)
+	}
+
+	ref, err := url.Parse(home)
+	if err != nil {
+		return "", fmt.Errorf("While parsing calendar home set: %w", err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// findCalendarHomeSet asks a principal for its calendar home set. The href
+// is returned as is, go-webdav keeps only its path but servers such as
+// iCloud keep the calendar home set on another host.
+func findCalendarHomeSet(ctx context.Context, httpClient *http.Client, principalURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "PROPFIND", principalURL, strings.NewReader(homeSetPropfind))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	req.Header.Set("Depth", "0")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return "", fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	var ms homeSetMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return "", fmt.Errorf("While parsing calendar home set: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if href := strings.TrimSpace(ps.Prop.HomeSet.Href); href != "" {
+				return href, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// findPrincipal asks for current-user-principal, following redirects with
+// PROPFIND requests. Go's client turns a redirected PROPFIND into a GET,
+// so the redirects of .well-known/caldav are followed here. The url that
+// answered is returned with the principal path.
+func findPrincipal(ctx context.Context, httpClient *http.Client, target string) (string, string, error) {
+	client := *httpClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	for range maxRedirects {
+		req, err := http.NewRequestWithContext(ctx, "PROPFIND", target, strings.NewReader(principalPropfind))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Depth", "0")
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to send request: %w", err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", "", err
+		}
+
+		location := resp.Header.Get("Location")
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+			base, err := url.Parse(target)
+			if err != nil {
+				return "", "", err
+			}
+			ref, err := url.Parse(location)
+			if err != nil {
+				return "", "", fmt.Errorf("While parsing redirect: %w", err)
+			}
+			target = base.ResolveReference(ref).String()
+			continue
+		}
+		if resp.StatusCode != http.StatusMultiStatus {
+			return "", "", fmt.Errorf("status code: %d", resp.StatusCode)
+		}
+
+		var ms principalMultistatus
+		if err := xml.Unmarshal(data, &ms); err != nil {
+			return "", "", fmt.Errorf("While parsing principal: %w", err)
+		}
+		for _, r := range ms.Responses {
+			for _, ps := range r.Propstats {
+				if href := strings.TrimSpace(ps.Prop.Principal.Href); href != "" {
+					// The href may be a full url, go-webdav wants a path
+					u, err := url.Parse(href)
+					if err != nil {
+						return "", "", fmt.Errorf("While parsing principal: %w", err)
+					}
+					return target, u.Path, nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("Server didn't return a principal, check the credentials")
+	}
+	return "", "", fmt.Errorf("Too many redirects")
+}
+
+type principalMultistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			Prop struct {
+				Principal struct {
+					Href string `xml:"DAV: href"`
+				} `xml:"DAV: current-user-principal"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+type homeSetMultistatus struct {
+	Responses []struct {
+		Propstats []struct {
+			Prop struct {
+				HomeSet struct {
+					Href string `xml:"DAV: href"`
+				} `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const homeSetPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-home-set/>
+  </D:prop>
+</D:propfind>`
+
+const principalPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop>
+    <D:current-user-principal/>
+  </D:prop>
+</D:propfind>`
@@ -0,0 +1,219 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func stubSRV(t *testing.T, srv func(domain string) (string, error)) {
+	t.Helper()
+	original := lookupSRV
+	lookupSRV = func(ctx context.Context, domain string) (string, error) { return srv(domain) }
+	t.Cleanup(func() { lookupSRV = original })
+}
+
+func noSRV(domain string) (string, error) {
+	return "", fmt.Errorf("no SRV record for %s", domain)
+}
+
+func TestContextURLs(t *testing.T) {
+	srv := func(domain string) (string, error) {
+		if domain == "example.com" {
+			return "https://dav.example.com/caldav/", nil
+		}
+		return noSRV(domain)
+	}
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"https://dav.example.com/remote.php/dav/", []string{
+			"https://dav.example.com/remote.php/dav/",
+			"https://dav.example.com/.well-known/caldav",
+			"https://dav.example.com/",
+		}},
+		{"http://localhost:5232", []string{
+			"http://localhost:5232/.well-known/caldav",
+			"http://localhost:5232/",
+		}},
+		{"example.com", []string{
+			"https://dav.example.com/caldav/",
+			"https://example.com/.well-known/caldav",
+			"https://example.com/",
+		}},
+		{"alice@example.com", []string{
+			"https://dav.example.com/caldav/",
+			"https://example.com/.well-known/caldav",
+			"https://example.com/",
+		}},
+		{"alice@example.org", []string{
+			"https://example.org/.well-known/caldav",
+			"https://example.org/",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			stubSRV(t, srv)
+			got, err := contextURLs(context.Background(), tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := contextURLs(context.Background(), " "); err == nil {
+		t.Error("no error for an empty input")
+	}
+}
+
+// davHost answers principal requests at principals, redirects the paths
+// in redirects and keeps the Authorization headers it was sent
+type davHost struct {
+	principals map[string]bool
+	redirects  map[string]string
+
+	mu            sync.Mutex
+	authorization []string
+}
+
+func (h *davHost) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.authorization = append(h.authorization, r.Header.Get("Authorization"))
+	h.mu.Unlock()
+
+	requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if location, found := h.redirects[r.URL.Path]; found {
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+		switch {
+		case r.Method != "PROPFIND":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case strings.Contains(string(body), "current-user-principal") && h.principals[r.URL.Path]:
+			principalResponse(w, "/principals/alice/")
+		case strings.Contains(string(body), "calendar-home-set") && r.URL.Path == "/principals/alice/":
+			homeSetResponse(w, r.URL.Path, "/calendars/alice/")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})(w, r)
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		srv        string
+		principals []string
+		redirects  map[string]string
+		other      *davHost
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "url with a path",
+			input:      "https://example.test/dav/",
+			principals: []string{"/dav/"},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:       "srv record",
+			input:      "alice@example.test",
+			srv:        "https://example.test/srv/",
+			principals: []string{"/srv/"},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:       "well-known redirect",
+			input:      "example.test",
+			principals: []string{"/dav/"},
+			redirects:  map[string]string{"/.well-known/caldav": "/dav/"},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:       "srv record that doesn't answer falls back to well-known",
+			input:      "alice@example.test",
+			srv:        "https://example.test/gone/",
+			principals: []string{"/dav/"},
+			redirects:  map[string]string{"/.well-known/caldav": "/dav/"},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:       "root",
+			input:      "example.test",
+			principals: []string{"/"},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:       "cross-host redirect gets no credentials",
+			input:      "example.test",
+			principals: []string{"/"},
+			redirects:  map[string]string{"/.well-known/caldav": "https://dav.other.test/dav/"},
+			other:      &davHost{principals: map[string]bool{"/dav/": true}},
+			want:       "https://example.test/calendars/alice/",
+		},
+		{
+			name:      "redirect loop",
+			input:     "https://example.test/loop/",
+			redirects: map[string]string{"/loop/": "/loop/", "/.well-known/caldav": "/loop/", "/": "/loop/"},
+			wantErr:   true,
+		},
+		{
+			name:    "nothing answers",
+			input:   "example.test",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubSRV(t, func(domain string) (string, error) {
+				if tt.srv == "" || domain != "example.test" {
+					return noSRV(domain)
+				}
+				return tt.srv, nil
+			})
+			host := &davHost{principals: map[string]bool{}, redirects: tt.redirects}
+			for _, p := range tt.principals {
+				host.principals[p] = true
+			}
+			handlers := map[string]http.Handler{"example.test": host}
+			if tt.other != nil {
+				handlers["dav.other.test"] = tt.other
+			}
+			hosts := newTestHosts(t, handlers)
+			// The test servers listen on random ports, the hostnames are
+			// dialled whatever the port
+			client, _ := hosts.client(t, tt.input)
+
+			got, err := Discover(context.Background(), client, tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.other != nil {
+				if len(tt.other.authorization) == 0 {
+					t.Error("redirect target wasn't asked")
+				}
+				for _, authorization := range tt.other.authorization {
+					if authorization != "" {
+						t.Errorf("credentials sent to the redirect target: %q", authorization)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package caldav
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/auth"
+	"github.com/karsai5/tw-caldav/internal/utils/origin"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	defaultRetries = 3
+	// retryBackoff is the wait before the first retry, doubled for each
+	// retry after it
+	retryBackoff = time.Second
+	// maxRetryWait caps the wait a server can ask for with Retry-After
+	maxRetryWait = 2 * time.Minute
+)
+
+// newHTTPClient returns the client every request to the server is sent
+// with, including the ones go-webdav has no method for, and the transport
+// that authorizes them. Credentials are only sent to the server at
+// address and the hosts trusted on the transport.
+func newHTTPClient(authenticator auth.Authenticator, address string) (*http.Client, *auth.Transport, error) {
+	transport, err := newTransport()
+	if err != nil {
+		return nil, nil, err
+	}
+	serverOrigin, err := origin.Parse(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if bearer, ok := authenticator.(*auth.Bearer); ok && bearer.HTTPClient == nil {
+		// Refresh tokens through the same proxy and CA bundle
+		bearer.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	timeout, err := requestTimeout()
+	if err != nil {
+		return nil, nil, err
+	}
+	retries, err := maxRetries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authTransport := &auth.Transport{Base: transport, Auth: authenticator, Origin: serverOrigin}
+	return &http.Client{
+		Transport: &retryTransport{
+			Base:    authTransport,
+			Retries: retries,
+			Timeout: timeout,
+		},
+	}, authTransport, nil
+}
+
+// newTransport applies the TLS and proxy settings: ca_bundle,
+// insecure_skip_verify, the client certificate and proxy. Without a proxy
+// key the HTTPS_PROXY and NO_PROXY environment variables are used.
+func newTransport() (*http.Transport, error) {
+	certificates, err := auth.ClientCertificates()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{
+		Certificates:       certificates,
+		InsecureSkipVerify: viper.GetBool("insecure_skip_verify"),
+	}
+	if tlsConfig.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is disabled with insecure_skip_verify")
+	}
+
+	if bundle := viper.GetString("ca_bundle"); bundle != "" {
+		pem, err := os.ReadFile(bundle)
+		if err != nil {
+			return nil, fmt.Errorf("While reading ca_bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in ca_bundle %s", bundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if proxy := viper.GetString("proxy"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("While parsing proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return transport, nil
+}
+
+// requestTimeout returns the timeout key, a duration like 30s. Each attempt
+// of a request gets the whole timeout, 0 turns it off.
+func requestTimeout() (time.Duration, error) {
+	value := viper.GetString("timeout")
+	if value == "" {
+		return defaultTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("While parsing timeout: %w", err)
+	}
+	return timeout, nil
+}
+
+// maxRetries returns the retries key, how often a request is sent again
+// after a 5xx or 429 answer or a network error, where that is safe
+func maxRetries() (int, error) {
+	value := viper.GetString("retries")
+	if value == "" {
+		return defaultRetries, nil
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		return 0, fmt.Errorf("Invalid retries %q", value)
+	}
+	return retries, nil
+}
+
+// retryTransport sends requests again when the server is overloaded or
+// failing, waiting longer each time or as long as Retry-After asks. After
+// a network error or a 5xx only requests that are safe to repeat are
+// sent again, the first attempt may have been applied.
+type retryTransport struct {
+	Base    http.RoundTripper
+	Retries int
+	Timeout time.Duration
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		body := req.Body
+		if attempt > 0 && req.GetBody != nil {
+			var err error
+			if body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.send(req, body)
+		canRetry := attempt < t.Retries && (req.Body == nil || req.GetBody != nil)
+		if !canRetry || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if !repeatable(req) {
+				return resp, err
+			}
+			wait = backoff(attempt)
+		case notProcessed(resp) || (resp.StatusCode >= 500 && repeatable(req)):
+			wait = retryAfter(resp, attempt)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		slog.Debug("Retrying request", "method", req.Method, "url", req.URL.String(), "attempt", attempt+1, "wait", wait, "err", err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// repeatable reports whether a request can be sent again when it isn't
+// known whether the server applied it. A PUT is only repeatable when it is
+// conditional, otherwise it could overwrite a change made in between.
+func repeatable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT":
+		return true
+	case http.MethodPut:
+		return req.Header.Get("If-Match") != "" || req.Header.Get("If-None-Match") != ""
+	default:
+		return false
+	}
+}
+
+// notProcessed reports whether the server turned a request away without
+// applying it, so any request can be sent again
+func notProcessed(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return resp.Header.Get("Retry-After") != ""
+	default:
+		return false
+	}
+}
+
+// send sends one attempt of a request, within the timeout
+func (t *retryTransport) send(req *http.Request, body io.ReadCloser) (*http.Response, error) {
+	ctx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if t.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+	}
+	attempt := req.Clone(ctx)
+	attempt.Body = body
+
+	resp, err := t.Base.RoundTrip(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The timeout covers reading the body too
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// backoff returns an exponential wait with some jitter, so many clients
+// don't retry at the same moment
+func backoff(attempt int) time.Duration {
+	wait := retryBackoff << attempt
+	return wait + rand.N(wait/2+1)
+}
+
+// retryAfter returns the wait the server asked for with Retry-After, in
+// seconds or as a date, or the backoff when it didn't ask
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return backoff(attempt)
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	} else {
+		return backoff(attempt)
+	}
+	return min(max(wait, 0), maxRetryWait)
+}
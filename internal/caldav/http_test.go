@@ -0,0 +1,289 @@
+package caldav
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/auth"
+	"github.com/karsai5/tw-caldav/internal/utils/origin"
+)
+
+// testHosts serves TLS test servers under made up hostnames, to test what
+// is sent to which host
+type testHosts struct {
+	servers map[string]*httptest.Server
+}
+
+func newTestHosts(t *testing.T, handlers map[string]http.Handler) *testHosts {
+	t.Helper()
+	h := &testHosts{servers: map[string]*httptest.Server{}}
+	for host, handler := range handlers {
+		srv := httptest.NewTLSServer(handler)
+		t.Cleanup(srv.Close)
+		h.servers[host] = srv
+	}
+	return h
+}
+
+// url returns the base url of a host
+func (h *testHosts) url(host string) string {
+	_, port, _ := net.SplitHostPort(h.servers[host].Listener.Addr().String())
+	return fmt.Sprintf("https://%s:%s", host, port)
+}
+
+// transport connects to the test server of a hostname
+func (h *testHosts) transport() *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			srv, exists := h.servers[host]
+			if !exists {
+				return nil, fmt.Errorf("unknown test host %s", host)
+			}
+			return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+}
+
+// client returns a client that sends credentials to serverURL, the way
+// newHTTPClient does
+func (h *testHosts) client(t *testing.T, serverURL string) (*http.Client, *auth.Transport) {
+	t.Helper()
+	u, err := origin.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &auth.Transport{Base: h.transport(), Auth: &auth.Basic{Username: "alice", Password: "secret"}, Origin: u}
+	return &http.Client{Transport: transport}, transport
+}
+
+// requireAuth answers 401 to requests without alice's credentials
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func multistatus(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><multistatus xmlns="DAV:">%s</multistatus>`, body)
+}
+
+func principalResponse(w http.ResponseWriter, href string) {
+	multistatus(w, `<response><href>/</href><propstat><prop><current-user-principal><href>`+href+
+		`</href></current-user-principal></prop><status>HTTP/1.1 200 OK</status></propstat></response>`)
+}
+
+func homeSetResponse(w http.ResponseWriter, principal string, home string) {
+	multistatus(w, `<response><href>`+principal+`</href><propstat><prop><calendar-home-set xmlns="urn:ietf:params:xml:ns:caldav"><href xmlns="DAV:">`+
+		home+`</href></calendar-home-set></prop><status>HTTP/1.1 200 OK</status></propstat></response>`)
+}
+
+// principalHandler answers principal and home set requests
+func principalHandler(home func() string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Method != "PROPFIND":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case strings.Contains(string(body), "current-user-principal"):
+			principalResponse(w, "/principals/alice/")
+		case strings.Contains(string(body), "calendar-home-set") && r.URL.Path == "/principals/alice/":
+			homeSetResponse(w, r.URL.Path, home())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestCredentialsForDiscoveredHomeSet(t *testing.T) {
+	calendars, err := os.ReadFile("testdata/icloud/calendars.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hosts *testHosts
+	hosts = newTestHosts(t, map[string]http.Handler{
+		"caldav.icloud.test": requireAuth(principalHandler(func() string {
+			return hosts.url("p42-caldav.icloud.test") + "/123456789/calendars/"
+		})),
+		"p42-caldav.icloud.test": requireAuth(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "PROPFIND" || r.URL.Path != "/123456789/calendars/" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.WriteHeader(http.StatusMultiStatus)
+			w.Write(calendars)
+		}),
+		"elsewhere.test": requireAuth(func(w http.ResponseWriter, r *http.Request) {}),
+	})
+
+	client, transport := hosts.client(t, hosts.url("caldav.icloud.test"))
+	cd, err := connect(context.Background(), client, transport, hosts.url("caldav.icloud.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := hosts.url("p42-caldav.icloud.test") + "/123456789/calendars/"; cd.BaseURL != want {
+		t.Errorf("BaseURL = %q, want %q", cd.BaseURL, want)
+	}
+	calendarList, err := cd.ListCalendars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calendarList) == 0 {
+		t.Error("no calendars listed from the discovered home set")
+	}
+
+	resp, err := client.Get(hosts.url("elsewhere.test") + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status from another host = %d, want credentials left off", resp.StatusCode)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value   string
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{value: "", attempt: 0, min: time.Second, max: 1500 * time.Millisecond},
+		{value: "", attempt: 2, min: 4 * time.Second, max: 6 * time.Second},
+		{value: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{value: "0", min: 0, max: 0},
+		{value: "-3", min: 0, max: 0},
+		{value: "600", min: maxRetryWait, max: maxRetryWait},
+		{value: time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat), min: 28 * time.Second, max: 30 * time.Second},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), min: 0, max: 0},
+		{value: "soon", attempt: 0, min: time.Second, max: 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.value != "" {
+			resp.Header.Set("Retry-After", tt.value)
+		}
+		got := retryAfter(resp, tt.attempt)
+		if got < tt.min || got > tt.max {
+			t.Errorf("retryAfter(%q, %d) = %v, want between %v and %v", tt.value, tt.attempt, got, tt.min, tt.max)
+		}
+	}
+}
+
+// statusSequence answers requests with the given status codes in turn and
+// keeps the bodies it was sent. Status 0 fails with a network error.
+type statusSequence struct {
+	statuses     []int
+	noRetryAfter bool
+	bodies       []string
+}
+
+func (s *statusSequence) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}
+	s.bodies = append(s.bodies, body)
+	status := s.statuses[min(len(s.bodies)-1, len(s.statuses)-1)]
+	if status == 0 {
+		return nil, errors.New("connection reset by peer")
+	}
+	header := http.Header{}
+	if !s.noRetryAfter {
+		header.Set("Retry-After", "0")
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		header       map[string]string
+		statuses     []int
+		noRetryAfter bool
+		retries      int
+		want         int
+		attempts     int
+	}{
+		{name: "success", statuses: []int{200}, retries: 3, want: 200, attempts: 1},
+		{name: "retried until success", statuses: []int{503, 429, 207}, retries: 3, want: 207, attempts: 3},
+		{name: "gives up after retries", statuses: []int{502}, retries: 2, want: 502, attempts: 3},
+		{name: "client errors aren't retried", statuses: []int{404}, retries: 3, want: 404, attempts: 1},
+		{name: "retries turned off", statuses: []int{503, 200}, retries: 0, want: 503, attempts: 1},
+		{name: "network error", statuses: []int{0, 207}, retries: 3, want: 207, attempts: 2},
+		{name: "report after a 500", method: "REPORT", statuses: []int{500, 207}, retries: 3, want: 207, attempts: 2},
+		{name: "move after a 502", method: "MOVE", statuses: []int{502, 201}, retries: 3, want: 502, attempts: 1},
+		{name: "move after a network error", method: "MOVE", statuses: []int{0, 201}, retries: 3, want: 0, attempts: 1},
+		{name: "move after a 429", method: "MOVE", statuses: []int{429, 201}, retries: 3, want: 201, attempts: 2},
+		{name: "move after a 503 with retry-after", method: "MOVE", statuses: []int{503, 201}, retries: 3, want: 201, attempts: 2},
+		{name: "move after a 503 without retry-after", method: "MOVE", statuses: []int{503, 201}, noRetryAfter: true, retries: 3, want: 503, attempts: 1},
+		{name: "mkcalendar after a 500", method: "MKCALENDAR", statuses: []int{500, 201}, retries: 3, want: 500, attempts: 1},
+		{name: "delete after a 500", method: "DELETE", statuses: []int{500, 204}, retries: 3, want: 500, attempts: 1},
+		{name: "unconditional put after a 500", method: "PUT", statuses: []int{500, 204}, retries: 3, want: 500, attempts: 1},
+		{name: "put with if-match after a 500", method: "PUT", header: map[string]string{"If-Match": `"1"`}, statuses: []int{500, 204}, retries: 3, want: 204, attempts: 2},
+		{name: "put with if-none-match after a network error", method: "PUT", header: map[string]string{"If-None-Match": "*"}, statuses: []int{0, 201}, retries: 3, want: 201, attempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := &statusSequence{statuses: tt.statuses, noRetryAfter: tt.noRetryAfter}
+			transport := &retryTransport{Base: base, Retries: tt.retries, Timeout: time.Second}
+			method := tt.method
+			if method == "" {
+				method = "PROPFIND"
+			}
+			req, _ := http.NewRequest(method, "https://dav.example.com/", strings.NewReader("<propfind/>"))
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if tt.want == 0 {
+				if err == nil {
+					t.Fatal("expected the network error")
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tt.want {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+				}
+			}
+			if len(base.bodies) != tt.attempts {
+				t.Errorf("attempts = %d, want %d", len(base.bodies), tt.attempts)
+			}
+			for _, body := range base.bodies {
+				if body != "<propfind/>" {
+					t.Errorf("body = %q, want it sent again with every attempt", body)
+				}
+			}
+		})
+	}
+}
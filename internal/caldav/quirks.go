@@ -0,0 +1,177 @@
+package caldav
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-ical"
+	"github.com/spf13/viper"
+)
+
+// Quirks are the ways a server differs from what the rest of the client
+// expects
+type Quirks struct {
+	Name string
+	// MoveByRecreate moves items between calendars by deleting and
+	// creating them, for servers without a working MOVE. Other servers
+	// fall back to it when they don't implement MOVE.
+	MoveByRecreate bool
+	// SeparateComponents is set for servers that keep todos and events in
+	// different calendars. Calendars without VTODO are left alone and new
+	// calendars only accept VTODO.
+	SeparateComponents bool
+	// NoComponentSet leaves supported-calendar-component-set out of
+	// MKCALENDAR, for servers that reject it
+	NoComponentSet bool
+	// SplitCategories writes one CATEGORIES property per category instead
+	// of a comma separated list
+	SplitCategories bool
+	// RewritesLastModified is set for servers that set LAST-MODIFIED
+	// themselves, items are read back after saving them
+	RewritesLastModified bool
+}
+
+// profiles are the known servers, selected with the server key
+var profiles = map[string]Quirks{
+	"generic": {Name: "generic"},
+	"icloud": {
+		Name:                 "icloud",
+		MoveByRecreate:       true,
+		SeparateComponents:   true,
+		RewritesLastModified: true,
+	},
+	"fastmail": {
+		Name:            "fastmail",
+		MoveByRecreate:  true,
+		SplitCategories: true,
+	},
+	// Nextcloud, Radicale and Baikal need no quirks, they are named so
+	// they can be set and reported
+	"nextcloud": {Name: "nextcloud"},
+	"radicale":  {Name: "radicale"},
+	"baikal":    {Name: "baikal"},
+}
+
+// ProfileNames returns the names the server key accepts
+func ProfileNames() []string {
+	names := []string{"auto"}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names[1:])
+	return names
+}
+
+// quirks returns the profile set with the server key, or the one detected
+// from the calendar home set when it is "auto" or empty
+func (cd *CalDavService) quirks() (Quirks, error) {
+	name := strings.ToLower(viper.GetString("server"))
+	if name != "" && name != "auto" {
+		q, exists := profiles[name]
+		if !exists {
+			return Quirks{}, fmt.Errorf("Unknown server %q, use one of %s", name, strings.Join(ProfileNames(), ", "))
+		}
+		return q, nil
+	}
+
+	u, err := url.Parse(cd.BaseURL)
+	if err != nil {
+		return Quirks{}, fmt.Errorf("While detecting server: %w", err)
+	}
+	var header http.Header
+	if detectServer(u, nil) == "generic" {
+		// Self-hosted servers can only be told apart by their answer
+		if header, err = cd.options(); err != nil {
+			slog.Debug("Couldn't ask the server what it is", "err", err)
+		}
+	}
+	q := profiles[detectServer(u, header)]
+	slog.Debug("Detected server", "server", q.Name)
+	return q, nil
+}
+
+// detectServer guesses the server from its host, or from the Server and DAV
+// headers of its answer to OPTIONS
+func detectServer(u *url.URL, header http.Header) string {
+	host := strings.ToLower(u.Hostname())
+	software := strings.ToLower(header.Get("Server"))
+	switch {
+	case hostIn(host, "icloud.com") || strings.Contains(software, "applehttpserver"):
+		return "icloud"
+	case hostIn(host, "fastmail.com", "messagingengine.com"):
+		return "fastmail"
+	case davCapability(header, "nc-", "oc-") || strings.Contains(software, "nextcloud"):
+		return "nextcloud"
+	case strings.Contains(software, "radicale"):
+		return "radicale"
+	case strings.Contains(software, "baikal") || strings.Contains(software, "baïkal"):
+		return "baikal"
+	default:
+		return "generic"
+	}
+}
+
+// davCapability reports whether a DAV header lists a capability starting
+// with one of prefixes
+func davCapability(header http.Header, prefixes ...string) bool {
+	for _, value := range header.Values("DAV") {
+		for _, capability := range strings.Split(value, ",") {
+			capability = strings.ToLower(strings.TrimSpace(capability))
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(capability, prefix) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hostIn reports whether host is one of domains or a subdomain of one
+func hostIn(host string, domains ...string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// encode returns the calendar as the server wants it, the calendar passed
+// in is left alone
+func (q Quirks) encode(data *ical.Calendar) *ical.Calendar {
+	if !q.SplitCategories {
+		return data
+	}
+
+	cal := ical.NewCalendar()
+	cal.Props = data.Props
+	for _, child := range data.Children {
+		comp := *child
+		comp.Props = ical.Props{}
+		for name, props := range child.Props {
+			if name != ical.PropCategories {
+				comp.Props[name] = props
+				continue
+			}
+			for _, prop := range props {
+				categories, err := prop.TextList()
+				if err != nil {
+					comp.Props.Add(&prop)
+					continue
+				}
+				for _, category := range categories {
+					split := ical.NewProp(ical.PropCategories)
+					split.SetText(category)
+					comp.Props.Add(split)
+				}
+			}
+		}
+		cal.Children = append(cal.Children, &comp)
+	}
+	return cal
+}
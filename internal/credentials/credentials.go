@@ -0,0 +1,113 @@
+// Package credentials finds the username and password for the server, so
+// the password doesn't have to sit in plain text in .env. Every secret it
+// finds is redacted from the logs.
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/karsai5/tw-caldav/internal/utils/origin"
+
+	"github.com/spf13/viper"
+)
+
+// Get returns the username and password, from the first source that has
+// a password:
+//
+//   - the pass key, from .env, a flag or the environment
+//   - the output of pass_command, such as "pass show caldav"
+//   - the encrypted credentials_file
+//   - the entry for the server's host in ~/.netrc
+//
+// The user key is used for the username when set.
+func Get() (username string, password string, err error) {
+	username = viper.GetString("user")
+	defer func() {
+		Register(password)
+		if username != "" && password != "" {
+			Register(basicAuth(username, password))
+		}
+	}()
+
+	if password = viper.GetString("pass"); password != "" {
+		return username, password, nil
+	}
+
+	if command := viper.GetString("pass_command"); command != "" {
+		password, err = runPassCommand(command)
+		return username, password, err
+	}
+
+	file, err := credentialsFile()
+	if err != nil {
+		return username, "", err
+	}
+	if _, statErr := os.Stat(file); statErr == nil {
+		creds, err := readCredentialsFile(file)
+		if err != nil {
+			return username, "", err
+		}
+		if username == "" {
+			username = creds.Username
+		}
+		return username, creds.Password, nil
+	}
+
+	host := ""
+	if u, err := origin.Parse(viper.GetString("url")); err == nil {
+		host = u.Hostname()
+	}
+	login, password, err := fromNetrc(host, username)
+	if err != nil {
+		return username, "", err
+	}
+	if username == "" {
+		username = login
+	}
+	return username, password, nil
+}
+
+// runPassCommand runs a command with the shell and returns the first line
+// of its output, the way pass and secret-tool print passwords
+func runPassCommand(command string) (string, error) {
+	slog.Debug("Running pass_command")
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("While running pass_command: %w", err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	password := strings.TrimRight(line, "\r")
+	if password == "" {
+		return "", fmt.Errorf("pass_command didn't print a password")
+	}
+	return password, nil
+}
+
+// readSecret asks for a secret on the terminal without echoing it
+func readSecret(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("While reading %s: %w", strings.TrimSuffix(strings.ToLower(prompt), ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,176 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/karsai5/tw-caldav/internal/state"
+
+	"github.com/spf13/viper"
+)
+
+// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600_000
+
+// Credentials are kept in the encrypted credentials file
+type Credentials struct {
+	Username string `json:"user,omitempty"`
+	Password string `json:"pass"`
+}
+
+// encryptedFile is the format of the credentials file. The credentials are
+// encrypted with AES-256-GCM, the key is derived from the passphrase.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// credentialsFile returns the path of the encrypted credentials file,
+// configured with credentials_file. Defaults to credentials.enc in the
+// state directory.
+func credentialsFile() (string, error) {
+	if file := viper.GetString("credentials_file"); file != "" {
+		return file, nil
+	}
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "credentials.enc"), nil
+}
+
+// passphrase returns the credentials_passphrase key, or asks for it
+func passphrase(prompt string) (string, error) {
+	if p := viper.GetString("credentials_passphrase"); p != "" {
+		Register(p)
+		return p, nil
+	}
+	p, err := readSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("No passphrase given")
+	}
+	Register(p)
+	return p, nil
+}
+
+func readCredentialsFile(file string) (Credentials, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("While reading credentials file: %w", err)
+	}
+	enc := encryptedFile{}
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return Credentials{}, fmt.Errorf("While parsing credentials file: %w", err)
+	}
+	if enc.Version != 1 {
+		return Credentials{}, fmt.Errorf("Unsupported credentials file version %d", enc.Version)
+	}
+
+	p, err := passphrase("Passphrase for " + file + ": ")
+	if err != nil {
+		return Credentials{}, err
+	}
+	gcm, err := newGCM(p, enc.Salt, enc.Iterations)
+	if err != nil {
+		return Credentials{}, err
+	}
+	plain, err := gcm.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("Wrong passphrase for credentials file")
+	}
+
+	creds := Credentials{}
+	if err := json.Unmarshal(plain, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("While parsing credentials: %w", err)
+	}
+	Register(creds.Password)
+	return creds, nil
+}
+
+// Save encrypts the credentials into the credentials file, asking for the
+// passphrase to encrypt them with
+func Save(creds Credentials) (string, error) {
+	file, err := credentialsFile()
+	if err != nil {
+		return "", err
+	}
+	p, err := passphrase("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if viper.GetString("credentials_passphrase") == "" {
+		again, err := readSecret("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", fmt.Errorf("Passphrases don't match")
+		}
+	}
+
+	plain, err := json.Marshal(creds)
+	if err != nil {
+		return "", err
+	}
+	enc := encryptedFile{
+		Version:    1,
+		Iterations: pbkdf2Iterations,
+		Salt:       make([]byte, 16),
+	}
+	rand.Read(enc.Salt)
+	gcm, err := newGCM(p, enc.Salt, enc.Iterations)
+	if err != nil {
+		return "", err
+	}
+	enc.Nonce = make([]byte, gcm.NonceSize())
+	rand.Read(enc.Nonce)
+	enc.Data = gcm.Seal(nil, enc.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(enc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return "", fmt.Errorf("While saving credentials file: %w", err)
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("While saving credentials file: %w", err)
+	}
+	return file, os.Rename(tmp, file)
+}
+
+// PromptPassword asks for a password on the terminal
+func PromptPassword() (string, error) {
+	p, err := readSecret("Password: ")
+	if err != nil {
+		return "", err
+	}
+	Register(p)
+	return p, nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("While deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
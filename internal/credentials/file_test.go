@@ -0,0 +1,116 @@
+package credentials
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setConfig sets viper keys for the duration of a test
+func setConfig(t *testing.T, config map[string]string) {
+	t.Helper()
+	for key, value := range config {
+		viper.Set(key, value)
+	}
+	t.Cleanup(func() {
+		for key := range config {
+			viper.Set(key, "")
+		}
+	})
+}
+
+func TestCredentialsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials.enc")
+	setConfig(t, map[string]string{"credentials_file": file, "credentials_passphrase": "correct horse"})
+
+	saved, err := Save(Credentials{Username: "alice", Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != file {
+		t.Errorf("saved to %s, want %s", saved, file)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(file)
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "alice") {
+		t.Error("credentials are stored in plain text")
+	}
+
+	creds, err := readCredentialsFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds != (Credentials{Username: "alice", Password: "s3cret"}) {
+		t.Errorf("read %+v", creds)
+	}
+
+	viper.Set("credentials_passphrase", "wrong")
+	if _, err := readCredentialsFile(file); err == nil {
+		t.Error("read with the wrong passphrase")
+	}
+
+	enc := encryptedFile{}
+	json.Unmarshal(data, &enc)
+	enc.Version = 2
+	data, _ = json.Marshal(enc)
+	os.WriteFile(file, data, 0o600)
+	if _, err := readCredentialsFile(file); err == nil {
+		t.Error("read an unsupported version")
+	}
+}
+
+func TestGet(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "credentials.enc")
+	netrcFile := filepath.Join(dir, "netrc")
+	os.WriteFile(netrcFile, []byte("machine dav.example.com login carol password from-netrc\nmachine example.com login dave password from-netrc-domain\n"), 0o600)
+	t.Setenv("NETRC", netrcFile)
+
+	setConfig(t, map[string]string{"credentials_file": file, "credentials_passphrase": "correct horse"})
+	if _, err := Save(Credentials{Username: "bob", Password: "from-file"}); err != nil {
+		t.Fatal(err)
+	}
+	noFile := filepath.Join(dir, "missing.enc")
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		wantUser string
+		wantPass string
+	}{
+		{"pass key", map[string]string{"user": "alice", "pass": "from-env", "pass_command": "echo from-command"}, "alice", "from-env"},
+		{"pass command", map[string]string{"user": "alice", "pass_command": "printf 'from-command\\nignored'"}, "alice", "from-command"},
+		{"credentials file", map[string]string{"url": "https://dav.example.com/"}, "bob", "from-file"},
+		{"user key wins over the file", map[string]string{"user": "alice"}, "alice", "from-file"},
+		{"netrc", map[string]string{"url": "https://dav.example.com/", "credentials_file": noFile}, "carol", "from-netrc"},
+		{"netrc for a hostname", map[string]string{"url": "dav.example.com", "credentials_file": noFile}, "carol", "from-netrc"},
+		{"netrc for an email address", map[string]string{"url": "user@example.com", "credentials_file": noFile}, "dave", "from-netrc-domain"},
+		{"nothing found", map[string]string{"url": "https://other.test/", "credentials_file": noFile}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, tt.config)
+			if _, overridden := tt.config["credentials_file"]; overridden {
+				t.Cleanup(func() { viper.Set("credentials_file", file) })
+			}
+
+			user, pass, err := Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("Get() = %q, %q, want %q, %q", user, pass, tt.wantUser, tt.wantPass)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrcPath returns $NETRC, or ~/.netrc
+func netrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("While finding home directory: %w", err)
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// fromNetrc returns the login and password of the first netrc entry for
+// the host, and for the login when one is given. The default entry is used
+// when no machine matches. A missing netrc file has no credentials.
+func fromNetrc(host string, login string) (string, string, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return "", "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("While reading netrc: %w", err)
+	}
+
+	for _, entry := range parseNetrc(string(data)) {
+		if entry.machine != host && !entry.isDefault {
+			continue
+		}
+		if login != "" && entry.login != "" && entry.login != login {
+			continue
+		}
+		return entry.login, entry.password, nil
+	}
+	return "", "", nil
+}
+
+type netrcEntry struct {
+	machine   string
+	isDefault bool
+	login     string
+	password  string
+}
+
+// parseNetrc reads the machine, default, login and password tokens of a
+// netrc file. Macros are skipped.
+func parseNetrc(data string) []netrcEntry {
+	entries := []netrcEntry{}
+	var current *netrcEntry
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for j := 0; j < len(fields); j++ {
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				current = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{isDefault: true})
+				current = &entries[len(entries)-1]
+			case "login":
+				if current != nil {
+					current.login = next()
+				}
+			case "password":
+				if current != nil {
+					current.password = next()
+				}
+			case "account":
+				next()
+			case "macdef":
+				// A macro runs until the next empty line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return entries
+}
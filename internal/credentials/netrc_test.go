@@ -0,0 +1,68 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const netrc = `# work
+machine dav.example.com login alice password secret1
+machine dav.example.com
+  login bob
+  password secret2
+
+macdef init
+machine evil.test login mallory password macro
+
+machine other.test login carol account x password secret3
+default login anonymous password guest
+`
+
+func TestParseNetrc(t *testing.T) {
+	want := []netrcEntry{
+		{machine: "dav.example.com", login: "alice", password: "secret1"},
+		{machine: "dav.example.com", login: "bob", password: "secret2"},
+		{machine: "other.test", login: "carol", password: "secret3"},
+		{isDefault: true, login: "anonymous", password: "guest"},
+	}
+	if got := parseNetrc(netrc); !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFromNetrc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(netrc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+
+	tests := []struct {
+		host      string
+		login     string
+		wantLogin string
+		wantPass  string
+	}{
+		{"dav.example.com", "", "alice", "secret1"},
+		{"dav.example.com", "bob", "bob", "secret2"},
+		{"other.test", "", "carol", "secret3"},
+		{"unknown.test", "", "anonymous", "guest"},
+		{"evil.test", "", "anonymous", "guest"},
+	}
+	for _, tt := range tests {
+		login, pass, err := fromNetrc(tt.host, tt.login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if login != tt.wantLogin || pass != tt.wantPass {
+			t.Errorf("fromNetrc(%q, %q) = %q, %q, want %q, %q", tt.host, tt.login, login, pass, tt.wantLogin, tt.wantPass)
+		}
+	}
+
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "missing"))
+	if login, pass, err := fromNetrc("dav.example.com", ""); err != nil || login != "" || pass != "" {
+		t.Errorf("missing netrc = %q, %q, %v", login, pass, err)
+	}
+}
@@ -0,0 +1,436 @@
+// Package icsfile stores todos in a single .ics file. Each calendar is a
+// VCALENDAR in the file named with X-WR-CALNAME, a VCALENDAR without a
+// name is the default calendar. A VCALENDAR can't be empty, so calendars
+// are only written to the file while they hold items.
+package icsfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+
+	"github.com/emersion/go-ical"
+)
+
+func NewService(file string) (*Service, error) {
+	if rest, found := strings.CutPrefix(file, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Join(home, rest)
+	}
+	if file == "" {
+		return nil, fmt.Errorf("No ics file configured")
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, fmt.Errorf("While creating directory for ics file: %w", err)
+	}
+	return &Service{File: file}, nil
+}
+
+// Service reads and writes todos in a single .ics file. The whole file is
+// read and written for every change. Calendars have the path
+// "<name>/" and items "<name>/<uid>". A renamed calendar keeps the path of
+// its first name in X-WR-RELCALID.
+type Service struct {
+	File string
+}
+
+var _ remote.Backend = &Service{}
+
+func (s *Service) load() ([]*ical.Calendar, error) {
+	data, err := os.ReadFile(s.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*ical.Calendar{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("While reading ics file: %w", err)
+	}
+
+	calendars := []*ical.Calendar{}
+	decoder := ical.NewDecoder(bytes.NewReader(data))
+	for {
+		cal, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("While parsing ics file: %w", err)
+		}
+		calendars = append(calendars, cal)
+	}
+	return calendars, nil
+}
+
+func (s *Service) save(calendars []*ical.Calendar) error {
+	buf := new(bytes.Buffer)
+	encoder := ical.NewEncoder(buf)
+	for _, cal := range calendars {
+		if len(cal.Children) == 0 {
+			continue
+		}
+		if err := encoder.Encode(cal); err != nil {
+			return fmt.Errorf("While encoding ics file: %w", err)
+		}
+	}
+	slog.Debug("Writing ics file", "file", s.File)
+
+	tmp := s.File + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("While writing ics file: %w", err)
+	}
+	return os.Rename(tmp, s.File)
+}
+
+const (
+	propCalendarID    = "X-WR-RELCALID"
+	propCalendarColor = "X-APPLE-CALENDAR-COLOR"
+)
+
+func calendarPath(name string) string {
+	return url.PathEscape(name) + "/"
+}
+
+// calendarID returns the name the path of a calendar is made from
+func calendarID(cal *ical.Calendar) string {
+	if prop := cal.Props.Get(propCalendarID); prop != nil && prop.Value != "" {
+		return prop.Value
+	}
+	return remote.CalendarName(cal)
+}
+
+func toCalendar(cal *ical.Calendar) remote.Calendar {
+	color := ""
+	if prop := cal.Props.Get(propCalendarColor); prop != nil {
+		color = prop.Value
+	}
+	return remote.Calendar{
+		Path:       calendarPath(calendarID(cal)),
+		Name:       remote.CalendarName(cal),
+		Components: []string{ical.CompToDo},
+		Color:      color,
+	}
+}
+
+func findCalendar(calendars []*ical.Calendar, calPath string) (*ical.Calendar, error) {
+	for _, cal := range calendars {
+		if calendarPath(calendarID(cal)) == calPath {
+			return cal, nil
+		}
+	}
+	return nil, fmt.Errorf("Calendar %s not found", calPath)
+}
+
+// findOrAddCalendar returns a calendar of the file, adding it when it
+// doesn't hold any items yet
+func findOrAddCalendar(calendars []*ical.Calendar, calPath string) ([]*ical.Calendar, *ical.Calendar, error) {
+	if cal, err := findCalendar(calendars, calPath); err == nil {
+		return calendars, cal, nil
+	}
+	name, err := url.PathUnescape(strings.TrimSuffix(calPath, "/"))
+	if err != nil || calPath != calendarPath(name) {
+		return calendars, nil, fmt.Errorf("Invalid ics file calendar path %q", calPath)
+	}
+	cal := newCalendar(name)
+	return append(calendars, cal), cal, nil
+}
+
+func newCalendar(name string) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropProductID, "-//Karsai5//tw-caldav 2025.6.7//EN")
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	if name != remote.DEFAULT_CALENDAR {
+		cal.Props.SetText(remote.PropCalendarName, name)
+	}
+	return cal
+}
+
+func splitItemPath(itemPath string) (calPath string, uid string, err error) {
+	idx := strings.LastIndex(itemPath, "/")
+	if idx == -1 {
+		return "", "", fmt.Errorf("Invalid ics file item path %q", itemPath)
+	}
+	uid, err = url.PathUnescape(itemPath[idx+1:])
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid ics file item path %q: %w", itemPath, err)
+	}
+	return itemPath[:idx+1], uid, nil
+}
+
+func todoUID(todo *ical.Component) string {
+	prop := todo.Props.Get(ical.PropUID)
+	if prop == nil {
+		return ""
+	}
+	return prop.Value
+}
+
+func findTodo(cal *ical.Calendar, uid string) int {
+	return slices.IndexFunc(cal.Children, func(child *ical.Component) bool {
+		return child.Name == ical.CompToDo && todoUID(child) == uid
+	})
+}
+
+// toItem wraps a todo in a calendar of its own, with the properties and
+// timezones of the calendar it is in
+func toItem(cal *ical.Calendar, todo *ical.Component) remote.Item {
+	data := ical.NewCalendar()
+	data.Props = cal.Props
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			data.Children = append(data.Children, child)
+		}
+	}
+	data.Children = append(data.Children, todo)
+
+	buf := new(bytes.Buffer)
+	ical.NewEncoder(buf).Encode(data)
+	hash := sha256.Sum256(buf.Bytes())
+
+	return remote.Item{
+		Path: calendarPath(calendarID(cal)) + url.PathEscape(todoUID(todo)),
+		ETag: hex.EncodeToString(hash[:16]),
+		Data: data,
+	}
+}
+
+// addTodos copies the todos and any timezones the calendar is missing
+// from data into the calendar
+func addTodos(cal *ical.Calendar, data *ical.Calendar) {
+	for _, child := range data.Children {
+		switch child.Name {
+		case ical.CompToDo:
+			cal.Children = append(cal.Children, child)
+		case ical.CompTimezone:
+			tzid := child.Props.Get(ical.PropTimezoneID)
+			if tzid == nil {
+				continue
+			}
+			exists := slices.ContainsFunc(cal.Children, func(c *ical.Component) bool {
+				other := c.Props.Get(ical.PropTimezoneID)
+				return c.Name == ical.CompTimezone && other != nil && other.Value == tzid.Value
+			})
+			if !exists {
+				cal.Children = slices.Insert(cal.Children, 0, child)
+			}
+		}
+	}
+}
+
+// ListCalendars implements remote.Backend.
+func (s *Service) ListCalendars() ([]remote.Calendar, error) {
+	calendars, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	result := []remote.Calendar{}
+	for _, cal := range calendars {
+		result = append(result, toCalendar(cal))
+	}
+	return result, nil
+}
+
+// CreateCalendar implements remote.Backend. The calendar is added to the
+// file with its first item.
+func (s *Service) CreateCalendar(name string) (remote.Calendar, error) {
+	slog.Debug("Creating calendar", "name", name)
+	return toCalendar(newCalendar(name)), nil
+}
+
+// UpdateCalendar implements remote.Backend. Calendars without items
+// aren't in the file and can't be changed.
+func (s *Service) UpdateCalendar(c remote.Calendar) error {
+	calendars, err := s.load()
+	if err != nil {
+		return err
+	}
+	cal, err := findCalendar(calendars, c.Path)
+	if err != nil {
+		return err
+	}
+	if cal.Props.Get(propCalendarID) == nil {
+		cal.Props.SetText(propCalendarID, calendarID(cal))
+	}
+	if c.Name == remote.DEFAULT_CALENDAR {
+		cal.Props.Del(remote.PropCalendarName)
+	} else {
+		cal.Props.SetText(remote.PropCalendarName, c.Name)
+	}
+	if c.Color == "" {
+		cal.Props.Del(propCalendarColor)
+	} else {
+		cal.Props.SetText(propCalendarColor, c.Color)
+	}
+	return s.save(calendars)
+}
+
+// DeleteCalendar implements remote.Backend.
+func (s *Service) DeleteCalendar(c remote.Calendar) error {
+	calendars, err := s.load()
+	if err != nil {
+		return err
+	}
+	cal, err := findCalendar(calendars, c.Path)
+	if err != nil {
+		// Calendars without items are only in memory
+		return nil
+	}
+	calendars = slices.DeleteFunc(calendars, func(other *ical.Calendar) bool {
+		return other == cal
+	})
+	return s.save(calendars)
+}
+
+// ListItems implements remote.Backend.
+func (s *Service) ListItems(c remote.Calendar) ([]remote.Item, error) {
+	calendars, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	items := []remote.Item{}
+	cal, err := findCalendar(calendars, c.Path)
+	if err != nil {
+		// The calendar has no items yet
+		return items, nil
+	}
+	for _, child := range cal.Children {
+		if child.Name != ical.CompToDo {
+			continue
+		}
+		if todoUID(child) == "" {
+			slog.Error("Cannot use todo without UID", "calendar", c.Name)
+			continue
+		}
+		items = append(items, toItem(cal, child))
+	}
+	return items, nil
+}
+
+// GetItem implements remote.Backend.
+func (s *Service) GetItem(itemPath string) (remote.Item, error) {
+	calPath, uid, err := splitItemPath(itemPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	calendars, err := s.load()
+	if err != nil {
+		return remote.Item{}, err
+	}
+	cal, err := findCalendar(calendars, calPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	idx := findTodo(cal, uid)
+	if idx < 0 {
+		return remote.Item{}, fmt.Errorf("Item %s not found", itemPath)
+	}
+	return toItem(cal, cal.Children[idx]), nil
+}
+
+// CreateItem implements remote.Backend.
+func (s *Service) CreateItem(c remote.Calendar, uid string, data *ical.Calendar) (remote.Item, error) {
+	itemPath := c.Path + url.PathEscape(uid)
+	if _, err := s.GetItem(itemPath); err == nil {
+		return remote.Item{}, fmt.Errorf("Item %s already exists", itemPath)
+	}
+	return s.UpdateItem(itemPath, data)
+}
+
+// UpdateItem implements remote.Backend.
+func (s *Service) UpdateItem(itemPath string, data *ical.Calendar) (remote.Item, error) {
+	calPath, uid, err := splitItemPath(itemPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	calendars, err := s.load()
+	if err != nil {
+		return remote.Item{}, err
+	}
+	calendars, cal, err := findOrAddCalendar(calendars, calPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+
+	if idx := findTodo(cal, uid); idx >= 0 {
+		cal.Children = slices.Delete(cal.Children, idx, idx+1)
+	}
+	addTodos(cal, data)
+
+	if err := s.save(calendars); err != nil {
+		return remote.Item{}, err
+	}
+	idx := findTodo(cal, uid)
+	if idx < 0 {
+		return remote.Item{}, fmt.Errorf("Item %s has no VTODO with UID %q", itemPath, uid)
+	}
+	return toItem(cal, cal.Children[idx]), nil
+}
+
+// MoveItem implements remote.Backend.
+func (s *Service) MoveItem(itemPath string, to remote.Calendar) (string, error) {
+	calPath, uid, err := splitItemPath(itemPath)
+	if err != nil {
+		return "", err
+	}
+	calendars, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	from, err := findCalendar(calendars, calPath)
+	if err != nil {
+		return "", err
+	}
+	calendars, target, err := findOrAddCalendar(calendars, to.Path)
+	if err != nil {
+		return "", err
+	}
+	idx := findTodo(from, uid)
+	if idx < 0 {
+		return "", fmt.Errorf("Item %s not found", itemPath)
+	}
+	if findTodo(target, uid) >= 0 {
+		return "", fmt.Errorf("Item %s already exists in %s", uid, to.Path)
+	}
+
+	addTodos(target, toItem(from, from.Children[idx]).Data)
+	from.Children = slices.Delete(from.Children, idx, idx+1)
+
+	if err := s.save(calendars); err != nil {
+		return "", err
+	}
+	return to.Path + url.PathEscape(uid), nil
+}
+
+// DeleteItem implements remote.Backend.
+func (s *Service) DeleteItem(itemPath string) error {
+	calPath, uid, err := splitItemPath(itemPath)
+	if err != nil {
+		return err
+	}
+	calendars, err := s.load()
+	if err != nil {
+		return err
+	}
+	cal, err := findCalendar(calendars, calPath)
+	if err != nil {
+		return err
+	}
+	idx := findTodo(cal, uid)
+	if idx < 0 {
+		return fmt.Errorf("Item %s not found", itemPath)
+	}
+	cal.Children = slices.Delete(cal.Children, idx, idx+1)
+	return s.save(calendars)
+}
@@ -0,0 +1,100 @@
+package local
+
+import "github.com/karsai5/tw-caldav/internal/sync/task"
+
+// Store is where local tasks live. tw.Taskwarrior is the main
+// implementation, others can be plugged into the sync process in its
+// place.
+type Store interface {
+	// GetAllTasks returns the tasks that take part in syncing
+	GetAllTasks() ([]task.Task, error)
+	GetTask(id string) (task.Task, error)
+	// AddTask creates a task and returns its id. The task's LocalId is
+	// used as the id when set.
+	AddTask(t task.Task) (id string, err error)
+	UpdateTask(id string, t task.Task) error
+	DeleteTask(id string) error
+	// ApplyChanges makes several changes at once, in a single write where
+	// the store supports it. The ids of the changed tasks are returned in
+	// the same order, including the ids of added tasks.
+	ApplyChanges(changes []Change) (ids []string, err error)
+}
+
+// RawTask is implemented by tasks that can show how the store keeps them
+type RawTask interface {
+	Raw() ([]byte, error)
+}
+
+type ChangeType int8
+
+const (
+	ChangeAdd ChangeType = iota
+	ChangeUpdate
+	ChangeDelete
+)
+
+// Change is a single change to a store. Id is ignored when adding and
+// Task is ignored when deleting.
+type Change struct {
+	Type ChangeType
+	Id   string
+	Task task.Task
+}
+
+// ApplyChangesOneByOne implements ApplyChanges for stores that can't
+// batch writes
+func ApplyChangesOneByOne(s Store, changes []Change) ([]string, error) {
+	ids := []string{}
+	for _, c := range changes {
+		switch c.Type {
+		case ChangeAdd:
+			id, err := s.AddTask(c.Task)
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, id)
+		case ChangeUpdate:
+			if err := s.UpdateTask(c.Id, c.Task); err != nil {
+				return ids, err
+			}
+			ids = append(ids, c.Id)
+		case ChangeDelete:
+			if err := s.DeleteTask(c.Id); err != nil {
+				return ids, err
+			}
+			ids = append(ids, c.Id)
+		}
+	}
+	return ids, nil
+}
+
+// ProjectRenamer is implemented by stores that can move every task of a
+// project to another project in a single write
+type ProjectRenamer interface {
+	RenameProject(from, to string) error
+}
+
+// RenameProject moves every task of a project to another project, with a
+// single write where the store supports it
+func RenameProject(s Store, from, to string) error {
+	if r, ok := s.(ProjectRenamer); ok {
+		return r.RenameProject(from, to)
+	}
+	tasks, err := s.GetAllTasks()
+	if err != nil {
+		return err
+	}
+	changes := []Change{}
+	for _, t := range tasks {
+		if t.Project() != from || t.LocalId() == nil {
+			continue
+		}
+		changes = append(changes, Change{
+			Type: ChangeUpdate,
+			Id:   *t.LocalId(),
+			Task: task.CreateShellTask(task.WithTask(t), task.WithProject(to)),
+		})
+	}
+	_, err = s.ApplyChanges(changes)
+	return err
+}
@@ -0,0 +1,130 @@
+// Package memory is a local store that only keeps tasks in memory, for
+// tests and commands that don't write to the remote.
+package memory
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	mu    sync.Mutex
+	tasks map[string]task.Internaltask
+	order []string
+}
+
+func New() *Store {
+	return &Store{tasks: map[string]task.Internaltask{}}
+}
+
+var _ local.Store = &Store{}
+
+// GetAllTasks implements local.Store.
+func (s *Store) GetAllTasks() ([]task.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := []task.Task{}
+	for _, id := range s.order {
+		if t := s.tasks[id]; t.Status != task.StatusDeleted {
+			tasks = append(tasks, s.wrap(t))
+		}
+	}
+	return tasks, nil
+}
+
+// GetTask implements local.Store.
+func (s *Store) GetTask(id string) (task.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, exists := s.tasks[id]
+	if !exists {
+		return nil, fmt.Errorf("Task %s not found", id)
+	}
+	return s.wrap(t), nil
+}
+
+// AddTask implements local.Store.
+func (s *Store) AddTask(t task.Task) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.NewString()
+	if t.LocalId() != nil {
+		id = *t.LocalId()
+	}
+	if _, exists := s.tasks[id]; exists {
+		return "", fmt.Errorf("Task %s already exists", id)
+	}
+	s.tasks[id] = s.copy(id, t)
+	s.order = append(s.order, id)
+	return id, nil
+}
+
+// UpdateTask implements local.Store.
+func (s *Store) UpdateTask(id string, t task.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.tasks[id]; !exists {
+		return fmt.Errorf("Task %s not found", id)
+	}
+	s.tasks[id] = s.copy(id, t)
+	return nil
+}
+
+// DeleteTask implements local.Store.
+func (s *Store) DeleteTask(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, exists := s.tasks[id]
+	if !exists {
+		return fmt.Errorf("Task %s not found", id)
+	}
+	now := time.Now()
+	t.Status = task.StatusDeleted
+	t.LastModified = now
+	t.Completed = &now
+	s.tasks[id] = t
+	return nil
+}
+
+// ApplyChanges implements local.Store.
+func (s *Store) ApplyChanges(changes []local.Change) ([]string, error) {
+	return local.ApplyChangesOneByOne(s, changes)
+}
+
+func (s *Store) copy(id string, t task.Task) task.Internaltask {
+	shell := task.CreateShellTask(task.WithTask(t), task.WithLocalId(id))
+	copied := *shell.Task
+	copied.Tags = slices.Clone(copied.Tags)
+	copied.Alarms = slices.Clone(copied.Alarms)
+	copied.UDAs = maps.Clone(copied.UDAs)
+	copied.LastModified = time.Now()
+	return copied
+}
+
+func (s *Store) wrap(t task.Internaltask) task.Task {
+	return &storedTask{ShellTask: task.ShellTask{Task: &t}, store: s}
+}
+
+// storedTask is a task of the store that can update and delete itself
+type storedTask struct {
+	task.ShellTask
+	store *Store
+}
+
+// Update implements task.Task.
+func (t *storedTask) Update(u task.Task) (task.Task, error) {
+	return u, t.store.UpdateTask(*t.LocalId(), u)
+}
+
+// Delete implements task.Task.
+func (t *storedTask) Delete() error {
+	return t.store.DeleteTask(*t.LocalId())
+}
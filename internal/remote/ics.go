@@ -0,0 +1,104 @@
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+)
+
+// PropCalendarName names the calendar a VCALENDAR holds when it isn't
+// stored in a collection, such as in a plain .ics file
+const PropCalendarName = "X-WR-CALNAME"
+
+// CalendarName returns the X-WR-CALNAME of a calendar, or the default
+// calendar's name if it has none
+func CalendarName(cal *ical.Calendar) string {
+	if prop := cal.Props.Get(PropCalendarName); prop != nil {
+		if name, err := prop.Text(); err == nil && name != "" {
+			return name
+		}
+	}
+	return DEFAULT_CALENDAR
+}
+
+// ReadTodos returns the todos of every VCALENDAR in an .ics stream. The
+// todos aren't stored in a backend so they can only be read.
+func ReadTodos(r io.Reader) ([]Todo, error) {
+	todos := []Todo{}
+	decoder := ical.NewDecoder(r)
+	for {
+		data, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return todos, fmt.Errorf("While parsing ics: %w", err)
+		}
+
+		cal := Calendar{Name: CalendarName(data)}
+		timezones := []*ical.Component{}
+		for _, child := range data.Children {
+			if child.Name == ical.CompTimezone {
+				timezones = append(timezones, child)
+			}
+		}
+		for _, child := range data.Children {
+			if child.Name != ical.CompToDo {
+				continue
+			}
+			itemData := ical.NewCalendar()
+			itemData.Props = data.Props
+			itemData.Children = append(append(itemData.Children, timezones...), child)
+			todos = append(todos, Todo{
+				Calendar:      &cal,
+				Item:          &Item{Data: itemData},
+				TodoComponent: child,
+			})
+		}
+	}
+	return todos, nil
+}
+
+// WriteTodos writes tasks as a single VCALENDAR of VTODOs, mapped the same
+// way they are synced. The calendar is named after the project when all
+// tasks share one. Without tasks an empty VCALENDAR is written.
+func WriteTodos(w io.Writer, tasks []task.Task) error {
+	if len(tasks) == 0 {
+		// go-ical refuses to encode a VCALENDAR without components
+		_, err := io.WriteString(w, "BEGIN:VCALENDAR\r\nPRODID:-//Karsai5//tw-caldav 2025.6.7//EN\r\nVERSION:2.0\r\nEND:VCALENDAR\r\n")
+		return err
+	}
+
+	cal := ical.NewCalendar()
+	addStringProp(&cal.Component.Props, "PRODID", "-//Karsai5//tw-caldav 2025.6.7//EN")
+	addStringProp(&cal.Component.Props, "VERSION", "2.0")
+
+	if tasks[0].Project() != "" {
+		project := tasks[0].Project()
+		for _, t := range tasks {
+			if t.Project() != project {
+				project = ""
+				break
+			}
+		}
+		if project != "" {
+			addStringProp(&cal.Component.Props, PropCalendarName, project)
+		}
+	}
+
+	for _, t := range tasks {
+		todoCal := NewTodoCalendar(t)
+		cal.Children = append(cal.Children, todoCal.Children...)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := ical.NewEncoder(buf).Encode(cal); err != nil {
+		return fmt.Errorf("While encoding ics: %w", err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,165 @@
+package remote_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/remote/memory"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/uuid"
+)
+
+func TestLocalIdFromUID(t *testing.T) {
+	tests := []struct {
+		name string
+		uid  string
+		want string
+	}{
+		{"uuid", "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10", "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"},
+		{"upper case uuid", "0B4D4C1E-5D2A-4C7E-9A53-2F1F5B2A7C10", "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"},
+		{"urn uuid", "urn:uuid:0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10", "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"},
+		{"email style uid", "20250601T120000Z-123@example.com", uuid.NewSHA1(uuid.NameSpaceURL, []byte("20250601T120000Z-123@example.com")).String()},
+		{"uuid with a suffix", "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10@example.com", uuid.NewSHA1(uuid.NameSpaceURL, []byte("0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10@example.com")).String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := remote.LocalIdFromUID(tt.uid)
+			if got != tt.want {
+				t.Errorf("LocalIdFromUID(%q) = %q, want %q", tt.uid, got, tt.want)
+			}
+			if got != remote.LocalIdFromUID(tt.uid) {
+				t.Error("the id isn't the same every time")
+			}
+			if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("%q isn't a uuid: %v", got, err)
+			}
+		})
+	}
+
+	if remote.LocalIdFromUID("a@example.com") == remote.LocalIdFromUID("b@example.com") {
+		t.Error("ids derived from different UIDs are equal")
+	}
+}
+
+// legacyItem returns a todo as older versions and other clients wrote it,
+// props maps property names to values
+func legacyItem(props map[string]string) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//test//EN")
+	todo := ical.NewComponent(ical.CompToDo)
+	todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC))
+	for name, value := range props {
+		todo.Props.SetText(name, value)
+	}
+	cal.Children = append(cal.Children, todo)
+	return cal
+}
+
+func TestMigrateIdentity(t *testing.T) {
+	const (
+		withNotes = "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"
+		onlyId    = "3f0c1d2e-8a9b-4c5d-8e7f-6a5b4c3d2e1f"
+		migrated  = "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b"
+	)
+	tests := []struct {
+		name            string
+		props           map[string]string
+		wantLegacy      bool
+		wantErr         bool
+		wantId          string
+		wantUID         string
+		wantDescription string
+	}{
+		{
+			name:            "marker after notes",
+			props:           map[string]string{"UID": "20250601T120000Z-123@example.com", "SUMMARY": "Water the plants", "DESCRIPTION": "Use the blue can\ntaskwarrior_id=" + withNotes},
+			wantLegacy:      true,
+			wantId:          withNotes,
+			wantUID:         "20250601T120000Z-123@example.com",
+			wantDescription: "Use the blue can",
+		},
+		{
+			name:       "only the marker",
+			props:      map[string]string{"UID": "ABC-123", "SUMMARY": "Buy milk", "DESCRIPTION": "taskwarrior_id=" + onlyId},
+			wantLegacy: true,
+			wantId:     onlyId,
+			wantUID:    "ABC-123",
+		},
+		{
+			name:            "already migrated",
+			props:           map[string]string{"UID": migrated, "SUMMARY": "Call mum", "DESCRIPTION": "Sunday", remote.PropTaskwarriorUUID: migrated},
+			wantId:          migrated,
+			wantUID:         migrated,
+			wantDescription: "Sunday",
+		},
+		{
+			name:    "todo from another client",
+			props:   map[string]string{"UID": "khal-todo", "SUMMARY": "Book flights"},
+			wantErr: true,
+			wantUID: "khal-todo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := memory.New()
+			s, err := remote.NewService(backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cal, err := s.FindCalendar("default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			item, err := backend.CreateItem(cal, "todo", legacyItem(tt.props))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			todos, err := s.GetAllTodos()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(todos) != 1 {
+				t.Fatalf("got %d todos", len(todos))
+			}
+			todo := todos[0]
+			if todo.HasLegacyIdentity() != tt.wantLegacy {
+				t.Errorf("HasLegacyIdentity() = %v, want %v", todo.HasLegacyIdentity(), tt.wantLegacy)
+			}
+			if err := todo.MigrateIdentity(); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			saved, err := backend.GetItem(item.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read, err := s.NewTodo(cal, saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read.HasLegacyIdentity() {
+				t.Error("marker is still in the description")
+			}
+			if got := read.GetStringProp(remote.PropTaskwarriorUUID); got != tt.wantId {
+				t.Errorf("%s = %q, want %q", remote.PropTaskwarriorUUID, got, tt.wantId)
+			}
+			if tt.wantId != "" && (read.LocalId() == nil || *read.LocalId() != tt.wantId) {
+				t.Errorf("LocalId() = %v, want %s", read.LocalId(), tt.wantId)
+			}
+			if read.UID() != tt.wantUID {
+				t.Errorf("UID = %q, want %q", read.UID(), tt.wantUID)
+			}
+			if got := read.GetStringProp("DESCRIPTION"); got != tt.wantDescription {
+				t.Errorf("DESCRIPTION = %q, want %q", got, tt.wantDescription)
+			}
+			if read.Description() != tt.props["SUMMARY"] {
+				t.Errorf("SUMMARY = %q, want it kept", read.Description())
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package remote
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tw-caldav-state")
+	if err != nil {
+		panic(err)
+	}
+	viper.Set("state_dir", dir)
+	viper.Set("tag_aliases", "Work Stuff:work")
+	viper.Set("timezone", "Australia/Sydney")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,186 @@
+// Package memory is a remote backend that only keeps items in memory. It
+// stands in for a server when trying out the sync process.
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+
+	"github.com/emersion/go-ical"
+)
+
+type Backend struct {
+	mu        sync.Mutex
+	calendars []remote.Calendar
+	items     map[string]remote.Item
+}
+
+func New() *Backend {
+	return &Backend{
+		items: map[string]remote.Item{},
+	}
+}
+
+var _ remote.Backend = &Backend{}
+
+// ListCalendars implements remote.Backend.
+func (b *Backend) ListCalendars() ([]remote.Calendar, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]remote.Calendar{}, b.calendars...), nil
+}
+
+// CreateCalendar implements remote.Backend.
+func (b *Backend) CreateCalendar(name string) (remote.Calendar, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cal := remote.Calendar{
+		Path:       fmt.Sprintf("/calendars/%d/", len(b.calendars)+1),
+		Name:       name,
+		Components: []string{ical.CompToDo},
+	}
+	b.calendars = append(b.calendars, cal)
+	return cal, nil
+}
+
+// UpdateCalendar implements remote.Backend.
+func (b *Backend) UpdateCalendar(cal remote.Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, c := range b.calendars {
+		if c.Path == cal.Path {
+			b.calendars[i].Name = cal.Name
+			b.calendars[i].Color = cal.Color
+			return nil
+		}
+	}
+	return fmt.Errorf("Calendar %s not found", cal.Path)
+}
+
+// DeleteCalendar implements remote.Backend.
+func (b *Backend) DeleteCalendar(cal remote.Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := slices.IndexFunc(b.calendars, func(c remote.Calendar) bool {
+		return c.Path == cal.Path
+	})
+	if i < 0 {
+		return fmt.Errorf("Calendar %s not found", cal.Path)
+	}
+	b.calendars = slices.Delete(b.calendars, i, i+1)
+	for itemPath := range b.items {
+		if strings.HasPrefix(itemPath, cal.Path) {
+			delete(b.items, itemPath)
+		}
+	}
+	return nil
+}
+
+// ListItems implements remote.Backend.
+func (b *Backend) ListItems(cal remote.Calendar) ([]remote.Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	items := []remote.Item{}
+	for itemPath, item := range b.items {
+		if strings.HasPrefix(itemPath, cal.Path) {
+			items = append(items, copyItem(item))
+		}
+	}
+	return items, nil
+}
+
+// GetItem implements remote.Backend.
+func (b *Backend) GetItem(itemPath string) (remote.Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, exists := b.items[itemPath]
+	if !exists {
+		return remote.Item{}, fmt.Errorf("Item %s not found", itemPath)
+	}
+	return copyItem(item), nil
+}
+
+// CreateItem implements remote.Backend.
+func (b *Backend) CreateItem(cal remote.Calendar, uid string, data *ical.Calendar) (remote.Item, error) {
+	itemPath := cal.Path + uid + ".ics"
+	b.mu.Lock()
+	_, exists := b.items[itemPath]
+	b.mu.Unlock()
+	if exists {
+		return remote.Item{}, fmt.Errorf("Item %s already exists", itemPath)
+	}
+	return b.UpdateItem(itemPath, data)
+}
+
+// UpdateItem implements remote.Backend.
+func (b *Backend) UpdateItem(itemPath string, data *ical.Calendar) (remote.Item, error) {
+	buf := new(bytes.Buffer)
+	if err := ical.NewEncoder(buf).Encode(data); err != nil {
+		return remote.Item{}, fmt.Errorf("While encoding item: %w", err)
+	}
+	hash := sha256.Sum256(buf.Bytes())
+	item := remote.Item{
+		Path:    itemPath,
+		ETag:    hex.EncodeToString(hash[:16]),
+		ModTime: time.Now(),
+		Data:    data,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items[itemPath] = copyItem(item)
+	return item, nil
+}
+
+// MoveItem implements remote.Backend.
+func (b *Backend) MoveItem(itemPath string, to remote.Calendar) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	item, exists := b.items[itemPath]
+	if !exists {
+		return "", fmt.Errorf("Item %s not found", itemPath)
+	}
+	newPath := to.Path + path.Base(itemPath)
+	if _, exists := b.items[newPath]; exists {
+		return "", fmt.Errorf("Item %s already exists", newPath)
+	}
+	delete(b.items, itemPath)
+	item.Path = newPath
+	b.items[newPath] = item
+	return newPath, nil
+}
+
+// DeleteItem implements remote.Backend.
+func (b *Backend) DeleteItem(itemPath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, exists := b.items[itemPath]; !exists {
+		return fmt.Errorf("Item %s not found", itemPath)
+	}
+	delete(b.items, itemPath)
+	return nil
+}
+
+// copyItem decodes a fresh copy of the item data, so changes made to a
+// todo only show up once they are saved
+func copyItem(item remote.Item) remote.Item {
+	buf := new(bytes.Buffer)
+	if err := ical.NewEncoder(buf).Encode(item.Data); err != nil {
+		return item
+	}
+	data, err := ical.NewDecoder(buf).Decode()
+	if err != nil {
+		return item
+	}
+	item.Data = data
+	return item
+}
@@ -0,0 +1,58 @@
+// Package remote maps tasks to VTODOs and stores them in a Backend. The
+// mapping is the same for every backend, backends only move calendar
+// objects around.
+package remote
+
+import (
+	"slices"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Calendar is a collection of items on the remote
+type Calendar struct {
+	Path string
+	Name string
+	// Components lists the components the calendar supports, empty when
+	// the backend doesn't know
+	Components []string
+	// Color is a #RRGGBB color, empty when the calendar has none
+	Color string
+	// ReadOnly is set when items can't be written to the calendar
+	ReadOnly bool
+}
+
+// SupportsTodos reports whether the calendar can hold VTODOs
+func (c Calendar) SupportsTodos() bool {
+	return len(c.Components) == 0 || slices.Contains(c.Components, ical.CompToDo)
+}
+
+// Item is a calendar object holding a VTODO
+type Item struct {
+	Path    string
+	ETag    string
+	ModTime time.Time
+	Data    *ical.Calendar
+}
+
+// Backend stores calendars and items. Paths are chosen by the backend
+// and are only passed back to it.
+type Backend interface {
+	ListCalendars() ([]Calendar, error)
+	CreateCalendar(name string) (Calendar, error)
+	// UpdateCalendar saves the name and color of a calendar
+	UpdateCalendar(cal Calendar) error
+	// DeleteCalendar removes a calendar and all of its items
+	DeleteCalendar(cal Calendar) error
+
+	// ListItems returns the items of a calendar that hold a VTODO
+	ListItems(cal Calendar) ([]Item, error)
+	GetItem(path string) (Item, error)
+	// CreateItem stores a new item in a calendar, uid is used to name it
+	CreateItem(cal Calendar, uid string, data *ical.Calendar) (Item, error)
+	UpdateItem(path string, data *ical.Calendar) (Item, error)
+	// MoveItem moves an item to another calendar and returns its new path
+	MoveItem(path string, to Calendar) (string, error)
+	DeleteItem(path string) error
+}
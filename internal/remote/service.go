@@ -0,0 +1,472 @@
+package remote
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/karsai5/tw-caldav/internal/state"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+)
+
+var DEFAULT_CALENDAR = "default"
+
+// CalendarMap holds calendars by path
+type CalendarMap map[string]Calendar
+
+// Service reads and writes todos through a Backend. Calendars are known by
+// their path, their name is only a label. Each project is bound to one
+// calendar, the bindings are kept in the sync state.
+type Service struct {
+	Backend   Backend
+	Calendars CalendarMap
+	// Projects binds projects to the path of their calendar, tasks without
+	// a project are bound with ""
+	Projects map[string]string
+	// readOnly keeps the service from changing the remote or the state
+	readOnly bool
+}
+
+// NewService loads the calendars of a backend and creates the default
+// calendar if it doesn't exist yet
+func NewService(backend Backend) (*Service, error) {
+	s := Service{
+		Backend:   backend,
+		Calendars: make(CalendarMap),
+		Projects:  map[string]string{},
+	}
+
+	err := s.PopulateCalendarMap()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.CreateDefaultCalendarIfDoesNotExist()
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// NewReadOnlyService loads the calendars of a backend without changing
+// anything, the default calendar isn't created and new project bindings
+// aren't saved. It is meant for looking at the remote.
+func NewReadOnlyService(backend Backend) (*Service, error) {
+	s := Service{
+		Backend:   backend,
+		Calendars: make(CalendarMap),
+		Projects:  map[string]string{},
+		readOnly:  true,
+	}
+	if err := s.PopulateCalendarMap(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Service) PopulateCalendarMap() error {
+	calendars, err := s.Backend.ListCalendars()
+	if err != nil {
+		return err
+	}
+	clear(s.Calendars)
+	for _, c := range calendars {
+		s.Calendars[c.Path] = c
+	}
+	return s.bindProjects()
+}
+
+// bindProjects binds projects to calendars. Bindings from the state are
+// kept while their calendar exists, so renaming a calendar doesn't change
+// the project of its tasks. Calendars that aren't bound yet are bound to
+// the project they are named after, unless another calendar already is.
+func (s *Service) bindProjects() error {
+	st, err := state.Get()
+	if err != nil {
+		return err
+	}
+	clear(s.Projects)
+	st.Read(func(st *state.State) {
+		for project, path := range st.Calendars {
+			if _, exists := s.Calendars[path]; exists {
+				s.Projects[project] = path
+			}
+		}
+	})
+
+	bound := map[string]bool{}
+	for _, path := range s.Projects {
+		bound[path] = true
+	}
+	for _, path := range slices.Sorted(maps.Keys(s.Calendars)) {
+		c := s.Calendars[path]
+		if bound[path] || !c.SupportsTodos() {
+			continue
+		}
+		if c.Name == "" {
+			slog.Warn("Calendar without name is not synced", "path", c.Path)
+			continue
+		}
+		project := projectOfName(c.Name)
+		if existing, exists := s.Projects[project]; exists {
+			slog.Warn("Calendar is not synced, another calendar is synced with its project", "path", c.Path, "name", c.Name, "synced", existing)
+			continue
+		}
+		s.Projects[project] = path
+	}
+	return s.saveBindings()
+}
+
+// errIfReadOnly returns an error when the service may not change the
+// remote
+func (s *Service) errIfReadOnly() error {
+	if s.readOnly {
+		return fmt.Errorf("The remote was opened read-only and can't be changed")
+	}
+	return nil
+}
+
+// saveBindings keeps the project bindings in the state
+func (s *Service) saveBindings() error {
+	if s.readOnly {
+		return nil
+	}
+	st, err := state.Get()
+	if err != nil {
+		return err
+	}
+	changed := false
+	st.Read(func(st *state.State) {
+		changed = !maps.Equal(st.Calendars, s.Projects)
+	})
+	if !changed {
+		return nil
+	}
+	return st.Update(func(st *state.State) {
+		st.Calendars = maps.Clone(s.Projects)
+	})
+}
+
+// projectOfName returns the project a calendar name stands for
+func projectOfName(name string) string {
+	if name == DEFAULT_CALENDAR {
+		return ""
+	}
+	return name
+}
+
+// nameOfProject returns the calendar name for a project
+func nameOfProject(project string) string {
+	if project == "" {
+		return DEFAULT_CALENDAR
+	}
+	return project
+}
+
+func (s *Service) CreateDefaultCalendarIfDoesNotExist() error {
+	if _, exists := s.Projects[""]; exists {
+		return nil
+	}
+
+	_, err := s.CreateCalendar(DEFAULT_CALENDAR)
+	if err != nil {
+		return err
+	}
+	slog.Info("Default calendar created remotely")
+
+	return nil
+}
+
+// FindOrCreateCalendar returns the calendar of a project, tasks without a
+// project go in the default calendar
+func (s *Service) FindOrCreateCalendar(project string) (Calendar, error) {
+	if path, exists := s.Projects[project]; exists {
+		return s.Calendars[path], nil
+	}
+	return s.CreateCalendar(nameOfProject(project))
+}
+
+// CreateCalendar creates a calendar, it is bound to the project it is
+// named after when that project has no calendar yet
+func (s *Service) CreateCalendar(name string) (Calendar, error) {
+	if err := s.errIfReadOnly(); err != nil {
+		return Calendar{}, err
+	}
+	cal, err := s.Backend.CreateCalendar(name)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("While creating calendar: %w", err)
+	}
+	s.Calendars[cal.Path] = cal
+	if _, exists := s.Projects[projectOfName(name)]; !exists {
+		s.Projects[projectOfName(name)] = cal.Path
+		if err := s.saveBindings(); err != nil {
+			return cal, err
+		}
+	}
+	return cal, nil
+}
+
+// FindCalendar returns the calendar with a path, or with a name when no
+// path matches
+func (s *Service) FindCalendar(pathOrName string) (Calendar, error) {
+	calendars, err := s.Backend.ListCalendars()
+	if err != nil {
+		return Calendar{}, err
+	}
+	for _, c := range calendars {
+		if c.Path == pathOrName {
+			return c, nil
+		}
+	}
+	found := []Calendar{}
+	for _, c := range calendars {
+		if c.Name == pathOrName {
+			found = append(found, c)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Calendar{}, fmt.Errorf("No calendar found for %q", pathOrName)
+	case 1:
+		return found[0], nil
+	default:
+		return Calendar{}, fmt.Errorf("Several calendars are named %q, use the path instead", pathOrName)
+	}
+}
+
+// ProjectOf returns the taskwarrior project synced with a calendar, and
+// whether the calendar is synced at all
+func (s *Service) ProjectOf(cal Calendar) (string, bool) {
+	for project, path := range s.Projects {
+		if path == cal.Path {
+			return project, true
+		}
+	}
+	return "", false
+}
+
+// RenamedCalendars returns the projects whose calendar has been renamed
+// since it was bound, with the project the new name stands for. The
+// default calendar and calendars renamed to it are left out.
+func (s *Service) RenamedCalendars() map[string]string {
+	renamed := map[string]string{}
+	for project, path := range s.Projects {
+		name := s.Calendars[path].Name
+		if project == "" || name == "" || projectOfName(name) == "" {
+			continue
+		}
+		if to := projectOfName(name); to != project {
+			renamed[project] = to
+		}
+	}
+	return renamed
+}
+
+// RebindProject binds the calendar of a project to another project, the
+// calendar itself is left alone
+func (s *Service) RebindProject(from, to string) error {
+	if err := s.errIfReadOnly(); err != nil {
+		return err
+	}
+	path, exists := s.Projects[from]
+	if !exists {
+		return fmt.Errorf("No calendar found for %q", from)
+	}
+	if existing, taken := s.Projects[to]; taken {
+		return fmt.Errorf("Project %q is already synced with %s", to, existing)
+	}
+	delete(s.Projects, from)
+	s.Projects[to] = path
+	return s.saveBindings()
+}
+
+// RenameProject renames the calendar of a project after another project
+// and binds it to that project, its todos stay where they are
+func (s *Service) RenameProject(from, to string) error {
+	if err := s.errIfReadOnly(); err != nil {
+		return err
+	}
+	path, exists := s.Projects[from]
+	if !exists {
+		return fmt.Errorf("No calendar found for %q", from)
+	}
+	if existing, taken := s.Projects[to]; taken {
+		return fmt.Errorf("Project %q is already synced with %s", to, existing)
+	}
+	cal := s.Calendars[path]
+	cal.Name = nameOfProject(to)
+	if err := s.Backend.UpdateCalendar(cal); err != nil {
+		return fmt.Errorf("While renaming calendar: %w", err)
+	}
+	s.Calendars[path] = cal
+	return s.RebindProject(from, to)
+}
+
+// ProjectOfItem returns the project synced with the calendar an item path
+// is in, and whether that calendar is synced
+func (s *Service) ProjectOfItem(itemPath string) (string, bool) {
+	cal, exists := s.calendarOf(itemPath)
+	if !exists {
+		return "", false
+	}
+	return s.ProjectOf(cal)
+}
+
+// calendarOf returns the calendar an item path is in
+func (s *Service) calendarOf(itemPath string) (Calendar, bool) {
+	for path, cal := range s.Calendars {
+		if strings.HasPrefix(itemPath, path) && !strings.Contains(strings.TrimPrefix(itemPath, path), "/") {
+			return cal, true
+		}
+	}
+	return Calendar{}, false
+}
+
+// UpdateCalendar saves the name and color of a calendar
+func (s *Service) UpdateCalendar(cal Calendar) error {
+	if err := s.errIfReadOnly(); err != nil {
+		return err
+	}
+	if err := s.Backend.UpdateCalendar(cal); err != nil {
+		return fmt.Errorf("While updating calendar: %w", err)
+	}
+	return s.PopulateCalendarMap()
+}
+
+// DeleteCalendar removes a calendar and all of its items
+func (s *Service) DeleteCalendar(cal Calendar) error {
+	if err := s.errIfReadOnly(); err != nil {
+		return err
+	}
+	if err := s.Backend.DeleteCalendar(cal); err != nil {
+		return fmt.Errorf("While deleting calendar: %w", err)
+	}
+	return s.PopulateCalendarMap()
+}
+
+// GetAllTodos returns the todos of the calendars bound to a project
+func (s *Service) GetAllTodos() (todos []Todo, err error) {
+	for _, path := range slices.Sorted(maps.Values(s.Projects)) {
+		cal := s.Calendars[path]
+		items, err := s.Backend.ListItems(cal)
+		if err != nil {
+			return todos, fmt.Errorf("While getting todos for calendar: %w", err)
+		}
+		for _, item := range items {
+			todo, err := s.NewTodo(cal, item)
+			if err != nil {
+				return todos, fmt.Errorf("While creating todo: %w", err)
+			}
+			todos = append(todos, *todo)
+		}
+	}
+	return todos, nil
+}
+
+// GetTodo returns the todo at a path, in the calendar the path is in or
+// else the calendar of the project. When nothing is found at the path,
+// because the todo has been moved since, it is looked up by uid, the UID
+// or taskwarrior uuid of the todo.
+func (s *Service) GetTodo(project string, path string, uid string) (Todo, error) {
+	cal, exists := s.calendarOf(path)
+	if !exists {
+		calPath, bound := s.Projects[project]
+		if !bound {
+			return s.findMovedTodo(uid, fmt.Errorf("No calendar found for %q", project))
+		}
+		cal = s.Calendars[calPath]
+	}
+
+	item, err := s.Backend.GetItem(path)
+	if err != nil {
+		return s.findMovedTodo(uid, err)
+	}
+
+	todo, err := s.NewTodo(cal, item)
+	if err != nil {
+		return Todo{}, fmt.Errorf("While mapping todo: %w", err)
+	}
+
+	return *todo, nil
+}
+
+// findMovedTodo looks up a todo that isn't where it was expected, err is
+// returned when it isn't found
+func (s *Service) findMovedTodo(uid string, err error) (Todo, error) {
+	if uid == "" {
+		return Todo{}, err
+	}
+	todo, findErr := s.FindTodo(uid)
+	if findErr != nil {
+		return Todo{}, err
+	}
+	slog.Debug("Todo found by uid", "uid", uid, "path", todo.Path)
+	return todo, nil
+}
+
+// FindTodo looks a todo up by UID or taskwarrior uuid in the synced
+// calendars
+func (s *Service) FindTodo(uid string) (Todo, error) {
+	todos, err := s.GetAllTodos()
+	if err != nil {
+		return Todo{}, fmt.Errorf("While looking up todo %s: %w", uid, err)
+	}
+	for _, todo := range todos {
+		if todo.UID() == uid || (todo.LocalId() != nil && *todo.LocalId() == uid) {
+			return todo, nil
+		}
+	}
+	return Todo{}, fmt.Errorf("No todo found for %s", uid)
+}
+
+func (s *Service) CreateNewTodo(t task.Task) (finalPath string, err error) {
+	if err := s.errIfReadOnly(); err != nil {
+		return "", err
+	}
+	cal, err := s.FindOrCreateCalendar(t.Project())
+	if err != nil {
+		return "", err
+	}
+
+	data := NewTodoCalendar(t)
+
+	slog.Debug("Creating remote ical", "calendar", cal.Path, "uid", *t.LocalId())
+
+	item, err := s.Backend.CreateItem(cal, *t.LocalId(), data)
+	if err != nil {
+		return "", err
+	}
+
+	return item.Path, nil
+}
+
+// NewTodo wraps the VTODO of an item, changes to it are saved through the
+// service
+func (s *Service) NewTodo(cal Calendar, item Item) (*Todo, error) {
+	if item.Data == nil {
+		return nil, fmt.Errorf("Item %s has no data", item.Path)
+	}
+
+	vTodoIndex := slices.IndexFunc(item.Data.Children, func(child *ical.Component) bool {
+		return child.Name == ical.CompToDo
+	})
+
+	if vTodoIndex < 0 {
+		return nil, fmt.Errorf("Could not find VTODO in item")
+	}
+
+	todo := Todo{
+		service:       s,
+		Calendar:      &cal,
+		Item:          &item,
+		TodoComponent: item.Data.Children[vTodoIndex],
+		Path:          item.Path,
+	}
+
+	return &todo, nil
+}
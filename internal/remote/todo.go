@@ -0,0 +1,325 @@
+package remote
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/priority"
+	"github.com/karsai5/tw-caldav/internal/sync/tags"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/uuid"
+)
+
+type Todo struct {
+	service       *Service
+	Calendar      *Calendar
+	Item          *Item
+	TodoComponent *ical.Component
+	Path          string
+}
+
+// Update implements task.Task.
+func (t *Todo) Update(u task.Task) (task.Task, error) {
+	if err := t.errIfReadOnly(); err != nil {
+		return u, err
+	}
+	if t.Project() != u.Project() {
+		cal, err := t.service.FindOrCreateCalendar(u.Project())
+		if err != nil {
+			return nil, err
+		}
+		slog.Debug("Moving ical", "oldPath", t.Path, "calendar", cal.Path)
+		newPath, err := t.service.Backend.MoveItem(t.Path, cal)
+		if err != nil {
+			return nil, fmt.Errorf("While moving task to new calendar: %w", err)
+		}
+		return task.CreateShellTask(task.WithTask(u), task.WithRemotePath(newPath)), nil
+	}
+
+	updatePropsWithInformationFromTask(t.TodoComponent, u, t.Item.Data)
+
+	slog.Debug("Updating remote ical", "path", t.Path, "uid", t.UID())
+
+	item, err := t.service.Backend.UpdateItem(t.Path, t.Item.Data)
+	if err != nil {
+		return u, err
+	}
+	t.Item.ETag = item.ETag
+
+	// Alarms are merged rather than replaced, pass the merged list on so
+	// the local task ends up with the same alarms
+	if uda.AlarmUDA() != "" {
+		return task.CreateShellTask(task.WithTask(u), task.WithAlarms(t.Alarms())), nil
+	}
+	return u, err
+
+}
+
+// Status implements task.Task.
+func (t *Todo) Status() task.Status {
+	prop := t.TodoComponent.Props.Get("STATUS")
+	if prop == nil {
+		return task.StatusPending
+	}
+	switch prop.Value {
+	case "COMPLETED":
+		return task.StatusComplete
+	case "CANCELLED":
+		return task.StatusDeleted
+	default:
+		return task.StatusPending
+	}
+}
+
+// LocalId implements task.Task.
+func (t *Todo) LocalId() *string {
+	if id := t.GetStringProp(PropTaskwarriorUUID); id != "" {
+		return &id
+	}
+	return t.legacyLocalId()
+}
+
+// legacyLocalId finds the taskwarrior uuid in the taskwarrior_id= marker
+// that older versions wrote into the DESCRIPTION.
+func (t *Todo) legacyLocalId() *string {
+	prop := t.TodoComponent.Props.Get("DESCRIPTION")
+	if prop == nil {
+		return nil
+	}
+	match := legacyIdRegex.FindStringSubmatch(prop.Value)
+	if match == nil {
+		return nil
+	}
+	return &match[1]
+}
+
+// UID returns the iCalendar UID of the todo. Todos created by other
+// clients don't necessarily use a uuid here.
+func (t *Todo) UID() string {
+	return t.GetStringProp("UID")
+}
+
+// LocalIdFromUID returns the taskwarrior uuid for a todo created by
+// another client. It is derived from the UID so that the local task is
+// found again when X-TASKWARRIOR-UUID couldn't be written to the todo.
+func LocalIdFromUID(uid string) string {
+	if id, err := uuid.Parse(uid); err == nil {
+		return id.String()
+	}
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(uid)).String()
+}
+
+// HasLegacyIdentity reports whether the todo still carries the
+// taskwarrior_id= marker in its DESCRIPTION.
+func (t *Todo) HasLegacyIdentity() bool {
+	return t.legacyLocalId() != nil
+}
+
+// MigrateIdentity moves the taskwarrior uuid from the DESCRIPTION marker
+// into the X-TASKWARRIOR-UUID property and saves the todo.
+func (t *Todo) MigrateIdentity() error {
+	id := t.LocalId()
+	if id == nil {
+		return fmt.Errorf("No taskwarrior uuid found for %s", t.Path)
+	}
+
+	if err := t.errIfReadOnly(); err != nil {
+		return err
+	}
+	setIdentityProps(&t.TodoComponent.Props, *id)
+
+	_, err := t.service.Backend.UpdateItem(t.Path, t.Item.Data)
+	if err != nil {
+		return fmt.Errorf("While saving migrated todo: %w", err)
+	}
+	return nil
+}
+
+// RemotePath implements task.Task.
+func (t *Todo) RemotePath() *string {
+	if t.Item.Path == "" {
+		return nil
+	}
+	return &t.Item.Path
+}
+
+// LastModified implements task.Task.
+func (t *Todo) LastModified() time.Time {
+	modified := t.getTimeProp("LAST-MODIFIED")
+	if modified == nil {
+		return time.Time{}
+	}
+	return *modified
+}
+
+// Due implements task.Task.
+func (t *Todo) Due() *time.Time {
+	return t.getTimeProp("DUE")
+}
+
+// Created implements task.Task.
+func (t *Todo) Created() *time.Time {
+	return t.getTimeProp("CREATED")
+}
+
+// Completed implements task.Task.
+func (t *Todo) Completed() *time.Time {
+	return t.getTimeProp("COMPLETED")
+}
+
+// Progress implements task.Task.
+func (t *Todo) Progress() *int {
+	if !uda.SyncProgress() {
+		return nil
+	}
+	prop := t.TodoComponent.Props.Get("PERCENT-COMPLETE")
+	if prop == nil {
+		return nil
+	}
+	progress, err := prop.Int()
+	if err != nil {
+		slog.Error("Could not parse percent complete", "value", prop.Value)
+		return nil
+	}
+	return &progress
+}
+
+// UDAs implements task.Task.
+func (t *Todo) UDAs() map[string]string {
+	udas := map[string]string{}
+	for _, m := range uda.Mappings() {
+		prop := t.TodoComponent.Props.Get(m.Property)
+		if prop == nil {
+			continue
+		}
+		value, err := readUDAProp(prop, m.Type)
+		if err != nil {
+			slog.Error("Could not read uda property", "prop", m.Property, "err", err)
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		udas[m.Name] = value
+	}
+	return udas
+}
+
+// Alarms implements task.Task.
+func (t *Todo) Alarms() []time.Duration {
+	if uda.AlarmUDA() == "" {
+		return nil
+	}
+	return readAlarms(t.TodoComponent, t.Due(), t.Item.Data)
+}
+
+func (t *Todo) getTimeProp(key string) *time.Time {
+	prop := t.TodoComponent.Props.Get(key)
+	if prop == nil {
+		return nil
+	}
+	value, err := parseTimeProp(prop, t.Item.Data)
+	if err != nil {
+		slog.Error("Could not parse time", "prop", key, "time", prop.Value)
+		return nil
+	}
+	return &value
+}
+
+// Priority implements task.Task. The priority is the value written for
+// the local level it maps to, so 2 is read as 1 with the default mapping.
+func (t *Todo) Priority() task.Priority {
+	prop := t.TodoComponent.Props.Get("PRIORITY")
+	if prop == nil {
+		return task.PriorityUnset
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(prop.Value))
+	if err != nil || value < 0 || value > 9 {
+		slog.Error("Could not parse priority", "priority", prop.Value)
+		return task.PriorityUnset
+	}
+	if value == 0 {
+		return task.PriorityUnset
+	}
+	mapping := priority.Current()
+	level := mapping.Label(value)
+	if !mapping.IsLossless(value) {
+		slog.Debug("Priority can't be stored exactly, using closest level", "priority", value, "level", level)
+	}
+	return task.Priority(mapping.Value(level))
+}
+
+// Project implements task.Task. The project is the one the calendar is
+// bound to, todos read from a file use the calendar name.
+func (t *Todo) Project() string {
+	if t.service != nil {
+		if project, bound := t.service.ProjectOf(*t.Calendar); bound {
+			return project
+		}
+	}
+	return projectOfName(t.Calendar.Name)
+}
+
+// Tags implements task.Task.
+func (t *Todo) Tags() []string {
+	result := []string{}
+	for _, prop := range t.TodoComponent.Props.Values("CATEGORIES") {
+		categories, err := prop.TextList()
+		if err != nil {
+			slog.Error("Could not parse categories", "categories", prop.Value, "err", err)
+			continue
+		}
+		for _, category := range categories {
+			tag, ok := tags.FromCategory(category)
+			if ok && !slices.Contains(result, tag) {
+				result = append(result, tag)
+			}
+		}
+	}
+	return result
+}
+
+func (t *Todo) Description() string {
+	return t.GetStringProp("SUMMARY")
+}
+
+// GetStringProp returns the unescaped text of a property
+func (t *Todo) GetStringProp(key string) string {
+	prop := t.TodoComponent.Props.Get(key)
+	if prop == nil {
+		return ""
+	}
+	text, err := prop.Text()
+	if err != nil {
+		slog.Error("Could not parse text", "prop", key, "value", prop.Value, "err", err)
+		return prop.Value
+	}
+	return text
+}
+
+func (t *Todo) Delete() error {
+	if err := t.errIfReadOnly(); err != nil {
+		return err
+	}
+	return t.service.Backend.DeleteItem(t.Path)
+}
+
+// errIfReadOnly returns an error when changes to the todo can't be saved,
+// because it was read from a file rather than a backend or through a
+// read-only service
+func (t *Todo) errIfReadOnly() error {
+	if t.service == nil {
+		return fmt.Errorf("Todo %q is not stored in a backend and can't be changed", t.UID())
+	}
+	if err := t.service.errIfReadOnly(); err != nil {
+		return fmt.Errorf("Todo %q can't be changed: %w", t.UID(), err)
+	}
+	return nil
+}
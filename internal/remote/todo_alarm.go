@@ -0,0 +1,197 @@
+package remote
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+
+	"github.com/emersion/go-ical"
+	"github.com/spf13/viper"
+)
+
+// PropGenerated marks alarms that tw-caldav created, its value tells where
+// they came from
+const PropGenerated = "X-TASKWARRIOR-GENERATED"
+
+const (
+	// generatedFromOffsets marks alarms created from alarm_offsets. They are
+	// recreated on every update and never imported into taskwarrior.
+	generatedFromOffsets = "TRUE"
+	// generatedFromTask marks alarms created from the alarm UDA of a task.
+	// They are removed when the task no longer has them.
+	generatedFromTask = "TASK"
+)
+
+// getAlarmOffsets returns how long before the due date alarms are
+// generated, configured with the alarm_offsets key, e.g. 15m,1h
+func getAlarmOffsets() []time.Duration {
+	offsets := []time.Duration{}
+	for _, part := range strings.Split(viper.GetString("alarm_offsets"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			slog.Error("Could not parse alarm offset", "offset", part, "err", err)
+			continue
+		}
+		offsets = append(offsets, d)
+	}
+	return uda.SortAlarms(offsets)
+}
+
+// wantsGeneratedAlarms reports whether alarms should be generated for a
+// task. With alarm_require set only tasks that have a tag or a non-empty
+// mapped UDA of that name get alarms.
+func wantsGeneratedAlarms(t task.Task) bool {
+	if t.Due() == nil || t.Status() != task.StatusPending {
+		return false
+	}
+	required := viper.GetString("alarm_require")
+	if required == "" {
+		return true
+	}
+	if slices.Contains(t.Tags(), required) {
+		return true
+	}
+	return t.UDAs()[required] != ""
+}
+
+// updateAlarms regenerates the configured alarms of a todo, adds the
+// alarms of the task that the todo doesn't have yet and removes the ones
+// tw-caldav added that the task no longer has. Alarms that weren't
+// generated by tw-caldav are never removed.
+func updateAlarms(todo *ical.Component, t task.Task, cal *ical.Calendar) {
+	due := t.Due()
+	taskAlarms := t.Alarms()
+
+	kept := []*ical.Component{}
+	existing := []time.Duration{}
+	for _, child := range todo.Children {
+		if child.Name != ical.CompAlarm {
+			kept = append(kept, child)
+			continue
+		}
+		generated := generatedFrom(child)
+		if generated == generatedFromOffsets {
+			continue
+		}
+		offset, ok := alarmOffset(child, todo, due, cal)
+		if generated == generatedFromTask && uda.AlarmUDA() != "" && (!ok || !slices.Contains(taskAlarms, offset)) {
+			slog.Debug("Removing alarm", "task", t.Description(), "offset", offset)
+			continue
+		}
+		if ok {
+			existing = append(existing, offset)
+		}
+		kept = append(kept, child)
+	}
+	todo.Children = kept
+
+	if due == nil {
+		return
+	}
+
+	for _, offset := range taskAlarms {
+		if slices.Contains(existing, offset) {
+			continue
+		}
+		todo.Children = append(todo.Children, newAlarm(t.Description(), offset, generatedFromTask))
+		existing = append(existing, offset)
+	}
+
+	if !wantsGeneratedAlarms(t) {
+		return
+	}
+	for _, offset := range getAlarmOffsets() {
+		if slices.Contains(existing, offset) {
+			continue
+		}
+		todo.Children = append(todo.Children, newAlarm(t.Description(), offset, generatedFromOffsets))
+	}
+}
+
+func newAlarm(description string, offset time.Duration, generated string) *ical.Component {
+	alarm := ical.NewComponent(ical.CompAlarm)
+	addStringProp(&alarm.Props, ical.PropAction, "DISPLAY")
+	addStringProp(&alarm.Props, ical.PropDescription, description)
+
+	trigger := ical.NewProp(ical.PropTrigger)
+	trigger.Params.Set(ical.ParamRelated, "END")
+	trigger.Value = "-" + uda.FormatDuration(offset)
+	if offset < 0 {
+		trigger.Value = uda.FormatDuration(-offset)
+	}
+	alarm.Props.Set(trigger)
+
+	if generated != "" {
+		addStringProp(&alarm.Props, PropGenerated, generated)
+	}
+	return alarm
+}
+
+// generatedFrom returns the PropGenerated value of an alarm, or "" for
+// alarms tw-caldav didn't create
+func generatedFrom(alarm *ical.Component) string {
+	prop := alarm.Props.Get(PropGenerated)
+	if prop == nil {
+		return ""
+	}
+	return strings.ToUpper(prop.Value)
+}
+
+// alarmOffset returns how long before the due date an alarm triggers
+func alarmOffset(alarm *ical.Component, todo *ical.Component, due *time.Time, cal *ical.Calendar) (time.Duration, bool) {
+	trigger := alarm.Props.Get(ical.PropTrigger)
+	if trigger == nil || due == nil {
+		return 0, false
+	}
+
+	if trigger.ValueType() == ical.ValueDateTime {
+		at, err := trigger.DateTime(time.UTC)
+		if err != nil {
+			return 0, false
+		}
+		return due.Sub(at), true
+	}
+
+	d, err := uda.ParseDuration(trigger.Value)
+	if err != nil {
+		slog.Error("Could not parse alarm trigger", "trigger", trigger.Value)
+		return 0, false
+	}
+
+	relatedTo := *due
+	if !strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") {
+		start := todo.Props.Get(ical.PropDateTimeStart)
+		if start == nil {
+			return 0, false
+		}
+		startTime, err := parseTimeProp(start, cal)
+		if err != nil {
+			return 0, false
+		}
+		relatedTo = startTime
+	}
+	return due.Sub(relatedTo.Add(d)), true
+}
+
+// readAlarms returns the alarms of a todo that weren't generated from
+// alarm_offsets, as offsets before the due date
+func readAlarms(todo *ical.Component, due *time.Time, cal *ical.Calendar) []time.Duration {
+	alarms := []time.Duration{}
+	for _, child := range todo.Children {
+		if child.Name != ical.CompAlarm || generatedFrom(child) == generatedFromOffsets {
+			continue
+		}
+		if offset, ok := alarmOffset(child, todo, due, cal); ok {
+			alarms = append(alarms, offset)
+		}
+	}
+	return uda.SortAlarms(alarms)
+}
@@ -0,0 +1,116 @@
+package remote
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+	"github.com/spf13/viper"
+)
+
+// alarms lists the alarms of a todo as offset/generated
+func alarms(todo *ical.Component, due time.Time) []string {
+	got := []string{}
+	for _, child := range todo.Children {
+		if child.Name != ical.CompAlarm {
+			continue
+		}
+		offset, _ := alarmOffset(child, todo, &due, ical.NewCalendar())
+		got = append(got, fmt.Sprintf("%s/%s", offset, generatedFrom(child)))
+	}
+	slices.Sort(got)
+	return got
+}
+
+func TestUpdateAlarms(t *testing.T) {
+	due := time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		alarmUDA string
+		existing []*ical.Component
+		alarms   []time.Duration
+		status   task.Status
+		want     []string
+	}{
+		{
+			name:     "task alarms and offsets are added",
+			alarmUDA: "alarms",
+			alarms:   []time.Duration{time.Hour},
+			status:   task.StatusPending,
+			want:     []string{"15m0s/TRUE", "1h0m0s/TASK"},
+		},
+		{
+			name:     "alarm removed from the task is removed",
+			alarmUDA: "alarms",
+			existing: []*ical.Component{newAlarm("t", time.Hour, generatedFromTask), newAlarm("t", 30*time.Minute, generatedFromTask)},
+			alarms:   []time.Duration{time.Hour},
+			status:   task.StatusPending,
+			want:     []string{"15m0s/TRUE", "1h0m0s/TASK"},
+		},
+		{
+			name:     "alarms of other clients are kept",
+			alarmUDA: "alarms",
+			existing: []*ical.Component{newAlarm("t", 30*time.Minute, "")},
+			status:   task.StatusPending,
+			want:     []string{"15m0s/TRUE", "30m0s/"},
+		},
+		{
+			name:     "offsets are dropped when the task is done",
+			alarmUDA: "alarms",
+			existing: []*ical.Component{newAlarm("t", 15*time.Minute, generatedFromOffsets)},
+			status:   task.StatusComplete,
+			want:     []string{},
+		},
+		{
+			name:     "task alarms are kept without an alarm UDA",
+			existing: []*ical.Component{newAlarm("t", 30*time.Minute, generatedFromTask)},
+			status:   task.StatusPending,
+			want:     []string{"15m0s/TRUE", "30m0s/TASK"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("alarm_uda", tt.alarmUDA)
+			viper.Set("alarm_offsets", "15m")
+			t.Cleanup(func() {
+				viper.Set("alarm_uda", "")
+				viper.Set("alarm_offsets", "")
+			})
+
+			todo := ical.NewComponent(ical.CompToDo)
+			todo.Children = tt.existing
+			updateAlarms(todo, task.ShellTask{Task: &task.Internaltask{
+				Description: "t",
+				Due:         &due,
+				Alarms:      tt.alarms,
+				Status:      tt.status,
+			}}, ical.NewCalendar())
+
+			if got := alarms(todo, due); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAlarms(t *testing.T) {
+	due := time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC)
+	todo := ical.NewComponent(ical.CompToDo)
+	todo.Children = []*ical.Component{
+		newAlarm("t", time.Hour, generatedFromTask),
+		newAlarm("t", 15*time.Minute, generatedFromOffsets),
+		newAlarm("t", -5*time.Minute, ""),
+	}
+
+	got := readAlarms(todo, &due, ical.NewCalendar())
+	want := []time.Duration{-5 * time.Minute, time.Hour}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
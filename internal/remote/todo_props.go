@@ -0,0 +1,222 @@
+package remote
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/priority"
+	"github.com/karsai5/tw-caldav/internal/sync/tags"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+
+	"github.com/emersion/go-ical"
+)
+
+// PropTaskwarriorUUID holds the uuid of the taskwarrior task a todo is
+// synced with
+const PropTaskwarriorUUID = "X-TASKWARRIOR-UUID"
+
+var legacyIdRegex = regexp.MustCompile("taskwarrior_id=([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})")
+
+// NewTodoCalendar creates a VCALENDAR holding a single VTODO with the
+// information of a task
+func NewTodoCalendar(t task.Task) *ical.Calendar {
+	syncTime := time.Now()
+
+	cal := ical.NewCalendar()
+	cal.Component.Name = "VCALENDAR"
+
+	addStringProp(&cal.Component.Props, "PRODID", "-//Karsai5//tw-caldav 2025.6.7//EN")
+	addTimeProp(&cal.Component.Props, "DTSTAMP", syncTime)
+	addStringProp(&cal.Component.Props, "VERSION", "2.0")
+
+	todo := ical.NewComponent("VTODO")
+
+	addTimeProp(&todo.Props, "DTSTAMP", syncTime)
+	updatePropsWithInformationFromTask(todo, t, cal)
+
+	cal.Component.Children = append(cal.Component.Children, todo)
+	return cal
+}
+
+func updatePropsWithInformationFromTask(todo *ical.Component, t task.Task, cal *ical.Calendar) {
+	props := &todo.Props
+	addStringProp(props, "SUMMARY", t.Description())
+
+	if status := statusToCalDavStatus(t.Status()); status != "" {
+		addStringProp(props, "STATUS", status)
+	} else if prop := props.Get("STATUS"); prop != nil && (prop.Value == "COMPLETED" || prop.Value == "CANCELLED") {
+		// Reopened, statuses like IN-PROCESS set by other clients are kept
+		addStringProp(props, "STATUS", "NEEDS-ACTION")
+	}
+
+	addTimeProp(props, "LAST-MODIFIED", time.Now())
+
+	if t.Created() != nil {
+		addTimeProp(props, "CREATED", t.Created().UTC())
+	}
+
+	if t.Status() == task.StatusComplete {
+		if t.Completed() != nil {
+			addTimeProp(props, "COMPLETED", t.Completed().UTC())
+		}
+	} else {
+		props.Del("COMPLETED")
+	}
+
+	progressSet := false
+	if uda.SyncProgress() {
+		if t.Progress() != nil {
+			prop := ical.NewProp("PERCENT-COMPLETE")
+			prop.Value = fmt.Sprintf("%d", *t.Progress())
+			props.Set(prop)
+			progressSet = true
+		} else {
+			props.Del("PERCENT-COMPLETE")
+		}
+	}
+	// Clients mark completed todos as 100% done, a reopened one isn't
+	if t.Status() != task.StatusComplete && !progressSet {
+		if prop := props.Get("PERCENT-COMPLETE"); prop != nil {
+			if value, err := prop.Int(); err == nil && value >= 100 {
+				props.Del("PERCENT-COMPLETE")
+			}
+		}
+	}
+
+	if t.Due() != nil {
+		setTimeProp(props, "DUE", *t.Due(), cal)
+		setTimeProp(props, "DTSTART", *t.Due(), cal)
+	} else {
+		props.Del("DUE")
+		props.Del("DTSTART")
+	}
+
+	updatePriorityProp(props, t.Priority())
+
+	updatePropsWithUDAs(props, t)
+	updateAlarms(todo, t, cal)
+
+	if t.LocalId() != nil {
+		setIdentityProps(props, *t.LocalId())
+	}
+
+	updateCategoriesProp(props, t.Tags())
+}
+
+// updateCategoriesProp writes the tags of a task as a single CATEGORIES
+// property, replacing any CATEGORIES properties the todo had. Categories
+// that don't map to a tag are kept, and a tag the todo already has as a
+// category is written as is, not as its alias.
+func updateCategoriesProp(props *ical.Props, taskTags []string) {
+	existing := []string{}
+	for _, prop := range props.Values("CATEGORIES") {
+		categories, err := prop.TextList()
+		if err != nil {
+			categories = []string{prop.Value}
+		}
+		for _, category := range categories {
+			existing = append(existing, strings.TrimSpace(category))
+		}
+	}
+
+	categories := []string{}
+	for _, tag := range taskTags {
+		category := tags.ToCategory(tag)
+		if slices.Contains(existing, tag) {
+			category = tag
+		}
+		if !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	for _, category := range existing {
+		if !tags.Mapped(category) && category != "" && !slices.Contains(categories, category) {
+			categories = append(categories, category)
+		}
+	}
+
+	props.Del("CATEGORIES")
+	if len(categories) == 0 {
+		return
+	}
+	prop := ical.NewProp("CATEGORIES")
+	prop.SetTextList(categories)
+	props.Set(prop)
+}
+
+// updatePriorityProp writes the priority of a task, keeping the existing
+// value when it maps to the same local level so that values other
+// clients set, such as 2 or 7, survive a round trip.
+func updatePriorityProp(props *ical.Props, p task.Priority) {
+	if p == task.PriorityUnset {
+		props.Del("PRIORITY")
+		return
+	}
+
+	mapping := priority.Current()
+	if existing := props.Get("PRIORITY"); existing != nil {
+		if value, err := existing.Int(); err == nil && mapping.Equivalent(value, int(p)) {
+			return
+		}
+	}
+
+	prop := ical.NewProp("PRIORITY")
+	prop.Value = fmt.Sprintf("%d", p)
+	props.Set(prop)
+}
+
+// setIdentityProps records the taskwarrior uuid of a todo. The UID is
+// only set when missing, so todos created by other clients keep theirs.
+// Any taskwarrior_id= marker left in the DESCRIPTION is removed.
+func setIdentityProps(props *ical.Props, localId string) {
+	addStringProp(props, PropTaskwarriorUUID, localId)
+
+	if uid := props.Get("UID"); uid == nil || uid.Value == "" {
+		addStringProp(props, "UID", localId)
+	}
+
+	if prop := props.Get("DESCRIPTION"); prop != nil {
+		desc, err := prop.Text()
+		if err != nil {
+			desc = prop.Value
+		}
+		desc = strings.TrimSpace(legacyIdRegex.ReplaceAllString(desc, ""))
+		if desc == "" {
+			props.Del("DESCRIPTION")
+		} else {
+			addStringProp(props, "DESCRIPTION", desc)
+		}
+	}
+}
+
+func statusToCalDavStatus(s task.Status) string {
+	switch s {
+	case task.StatusComplete:
+		return "COMPLETED"
+	case task.StatusDeleted:
+		return "CANCELLED"
+	default:
+		return ""
+	}
+
+}
+
+func addStringProp(props *ical.Props, name string, value string) {
+	prop := ical.NewProp(name)
+	prop.SetText(value)
+	// TEXT is already the default for non-standard properties
+	if strings.HasPrefix(prop.Name, "X-") {
+		prop.Params.Del(ical.ParamValue)
+	}
+	props.Set(prop)
+}
+
+func addTimeProp(props *ical.Props, name string, value time.Time) {
+	prop := ical.NewProp(name)
+	prop.SetDateTime(value.UTC())
+	props.Set(prop)
+}
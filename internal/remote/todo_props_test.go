@@ -0,0 +1,154 @@
+package remote
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+)
+
+func propValue(todo *ical.Component, name string) string {
+	if prop := todo.Props.Get(name); prop != nil {
+		return prop.Value
+	}
+	return ""
+}
+
+func TestUpdatePropsStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          string
+		percentComplete string
+		taskStatus      task.Status
+		wantStatus      string
+		wantPercent     string
+	}{
+		{"completed", "NEEDS-ACTION", "", task.StatusComplete, "COMPLETED", ""},
+		{"deleted", "NEEDS-ACTION", "", task.StatusDeleted, "CANCELLED", ""},
+		{"reopened", "COMPLETED", "100", task.StatusPending, "NEEDS-ACTION", ""},
+		{"restored", "CANCELLED", "", task.StatusPending, "NEEDS-ACTION", ""},
+		{"in process is kept", "IN-PROCESS", "40", task.StatusPending, "IN-PROCESS", "40"},
+		{"no status stays unset", "", "", task.StatusPending, "", ""},
+		{"completed keeps 100", "COMPLETED", "100", task.StatusComplete, "COMPLETED", "100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo := ical.NewComponent(ical.CompToDo)
+			if tt.status != "" {
+				addStringProp(&todo.Props, "STATUS", tt.status)
+			}
+			if tt.percentComplete != "" {
+				prop := ical.NewProp("PERCENT-COMPLETE")
+				prop.Value = tt.percentComplete
+				todo.Props.Set(prop)
+			}
+
+			id := "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"
+			updatePropsWithInformationFromTask(todo, task.ShellTask{Task: &task.Internaltask{
+				Description: "Water the plants",
+				Status:      tt.taskStatus,
+				LocalId:     &id,
+			}}, ical.NewCalendar())
+
+			if got := propValue(todo, "STATUS"); got != tt.wantStatus {
+				t.Errorf("STATUS = %q, want %q", got, tt.wantStatus)
+			}
+			if got := propValue(todo, "PERCENT-COMPLETE"); got != tt.wantPercent {
+				t.Errorf("PERCENT-COMPLETE = %q, want %q", got, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestPriorityRoundTrip(t *testing.T) {
+	tests := []struct {
+		remote    string
+		local     task.Priority
+		wantRead  task.Priority
+		wantWrite string
+	}{
+		{"", task.PriorityHigh, task.PriorityUnset, "1"},
+		{"2", task.PriorityHigh, task.PriorityHigh, "2"},
+		{"2", task.PriorityMedium, task.PriorityHigh, "5"},
+		{"7", task.PriorityLow, task.PriorityLow, "7"},
+		{"0", task.PriorityUnset, task.PriorityUnset, ""},
+		{"5", task.PriorityUnset, task.PriorityMedium, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			todo := ical.NewComponent(ical.CompToDo)
+			if tt.remote != "" {
+				prop := ical.NewProp("PRIORITY")
+				prop.Value = tt.remote
+				todo.Props.Set(prop)
+			}
+
+			if got := (&Todo{TodoComponent: todo}).Priority(); got != tt.wantRead {
+				t.Errorf("Priority() = %d, want %d", got, tt.wantRead)
+			}
+			updatePriorityProp(&todo.Props, tt.local)
+			if got := propValue(todo, "PRIORITY"); got != tt.wantWrite {
+				t.Errorf("PRIORITY = %q, want %q", got, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestUpdateCategoriesProp(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		tags     []string
+		want     string
+	}{
+		{"no categories", "", nil, ""},
+		{"tags are written", "", []string{"home", "errands"}, "home,errands"},
+		{"alias is written for a new tag", "", []string{"work"}, "Work Stuff"},
+		{"alias is kept", "Work Stuff", []string{"work"}, "Work Stuff"},
+		{"plain category isn't rewritten to the alias", "work", []string{"work"}, "work"},
+		{"removed tag is removed", "home,errands", []string{"home"}, "home"},
+		{"unmapped category is kept", "Some Project,home", []string{"home", "garden"}, "home,garden,Some Project"},
+		{"unmapped category survives removing all tags", "Some Project,home", nil, "Some Project"},
+		{"escaped comma", `Fish\, Chips`, []string{"shop"}, `shop,Fish\, Chips`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			props := ical.Props{}
+			if tt.existing != "" {
+				prop := ical.NewProp("CATEGORIES")
+				prop.Value = tt.existing
+				props.Set(prop)
+			}
+
+			updateCategoriesProp(&props, tt.tags)
+
+			got := ""
+			if prop := props.Get("CATEGORIES"); prop != nil {
+				got = prop.Value
+			}
+			if got != tt.want {
+				t.Errorf("CATEGORIES = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoTags(t *testing.T) {
+	todo := ical.NewComponent(ical.CompToDo)
+	for _, value := range []string{`home,Work Stuff`, `Some Project,home`, `a\,b`} {
+		prop := ical.NewProp("CATEGORIES")
+		prop.Value = value
+		todo.Props.Add(prop)
+	}
+
+	got := (&Todo{TodoComponent: todo}).Tags()
+	want := []string{"home", "work"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,63 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+)
+
+func TestReadOnlyTodo(t *testing.T) {
+	id := "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"
+	newTodo := func(service *Service) *Todo {
+		data := NewTodoCalendar(task.ShellTask{Task: &task.Internaltask{Description: "t", LocalId: &id}})
+		todo := data.Children[0]
+		for _, child := range data.Children {
+			if child.Name == ical.CompToDo {
+				todo = child
+			}
+		}
+		return &Todo{service: service, Item: &Item{Data: data}, TodoComponent: todo, Path: "/cal/default/t.ics"}
+	}
+	update := task.ShellTask{Task: &task.Internaltask{Description: "changed", LocalId: &id}}
+
+	tests := []struct {
+		name    string
+		service *Service
+	}{
+		{"read from a file", nil},
+		{"read-only service", &Service{readOnly: true, Calendars: CalendarMap{}, Projects: map[string]string{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTodo(tt.service).Update(update); err == nil {
+				t.Error("Update succeeded")
+			}
+			if err := newTodo(tt.service).Delete(); err == nil {
+				t.Error("Delete succeeded")
+			}
+			if err := newTodo(tt.service).MigrateIdentity(); err == nil {
+				t.Error("MigrateIdentity succeeded")
+			}
+		})
+	}
+}
+
+func TestReadOnlyService(t *testing.T) {
+	s := &Service{readOnly: true, Calendars: CalendarMap{}, Projects: map[string]string{}}
+	id := "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"
+
+	if _, err := s.CreateCalendar("work"); err == nil {
+		t.Error("CreateCalendar succeeded")
+	}
+	if err := s.UpdateCalendar(Calendar{Path: "/cal/work/"}); err == nil {
+		t.Error("UpdateCalendar succeeded")
+	}
+	if err := s.DeleteCalendar(Calendar{Path: "/cal/work/"}); err == nil {
+		t.Error("DeleteCalendar succeeded")
+	}
+	if _, err := s.CreateNewTodo(task.ShellTask{Task: &task.Internaltask{Description: "t", LocalId: &id}}); err == nil {
+		t.Error("CreateNewTodo succeeded")
+	}
+}
@@ -0,0 +1,313 @@
+package remote
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/spf13/viper"
+	"github.com/teambition/rrule-go"
+)
+
+const (
+	icalDateFormat        = "20060102"
+	icalDateTimeFormat    = "20060102T150405"
+	icalDateTimeFormatUTC = "20060102T150405Z"
+	timeOfDayFormat       = "15:04"
+)
+
+var (
+	floatingLocation     *time.Location
+	floatingLocationOnce sync.Once
+)
+
+// getFloatingLocation returns the zone used for floating times and
+// date-only values, configured with the timezone key. Defaults to the
+// local zone of the machine.
+func getFloatingLocation() *time.Location {
+	floatingLocationOnce.Do(func() {
+		floatingLocation = time.Local
+		name := viper.GetString("timezone")
+		if name == "" {
+			return
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			slog.Error("Could not load timezone, using local time", "timezone", name, "err", err)
+			return
+		}
+		floatingLocation = loc
+	})
+	return floatingLocation
+}
+
+// getAllDayTimeOfDay returns the time of day date-only values are mapped
+// to, configured with the allday_time key as HH:MM
+func getAllDayTimeOfDay() (hour int, minute int) {
+	value := viper.GetString("allday_time")
+	if value == "" {
+		value = "00:00"
+	}
+	t, err := time.Parse(timeOfDayFormat, value)
+	if err != nil {
+		slog.Error("Could not parse allday_time, using midnight", "allday_time", value)
+		return 0, 0
+	}
+	return t.Hour(), t.Minute()
+}
+
+func isDateProp(prop *ical.Prop) bool {
+	return prop.ValueType() == ical.ValueDate ||
+		(prop.Params.Get(ical.ParamValue) == "" && len(prop.Value) == len(icalDateFormat))
+}
+
+func isUTCProp(prop *ical.Prop) bool {
+	return strings.HasSuffix(prop.Value, "Z")
+}
+
+// parseTimeProp reads a DATE or DATE-TIME property. Date-only values are
+// placed at the configured time of day, TZID parameters are resolved
+// through the tz database or the VTIMEZONE components of the calendar
+// and floating times are read in the configured zone.
+func parseTimeProp(prop *ical.Prop, cal *ical.Calendar) (time.Time, error) {
+	value := strings.TrimSpace(prop.Value)
+	loc := getFloatingLocation()
+
+	if isDateProp(prop) {
+		date, err := time.ParseInLocation(icalDateFormat, value, loc)
+		if err != nil {
+			return time.Time{}, err
+		}
+		hour, minute := getAllDayTimeOfDay()
+		return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc), nil
+	}
+
+	if isUTCProp(prop) {
+		return time.Parse(icalDateTimeFormatUTC, value)
+	}
+
+	tzid := prop.Params.Get(ical.PropTimezoneID)
+	if tzid == "" {
+		return time.ParseInLocation(icalDateTimeFormat, value, loc)
+	}
+
+	if tzLoc, err := time.LoadLocation(tzid); err == nil {
+		return time.ParseInLocation(icalDateTimeFormat, value, tzLoc)
+	}
+
+	tz, err := findVTimezone(cal, tzid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	wall, err := time.Parse(icalDateTimeFormat, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	offset := tz.offsetAtWallTime(wall)
+	return wall.Add(-time.Duration(offset) * time.Second), nil
+}
+
+// setTimeProp writes a time in the same form as the existing property,
+// so that date-only, TZID and floating values stay that way. New
+// properties are written in UTC.
+func setTimeProp(props *ical.Props, name string, value time.Time, cal *ical.Calendar) {
+	existing := props.Get(name)
+	prop := ical.NewProp(name)
+
+	switch {
+	case existing == nil || isUTCProp(existing):
+		prop.SetDateTime(value.UTC())
+
+	case isDateProp(existing):
+		local := value.In(getFloatingLocation())
+		hour, minute := getAllDayTimeOfDay()
+		if local.Hour() == hour && local.Minute() == minute && local.Second() == 0 {
+			prop.SetDate(local)
+		} else {
+			prop.SetDateTime(value.UTC())
+		}
+
+	case existing.Params.Get(ical.PropTimezoneID) != "":
+		tzid := existing.Params.Get(ical.PropTimezoneID)
+		if tzLoc, err := time.LoadLocation(tzid); err == nil {
+			prop.Value = value.In(tzLoc).Format(icalDateTimeFormat)
+			prop.Params.Set(ical.PropTimezoneID, tzid)
+		} else if tz, err := findVTimezone(cal, tzid); err == nil {
+			offset := tz.offsetAtInstant(value)
+			prop.Value = value.UTC().Add(time.Duration(offset) * time.Second).Format(icalDateTimeFormat)
+			prop.Params.Set(ical.PropTimezoneID, tzid)
+		} else {
+			slog.Warn("Unknown timezone, writing time in UTC", "tzid", tzid)
+			prop.SetDateTime(value.UTC())
+		}
+
+	default:
+		prop.Value = value.In(getFloatingLocation()).Format(icalDateTimeFormat)
+	}
+
+	props.Set(prop)
+}
+
+type observance struct {
+	start      time.Time
+	rule       *rrule.ROption
+	offsetFrom int
+	offsetTo   int
+}
+
+type vtimezone struct {
+	observances []observance
+}
+
+func findVTimezone(cal *ical.Calendar, tzid string) (*vtimezone, error) {
+	if cal == nil {
+		return nil, fmt.Errorf("No VTIMEZONE found for %q", tzid)
+	}
+	for _, child := range cal.Children {
+		if child.Name != ical.CompTimezone {
+			continue
+		}
+		if prop := child.Props.Get(ical.PropTimezoneID); prop == nil || prop.Value != tzid {
+			continue
+		}
+		return parseVTimezone(child)
+	}
+	return nil, fmt.Errorf("No VTIMEZONE found for %q", tzid)
+}
+
+func parseVTimezone(comp *ical.Component) (*vtimezone, error) {
+	tz := vtimezone{}
+	for _, child := range comp.Children {
+		if child.Name != ical.CompTimezoneStandard && child.Name != ical.CompTimezoneDaylight {
+			continue
+		}
+
+		startProp := child.Props.Get(ical.PropDateTimeStart)
+		if startProp == nil {
+			return nil, fmt.Errorf("Timezone observance without DTSTART")
+		}
+		start, err := time.Parse(icalDateTimeFormat, strings.TrimSuffix(startProp.Value, "Z"))
+		if err != nil {
+			return nil, fmt.Errorf("While parsing observance start: %w", err)
+		}
+
+		obs := observance{start: start}
+		if obs.offsetFrom, err = parseUTCOffset(child.Props.Get("TZOFFSETFROM")); err != nil {
+			return nil, err
+		}
+		if obs.offsetTo, err = parseUTCOffset(child.Props.Get("TZOFFSETTO")); err != nil {
+			return nil, err
+		}
+
+		roption, err := child.Props.RecurrenceRule()
+		if err != nil {
+			return nil, err
+		}
+		if roption != nil {
+			if !roption.Until.IsZero() {
+				roption.Until = roption.Until.Add(time.Duration(obs.offsetFrom) * time.Second)
+			}
+			obs.rule = roption
+		}
+		tz.observances = append(tz.observances, obs)
+	}
+	if len(tz.observances) == 0 {
+		return nil, fmt.Errorf("VTIMEZONE has no observances")
+	}
+	return &tz, nil
+}
+
+func parseUTCOffset(prop *ical.Prop) (int, error) {
+	if prop == nil {
+		return 0, fmt.Errorf("Timezone observance without offset")
+	}
+	value := strings.TrimSpace(prop.Value)
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("Invalid utc offset %q", value)
+	}
+	sign := 1
+	switch value[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return 0, fmt.Errorf("Invalid utc offset %q", value)
+	}
+	seconds := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+i*2 >= len(value) {
+			break
+		}
+		n, err := strconv.Atoi(value[1+i*2 : 3+i*2])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid utc offset %q", value)
+		}
+		seconds += n * unit
+	}
+	return sign * seconds, nil
+}
+
+// lastOnset returns the last time the observance took effect at or
+// before the given wall time, expressed in the wall time before the
+// transition
+func (o observance) lastOnset(wall time.Time) (time.Time, bool) {
+	if wall.Before(o.start) {
+		return time.Time{}, false
+	}
+	if o.rule == nil {
+		return o.start, true
+	}
+
+	// Observances commonly start in 1601 or 1970, which is further back
+	// than rrule is willing to iterate. Yearly rules are moved to start
+	// shortly before the time we are interested in instead, unless they
+	// are limited by COUNT, which is counted from the real start.
+	roption := *o.rule
+	roption.Dtstart = o.start
+	if roption.Freq == rrule.YEARLY && roption.Count == 0 && wall.Year()-o.start.Year() > 2 {
+		roption.Dtstart = time.Date(wall.Year()-2, o.start.Month(), o.start.Day(),
+			o.start.Hour(), o.start.Minute(), o.start.Second(), 0, time.UTC)
+	}
+	rule, err := rrule.NewRRule(roption)
+	if err != nil {
+		slog.Error("Could not evaluate timezone rule", "err", err)
+		return o.start, true
+	}
+
+	onset := rule.Before(wall, true)
+	if onset.IsZero() {
+		return o.start, true
+	}
+	return onset, true
+}
+
+func (tz vtimezone) offsetAtWallTime(wall time.Time) int {
+	return tz.offsetAt(func(o observance) time.Time { return wall })
+}
+
+func (tz vtimezone) offsetAtInstant(instant time.Time) int {
+	return tz.offsetAt(func(o observance) time.Time {
+		return instant.UTC().Add(time.Duration(o.offsetFrom) * time.Second)
+	})
+}
+
+func (tz vtimezone) offsetAt(wallFor func(o observance) time.Time) int {
+	var latest time.Time
+	offset := tz.observances[0].offsetFrom
+	for _, o := range tz.observances {
+		onset, found := o.lastOnset(wallFor(o))
+		if !found {
+			continue
+		}
+		onsetUTC := onset.Add(-time.Duration(o.offsetFrom) * time.Second)
+		if latest.IsZero() || onsetUTC.After(latest) {
+			latest = onsetUTC
+			offset = o.offsetTo
+		}
+	}
+	return offset
+}
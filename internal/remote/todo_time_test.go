@@ -0,0 +1,263 @@
+package remote
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/spf13/viper"
+)
+
+// timezones holds VTIMEZONEs whose TZID isn't in the tz database, like
+// the ones Outlook writes
+const timezones = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//EN
+BEGIN:VTIMEZONE
+TZID:Outlook Sydney
+BEGIN:STANDARD
+DTSTART:16010101T030000
+TZOFFSETFROM:+1100
+TZOFFSETTO:+1000
+RRULE:FREQ=YEARLY;BYMONTH=4;BYDAY=1SU
+END:STANDARD
+BEGIN:DAYLIGHT
+DTSTART:16010101T020000
+TZOFFSETFROM:+1000
+TZOFFSETTO:+1100
+RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=1SU
+END:DAYLIGHT
+END:VTIMEZONE
+BEGIN:VTIMEZONE
+TZID:Short Lived DST
+BEGIN:DAYLIGHT
+DTSTART:19870329T020000
+TZOFFSETFROM:+0100
+TZOFFSETTO:+0200
+RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU;COUNT=3
+END:DAYLIGHT
+BEGIN:STANDARD
+DTSTART:19870927T030000
+TZOFFSETFROM:+0200
+TZOFFSETTO:+0100
+RRULE:FREQ=YEARLY;BYMONTH=9;BYDAY=-1SU;COUNT=3
+END:STANDARD
+END:VTIMEZONE
+END:VCALENDAR
+`
+
+func timezoneCalendar(t *testing.T) *ical.Calendar {
+	t.Helper()
+	cal, err := ical.NewDecoder(strings.NewReader(strings.ReplaceAll(timezones, "\n", "\r\n"))).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func timeProp(value string, params map[string]string) *ical.Prop {
+	prop := ical.NewProp(ical.PropDue)
+	prop.Value = value
+	for name, param := range params {
+		prop.Params.Set(name, param)
+	}
+	return prop
+}
+
+func setAllDayTime(t *testing.T, value string) {
+	viper.Set("allday_time", value)
+	t.Cleanup(func() { viper.Set("allday_time", "") })
+}
+
+func TestParseTimeProp(t *testing.T) {
+	cal := timezoneCalendar(t)
+
+	tests := []struct {
+		name    string
+		value   string
+		params  map[string]string
+		allDay  string
+		want    time.Time
+		wantErr bool
+	}{
+		{
+			name:  "utc",
+			value: "20250613T090000Z",
+			want:  time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "floating time is read in the configured zone",
+			value: "20250613T090000",
+			want:  time.Date(2025, 6, 12, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "date",
+			value: "20250613",
+			want:  time.Date(2025, 6, 12, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "date marked as date",
+			value:  "20250613",
+			params: map[string]string{ical.ParamValue: "DATE"},
+			want:   time.Date(2025, 6, 12, 14, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "date at the all day time",
+			value:  "20250613",
+			allDay: "09:30",
+			want:   time.Date(2025, 6, 12, 23, 30, 0, 0, time.UTC),
+		},
+		{
+			name:   "tzid from the tz database",
+			value:  "20250613T090000",
+			params: map[string]string{ical.PropTimezoneID: "Europe/Berlin"},
+			want:   time.Date(2025, 6, 13, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "vtimezone in standard time",
+			value:  "20250613T090000",
+			params: map[string]string{ical.PropTimezoneID: "Outlook Sydney"},
+			want:   time.Date(2025, 6, 12, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "vtimezone in daylight time",
+			value:  "20250113T090000",
+			params: map[string]string{ical.PropTimezoneID: "Outlook Sydney"},
+			want:   time.Date(2025, 1, 12, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "vtimezone rule limited by count",
+			value:  "20200701T120000",
+			params: map[string]string{ical.PropTimezoneID: "Short Lived DST"},
+			want:   time.Date(2020, 7, 1, 11, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "vtimezone rule within its count",
+			value:  "19880701T120000",
+			params: map[string]string{ical.PropTimezoneID: "Short Lived DST"},
+			want:   time.Date(1988, 7, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "unknown tzid",
+			value:   "20250613T090000",
+			params:  map[string]string{ical.PropTimezoneID: "Nowhere"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			value:   "2025-06-13",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAllDayTime(t, tt.allDay)
+			got, err := parseTimeProp(timeProp(tt.value, tt.params), cal)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTimeProp(t *testing.T) {
+	cal := timezoneCalendar(t)
+
+	tests := []struct {
+		name      string
+		existing  *ical.Prop
+		allDay    string
+		value     time.Time
+		wantValue string
+		wantTZID  string
+	}{
+		{
+			name:      "new property is written in utc",
+			value:     time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000Z",
+		},
+		{
+			name:      "utc stays utc",
+			existing:  timeProp("20250101T000000Z", nil),
+			value:     time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000Z",
+		},
+		{
+			name:      "date stays a date",
+			existing:  timeProp("20250101", nil),
+			value:     time.Date(2025, 6, 12, 14, 0, 0, 0, time.UTC),
+			wantValue: "20250613",
+		},
+		{
+			name:      "date at the all day time stays a date",
+			existing:  timeProp("20250101", nil),
+			allDay:    "09:30",
+			value:     time.Date(2025, 6, 12, 23, 30, 0, 0, time.UTC),
+			wantValue: "20250613",
+		},
+		{
+			name:      "date given a time of day becomes a date-time",
+			existing:  timeProp("20250101", nil),
+			value:     time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000Z",
+		},
+		{
+			name:      "floating stays floating",
+			existing:  timeProp("20250101T080000", nil),
+			value:     time.Date(2025, 6, 12, 23, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000",
+		},
+		{
+			name:      "tzid from the tz database is kept",
+			existing:  timeProp("20250101T080000", map[string]string{ical.PropTimezoneID: "Europe/Berlin"}),
+			value:     time.Date(2025, 6, 13, 7, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000",
+			wantTZID:  "Europe/Berlin",
+		},
+		{
+			name:      "vtimezone is kept",
+			existing:  timeProp("20250101T080000", map[string]string{ical.PropTimezoneID: "Outlook Sydney"}),
+			value:     time.Date(2025, 1, 12, 22, 0, 0, 0, time.UTC),
+			wantValue: "20250113T090000",
+			wantTZID:  "Outlook Sydney",
+		},
+		{
+			name:      "unknown tzid is replaced by utc",
+			existing:  timeProp("20250101T080000", map[string]string{ical.PropTimezoneID: "Nowhere"}),
+			value:     time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC),
+			wantValue: "20250613T090000Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAllDayTime(t, tt.allDay)
+			props := ical.Props{}
+			if tt.existing != nil {
+				props.Set(tt.existing)
+			}
+
+			setTimeProp(&props, ical.PropDue, tt.value, cal)
+
+			prop := props.Get(ical.PropDue)
+			if prop.Value != tt.wantValue {
+				t.Errorf("value = %q, want %q", prop.Value, tt.wantValue)
+			}
+			if got := prop.Params.Get(ical.PropTimezoneID); got != tt.wantTZID {
+				t.Errorf("TZID = %q, want %q", got, tt.wantTZID)
+			}
+			got, err := parseTimeProp(prop, cal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.value) {
+				t.Errorf("read back %v, want %v", got.UTC(), tt.value)
+			}
+		})
+	}
+}
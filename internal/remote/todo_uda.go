@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	"github.com/emersion/go-ical"
+)
+
+func updatePropsWithUDAs(props *ical.Props, t task.Task) {
+	for _, m := range uda.Mappings() {
+		value, exists := t.UDAs()[m.Name]
+		if !exists {
+			props.Del(m.Property)
+			continue
+		}
+		props.Set(createUDAProp(m.Property, m.Type, value))
+	}
+}
+
+func createUDAProp(name string, typ uda.Type, value string) *ical.Prop {
+	prop := ical.NewProp(name)
+	switch typ {
+	case uda.TypeNumeric:
+		prop.SetValueType(ical.ValueFloat)
+		prop.Value = value
+	case uda.TypeDate:
+		if t, err := time.Parse(taskwarrior.TimeLayout, value); err == nil {
+			prop.SetDateTime(t)
+		} else {
+			prop.SetText(value)
+		}
+	case uda.TypeDuration:
+		prop.SetValueType(ical.ValueDuration)
+		prop.Value = value
+	default:
+		if prop.ValueType() == ical.ValueURI {
+			prop.Value = value
+		} else {
+			prop.SetText(value)
+		}
+	}
+	return prop
+}
+
+func readUDAProp(prop *ical.Prop, typ uda.Type) (string, error) {
+	switch typ {
+	case uda.TypeDate:
+		t, err := prop.DateTime(time.UTC)
+		if err != nil {
+			return "", err
+		}
+		return t.UTC().Format(taskwarrior.TimeLayout), nil
+	case uda.TypeNumeric, uda.TypeDuration:
+		return uda.Normalise(typ, prop.Value)
+	default:
+		if prop.ValueType() == ical.ValueURI {
+			return prop.Value, nil
+		}
+		return prop.Text()
+	}
+}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// State is everything tw-caldav remembers between runs
+type State struct {
+	// TagAliases maps taskwarrior tags to the remote category names
+	// they were created from
+	TagAliases map[string]string `json:"tagAliases,omitempty"`
+	// Calendars binds taskwarrior projects to the path of the remote
+	// calendar they are synced with, tasks without a project use ""
+	Calendars map[string]string `json:"calendars,omitempty"`
+	// Runs are the most recent syncs, oldest first
+	Runs []Run `json:"runs,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// maxRuns is the number of syncs kept in the run history
+const maxRuns = 20
+
+// Run records a sync
+type Run struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Changes is the number of tasks created, updated or deleted
+	Changes int `json:"changes"`
+	// Error is set when the sync failed
+	Error string `json:"error,omitempty"`
+	// Failed holds the tasks that couldn't be synced, by uuid or remote
+	// path, with the reason
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// Finished returns when the run ended
+func (r Run) Finished() time.Time {
+	return r.Started.Add(r.Duration)
+}
+
+// AddRun adds a sync to the run history, dropping the oldest runs
+func (s *State) AddRun(r Run) error {
+	return s.Update(func(s *State) {
+		s.Runs = append(s.Runs, r)
+		if len(s.Runs) > maxRuns {
+			s.Runs = s.Runs[len(s.Runs)-maxRuns:]
+		}
+	})
+}
+
+// LastRun returns the most recent sync, and the most recent one that
+// didn't fail
+func (s *State) LastRun() (last *Run, lastSuccess *Run) {
+	s.Read(func(s *State) {
+		for i := len(s.Runs) - 1; i >= 0; i-- {
+			r := s.Runs[i]
+			if last == nil {
+				last = &r
+			}
+			if r.Error == "" {
+				lastSuccess = &r
+				return
+			}
+		}
+	})
+	return last, lastSuccess
+}
+
+var (
+	current     *State
+	currentErr  error
+	currentOnce sync.Once
+)
+
+// Dir returns the directory state is kept in, configured with the
+// state_dir key. Defaults to $XDG_STATE_HOME/tw-caldav.
+func Dir() (string, error) {
+	if dir := viper.GetString("state_dir"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "tw-caldav"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("While finding home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "tw-caldav"), nil
+}
+
+// Get returns the state of this process, loading it on first use
+func Get() (*State, error) {
+	currentOnce.Do(func() {
+		dir, err := Dir()
+		if err != nil {
+			currentErr = err
+			return
+		}
+		current, currentErr = Load(filepath.Join(dir, "state.json"))
+	})
+	return current, currentErr
+}
+
+// Load reads state from a file, a missing file is empty state
+func Load(path string) (*State, error) {
+	s := &State{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.init()
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("While reading state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("While parsing state %s: %w", path, err)
+	}
+	s.init()
+	return s, nil
+}
+
+func (s *State) init() {
+	if s.TagAliases == nil {
+		s.TagAliases = map[string]string{}
+	}
+	if s.Calendars == nil {
+		s.Calendars = map[string]string{}
+	}
+}
+
+// Update changes the state while holding its lock and saves it
+func (s *State) Update(change func(s *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(s)
+	return s.save()
+}
+
+// Read looks at the state while holding its lock
+func (s *State) Read(read func(s *State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	read(s)
+}
+
+func (s *State) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("While creating state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("While writing state: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+)
+
+// CalendarInfo describes a remote calendar and how it is synced
+type CalendarInfo struct {
+	remote.Calendar
+	Items int
+	// Project is the taskwarrior project the calendar is synced with,
+	// when Synced is set
+	Project string
+	Synced  bool
+}
+
+// ListCalendars returns every calendar of the remote, including the ones
+// that aren't synced
+func ListCalendars(rs *remote.Service) ([]CalendarInfo, error) {
+	calendars, err := rs.Backend.ListCalendars()
+	if err != nil {
+		return nil, fmt.Errorf("While listing calendars: %w", err)
+	}
+	infos := []CalendarInfo{}
+	for _, cal := range calendars {
+		info := CalendarInfo{Calendar: cal}
+		info.Project, info.Synced = rs.ProjectOf(cal)
+		if cal.SupportsTodos() {
+			items, err := rs.Backend.ListItems(cal)
+			if err != nil {
+				return nil, fmt.Errorf("While listing items of %s: %w", cal.Path, err)
+			}
+			info.Items = len(items)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// TasksInCalendar returns the local tasks that are stored in a calendar,
+// or that belong to the project it is synced with
+func TasksInCalendar(store local.Store, rs *remote.Service, cal remote.Calendar) ([]task.Task, error) {
+	tasks, err := store.GetAllTasks()
+	if err != nil {
+		return nil, fmt.Errorf("While getting local tasks: %w", err)
+	}
+	project, synced := rs.ProjectOf(cal)
+	result := []task.Task{}
+	for _, t := range tasks {
+		inCalendar := t.RemotePath() != nil && strings.HasPrefix(*t.RemotePath(), cal.Path)
+		if inCalendar || (synced && t.Project() == project) {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+// UnlinkTasks clears the remote path of the tasks stored in a deleted
+// calendar, so the next sync creates them on the remote again instead of
+// deleting them
+func UnlinkTasks(store local.Store, cal remote.Calendar, tasks []task.Task) (int, error) {
+	changes := []local.Change{}
+	for _, t := range tasks {
+		if t.RemotePath() == nil || !strings.HasPrefix(*t.RemotePath(), cal.Path) {
+			continue
+		}
+		update := task.CreateShellTask(task.WithTask(t))
+		update.Task.RemotePath = nil
+		changes = append(changes, local.Change{Type: local.ChangeUpdate, Id: *t.LocalId(), Task: update})
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+	if _, err := store.ApplyChanges(changes); err != nil {
+		return 0, fmt.Errorf("While unlinking local tasks: %w", err)
+	}
+	return len(changes), nil
+}
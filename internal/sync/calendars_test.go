@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+)
+
+func TestUnlinkTasks(t *testing.T) {
+	sp := newTestSync(t)
+	localTask, _ := syncedTask(t, sp, "synced")
+	if _, err := sp.local.AddTask(newTask("not synced yet")); err != nil {
+		t.Fatal(err)
+	}
+	cal := sp.remote.Calendars[sp.remote.Projects[""]]
+
+	tasks, err := TasksInCalendar(sp.local, sp.remote, cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(tasks); got != 2 {
+		t.Fatalf("got %d tasks in the calendar, want 2", got)
+	}
+	if err := sp.remote.DeleteCalendar(cal); err != nil {
+		t.Fatal(err)
+	}
+	unlinked, err := UnlinkTasks(sp.local, cal, tasks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlinked != 1 {
+		t.Errorf("unlinked %d tasks, want 1", unlinked)
+	}
+	current, _ := sp.local.GetTask(*localTask.LocalId())
+	if current.RemotePath() != nil {
+		t.Errorf("remote path = %s, want none", *current.RemotePath())
+	}
+
+	if err := sp.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	current, _ = sp.local.GetTask(*localTask.LocalId())
+	if current.Status() == task.StatusDeleted {
+		t.Fatal("local task was deleted by the sync")
+	}
+	if current.RemotePath() == nil {
+		t.Fatal("local task wasn't created on the remote again")
+	}
+	if _, err := sp.remote.GetTodo("", *current.RemotePath(), *current.LocalId()); err != nil {
+		t.Errorf("remote todo: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+	"github.com/google/uuid"
+)
+
+// TaskPair is a task as it is locally and on the remote, either side is
+// nil when the task doesn't exist there
+type TaskPair struct {
+	Local  task.Task
+	Remote *remote.Todo
+}
+
+// FindTaskPair looks a task up on both sides by taskwarrior uuid or remote
+// path, without changing anything
+func FindTaskPair(ctx context.Context, uuidOrPath string) (TaskPair, error) {
+	store, err := NewLocalStore()
+	if err != nil {
+		return TaskPair{}, err
+	}
+	rs, err := NewReadOnlyRemoteService(ctx)
+	if err != nil {
+		return TaskPair{}, err
+	}
+
+	pair := TaskPair{}
+	tasks, err := store.GetAllTasks()
+	if err != nil {
+		return pair, fmt.Errorf("While getting local tasks: %w", err)
+	}
+	for _, t := range tasks {
+		if (t.LocalId() != nil && *t.LocalId() == uuidOrPath) || (t.RemotePath() != nil && *t.RemotePath() == uuidOrPath) {
+			pair.Local = t
+			break
+		}
+	}
+	if pair.Local == nil && uuid.Validate(uuidOrPath) == nil {
+		// Tasks that don't take part in syncing, like old completed ones
+		if t, err := store.GetTask(uuidOrPath); err == nil {
+			pair.Local = t
+		}
+	}
+
+	switch {
+	case pair.Local != nil && pair.Local.RemotePath() != nil:
+		todo, err := rs.GetTodo(pair.Local.Project(), *pair.Local.RemotePath(), *pair.Local.LocalId())
+		if err == nil {
+			pair.Remote = &todo
+		}
+	case pair.Local != nil:
+		todo, err := rs.FindTodo(*pair.Local.LocalId())
+		if err == nil {
+			pair.Remote = &todo
+		}
+	default:
+		todo, err := rs.GetTodo("", uuidOrPath, uuidOrPath)
+		if err == nil {
+			pair.Remote = &todo
+		}
+	}
+
+	if pair.Local == nil && pair.Remote != nil && pair.Remote.LocalId() != nil {
+		if t, err := store.GetTask(*pair.Remote.LocalId()); err == nil {
+			pair.Local = t
+		}
+	}
+	if pair.Local == nil && pair.Remote == nil {
+		return pair, fmt.Errorf("No task found for %q", uuidOrPath)
+	}
+	return pair, nil
+}
+
+// RawLocal returns the local task as the store keeps it
+func (p TaskPair) RawLocal() (string, error) {
+	raw, ok := p.Local.(local.RawTask)
+	if !ok {
+		return task.PrintTask(p.Local), nil
+	}
+	data, err := raw.Raw()
+	if err != nil {
+		return "", fmt.Errorf("While encoding local task: %w", err)
+	}
+	return string(data), nil
+}
+
+// RawRemote returns the calendar object of the remote todo
+func (p TaskPair) RawRemote() (string, error) {
+	buf := new(bytes.Buffer)
+	if err := ical.NewEncoder(buf).Encode(p.Remote.Item.Data); err != nil {
+		return "", fmt.Errorf("While encoding remote todo: %w", err)
+	}
+	return buf.String(), nil
+}
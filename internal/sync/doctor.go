@@ -0,0 +1,209 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/caldav"
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	"github.com/spf13/viper"
+)
+
+// minTaskVersion is the oldest taskwarrior that is known to work
+const minTaskVersion = "2.6.0"
+
+// maxClockSkew is how far the clocks of client and server may drift
+// apart, the newer side of a task is chosen by comparing modification
+// times
+const maxClockSkew = time.Minute
+
+type CheckResult int8
+
+const (
+	CheckPass CheckResult = iota
+	CheckFail
+	CheckSkip
+)
+
+func (r CheckResult) String() string {
+	switch r {
+	case CheckPass:
+		return "PASS"
+	case CheckFail:
+		return "FAIL"
+	default:
+		return "SKIP"
+	}
+}
+
+// Check is the outcome of one doctor check, Fix says how to solve a
+// failure
+type Check struct {
+	Name   string
+	Result CheckResult
+	Detail string
+	Fix    string
+}
+
+func pass(name string, detail string) Check {
+	return Check{Name: name, Result: CheckPass, Detail: detail}
+}
+
+func fail(name string, detail string, fix string) Check {
+	return Check{Name: name, Result: CheckFail, Detail: detail, Fix: fix}
+}
+
+func skip(name string, detail string) Check {
+	return Check{Name: name, Result: CheckSkip, Detail: detail}
+}
+
+// serverClock is implemented by backends that can tell the time of the
+// server
+type serverClock interface {
+	ServerTime() (time.Time, error)
+}
+
+// Doctor checks the setup without changing anything, not even creating
+// the default calendar
+func Doctor(ctx context.Context) []Check {
+	checks := checkTaskwarrior()
+	return append(checks, checkRemote(ctx)...)
+}
+
+func checkTaskwarrior() []Check {
+	if viper.GetString("backend") == "memory" {
+		return []Check{skip("taskwarrior", "the memory backend doesn't use taskwarrior")}
+	}
+
+	out, err := taskwarrior.Run("--version")
+	if err != nil {
+		return []Check{fail("taskwarrior", err.Error(), "Install taskwarrior and make sure the task binary is in your PATH")}
+	}
+	version := strings.TrimSpace(out)
+	checks := []Check{}
+	if versionAtLeast(version, minTaskVersion) {
+		checks = append(checks, pass("taskwarrior version", version))
+	} else {
+		checks = append(checks, fail("taskwarrior version", fmt.Sprintf("%s is older than %s", version, minTaskVersion), fmt.Sprintf("Upgrade taskwarrior to %s or newer", minTaskVersion)))
+	}
+
+	udas := map[string]string{"remotepath": "string", "lastsync": "date"}
+	names := []string{"remotepath", "lastsync"}
+	if viper.GetBool("sync_progress") {
+		udas["progress"] = "numeric"
+		names = append(names, "progress")
+	}
+	for _, name := range names {
+		checks = append(checks, checkUDA(name, udas[name]))
+	}
+	return checks
+}
+
+func checkUDA(name string, wantType string) Check {
+	check := fmt.Sprintf("uda %s", name)
+	fix := fmt.Sprintf("task config uda.%s.type %s", name, wantType)
+	out, err := taskwarrior.Run("_get", fmt.Sprintf("rc.uda.%s.type", name))
+	if err != nil {
+		return fail(check, strings.TrimSpace(out), fix)
+	}
+	switch got := strings.TrimSpace(out); got {
+	case wantType:
+		return pass(check, wantType)
+	case "":
+		return fail(check, "not defined in .taskrc", fix)
+	default:
+		return fail(check, fmt.Sprintf("type is %s instead of %s", got, wantType), fix)
+	}
+}
+
+func checkRemote(ctx context.Context) []Check {
+	rs, err := NewReadOnlyRemoteService(ctx)
+	if err != nil {
+		return []Check{fail("remote", err.Error(), remoteFix())}
+	}
+
+	checks := []Check{}
+	if cd, ok := rs.Backend.(*caldav.CalDavService); ok {
+		checks = append(checks, pass("remote", fmt.Sprintf("calendar home set %s, server %s", cd.BaseURL, cd.Quirks.Name)))
+	} else {
+		checks = append(checks, pass("remote", fmt.Sprintf("%d calendars", len(rs.Calendars))))
+	}
+
+	todoCalendars := 0
+	for _, cal := range rs.Calendars {
+		if cal.SupportsTodos() {
+			todoCalendars++
+		}
+	}
+	switch {
+	case len(rs.Calendars) == 0:
+		checks = append(checks, pass("todo calendars", "no calendars yet, the first sync creates one"))
+	case todoCalendars == 0:
+		checks = append(checks, fail("todo calendars", fmt.Sprintf("none of the %d calendars accept VTODO", len(rs.Calendars)), "Create a calendar for tasks with tw-caldav calendars create default, or in the web interface of the server. Some servers keep tasks in a separate calendar home, point url at it."))
+	default:
+		checks = append(checks, pass("todo calendars", fmt.Sprintf("%d of %d calendars accept VTODO", todoCalendars, len(rs.Calendars))))
+	}
+
+	clock, ok := rs.Backend.(serverClock)
+	if !ok {
+		return append(checks, skip("clock skew", "the remote has no clock of its own"))
+	}
+	serverTime, err := clock.ServerTime()
+	if err != nil {
+		return append(checks, fail("clock skew", err.Error(), "Check that the server sends a Date header"))
+	}
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew.Abs() > maxClockSkew {
+		return append(checks, fail("clock skew", fmt.Sprintf("the local clock is %s off from the server", skew), "Keep the clock in sync with NTP, for example with timedatectl set-ntp true"))
+	}
+	return append(checks, pass("clock skew", skew.String()))
+}
+
+// remoteFix says how to fix a remote that can't be opened
+func remoteFix() string {
+	switch viper.GetString("remote") {
+	case "vdir":
+		return "Set vdir_path to the directory of the vdir"
+	case "ics":
+		return "Set ics_path to the .ics file"
+	case "", "caldav":
+		return "Check url, user and the password. url takes the hostname of the server, your email address or the url of the calendar home set."
+	default:
+		return "Set remote to caldav, vdir, ics or memory"
+	}
+}
+
+// versionAtLeast compares dotted versions, missing parts count as 0 and
+// suffixes like -beta are ignored
+func versionAtLeast(version string, min string) bool {
+	parse := func(v string) []int {
+		parts := []int{}
+		for _, p := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+			digits := strings.IndexFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+			if digits >= 0 {
+				p = p[:digits]
+			}
+			n, _ := strconv.Atoi(p)
+			parts = append(parts, n)
+		}
+		return parts
+	}
+	a, b := parse(version), parse(min)
+	for i := range max(len(a), len(b)) {
+		x, y := 0, 0
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package sync
+
+import "testing"
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version string
+		min     string
+		want    bool
+	}{
+		{"2.6.0", "2.6.0", true},
+		{"2.6.2", "2.6.0", true},
+		{"2.5.3", "2.6.0", false},
+		{"3.0.0", "2.6.0", true},
+		{"2.10.0", "2.6.0", true},
+		{"1.9.9", "2.6.0", false},
+		{"3", "2.6.0", true},
+		{"2.6", "2.6.0", true},
+		{"2", "2.6.0", false},
+		{"2.6.0.1", "2.6.0", true},
+		{"v3.1.0", "2.6.0", true},
+		{"3.0.0-beta", "3.0.0", true},
+		{"2.6.0rc1", "2.6.1", false},
+		{"", "2.6.0", false},
+		{"task", "2.6.0", false},
+	}
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("versionAtLeast(%q, %q) = %v, want %v", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/karsai5/tw-caldav/internal/sync/priority"
 	"github.com/karsai5/tw-caldav/internal/sync/task"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -12,7 +13,7 @@ import (
 
 func DebugTask(t task.Task) {
 	tags := strings.Join(t.Tags(), ", ")
-	slog.Debug("Task", "desc", t.Description(), "project", t.Project(), "due", t.Due(), "priority", t.Priority(), "tags", tags)
+	slog.Debug("Task", "desc", t.Description(), "project", t.Project(), "due", t.Due(), "priority", priority.Current().Label(int(t.Priority())), "tags", tags)
 }
 
 func PrintTable(tasks []task.Task) {
@@ -37,7 +38,7 @@ func PrintTable(tasks []task.Task) {
 			localId = "✔️"
 		}
 
-		tab.AppendRow(table.Row{t.Status(), desc, t.Project(), t.Due(), t.Priority(), tags, t.LastModified(), remotePath, localId})
+		tab.AppendRow(table.Row{t.Status(), desc, t.Project(), t.Due(), priority.Current().Label(int(t.Priority())), tags, t.LastModified(), remotePath, localId})
 	}
 	tab.Render()
 }
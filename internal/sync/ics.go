@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/google/uuid"
+)
+
+// importNamespace is used to derive a stable uuid from UIDs that aren't
+// uuids, so importing the same file twice doesn't create duplicates
+var importNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/karsai5/tw-caldav/import"))
+
+// taskFinder is implemented by local stores that understand taskwarrior
+// filters
+type taskFinder interface {
+	FindTasks(filter string) ([]task.Task, error)
+}
+
+// Export writes the local tasks matching filter as a VCALENDAR of VTODOs.
+// Without a filter the tasks that take part in syncing are written.
+func Export(store local.Store, w io.Writer, filter string) (int, error) {
+	var tasks []task.Task
+	var err error
+	if filter == "" {
+		tasks, err = store.GetAllTasks()
+	} else if finder, ok := store.(taskFinder); ok {
+		tasks, err = finder.FindTasks(filter)
+	} else {
+		return 0, fmt.Errorf("The local backend doesn't support filters")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := remote.WriteTodos(w, tasks); err != nil {
+		return 0, err
+	}
+	return len(tasks), nil
+}
+
+type ImportResult struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// Import creates or updates local tasks from the VTODOs of an .ics file.
+// Todos are matched to tasks by their X-TASKWARRIOR-UUID or UID. When
+// project is set every task is put in it, otherwise the X-WR-CALNAME of
+// the file is used.
+func Import(store local.Store, r io.Reader, project string, dryRun bool) (ImportResult, error) {
+	result := ImportResult{}
+
+	todos, err := remote.ReadTodos(r)
+	if err != nil {
+		return result, err
+	}
+
+	var existingTasks []task.Task
+	if finder, ok := store.(taskFinder); ok {
+		existingTasks, err = finder.FindTasks("")
+	} else {
+		existingTasks, err = store.GetAllTasks()
+	}
+	if err != nil {
+		return result, err
+	}
+	existing := createMapOfTasks(existingTasks)
+
+	changes := []local.Change{}
+	seen := map[string]bool{}
+	for i := range todos {
+		todo := &todos[i]
+		id := importId(todo)
+		if seen[id] {
+			slog.Error("Skipping todo with duplicate UID", "uid", todo.UID(), "task", todo.Description())
+			continue
+		}
+		seen[id] = true
+
+		update := task.CreateShellTask(task.WithTask(todo), task.WithLocalId(id))
+		if project != "" {
+			update.Task.Project = project
+		}
+
+		current, exists := existing[id]
+		if !exists {
+			slog.Info("Creating local task", "task", update.Description(), "uuid", id)
+			changes = append(changes, local.Change{Type: local.ChangeAdd, Task: update})
+			result.Created++
+			continue
+		}
+
+		// The task keeps its link to the remote todo
+		update.Task.RemotePath = current.RemotePath()
+		if task.Equal(current, update) {
+			result.Unchanged++
+			continue
+		}
+		slog.Info("Updating local task", "task", update.Description(), "uuid", id)
+		changes = append(changes, local.Change{Type: local.ChangeUpdate, Id: id, Task: update})
+		result.Updated++
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if _, err := store.ApplyChanges(changes); err != nil {
+		return result, fmt.Errorf("While importing tasks: %w", err)
+	}
+	return result, nil
+}
+
+// importId returns the uuid of the local task a todo is imported as
+func importId(t *remote.Todo) string {
+	if id := t.LocalId(); id != nil {
+		return *id
+	}
+	uid := t.UID()
+	if uid == "" {
+		slog.Error("Todo has no UID, it will be created again on the next import", "task", t.Description())
+		return uuid.NewString()
+	}
+	if parsed, err := uuid.Parse(uid); err == nil {
+		return parsed.String()
+	}
+	return uuid.NewSHA1(importNamespace, []byte(uid)).String()
+}
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/local/memory"
+)
+
+func TestExportImport(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []string
+	}{
+		{"no tasks", nil},
+		{"tasks", []string{"Water the plants", "Buy milk"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.New()
+			for _, desc := range tt.tasks {
+				if _, err := store.AddTask(newTask(desc)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			buf := new(bytes.Buffer)
+			n, err := Export(store, buf, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(tt.tasks) {
+				t.Errorf("exported %d tasks, want %d", n, len(tt.tasks))
+			}
+			if !strings.HasPrefix(buf.String(), "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(buf.String(), "END:VCALENDAR\r\n") {
+				t.Errorf("not a VCALENDAR:\n%s", buf.String())
+			}
+
+			result, err := Import(memory.New(), buf, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Created != len(tt.tasks) {
+				t.Errorf("imported %d tasks, want %d", result.Created, len(tt.tasks))
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/manifoldco/promptui"
@@ -17,3 +18,9 @@ func yesNo() bool {
     }
     return result == "Yes"
 }
+
+// Confirm asks a yes or no question
+func Confirm(question string) bool {
+	fmt.Println(question)
+	return yesNo()
+}
@@ -0,0 +1,20 @@
+package sync
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "tw-caldav-state")
+	if err != nil {
+		panic(err)
+	}
+	viper.Set("state_dir", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,196 @@
+package priority
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultMap follows RFC 5545, 1-4 is high, 5 is medium and 6-9 is low
+const DefaultMap = "H:1-4@1,M:5,L:6-9@9"
+
+// Level is a local priority and the range of iCalendar priorities
+// (1 highest, 9 lowest) that map to it. Value is the iCalendar priority
+// written for the level.
+type Level struct {
+	Label string
+	Min   int
+	Max   int
+	Value int
+}
+
+// Mapping converts between the iCalendar 0-9 scale and the local
+// priority levels. When UDA is set, the levels are stored in that UDA
+// instead of the built in taskwarrior priority.
+type Mapping struct {
+	UDA    string
+	Levels []Level
+}
+
+var (
+	current     Mapping
+	currentOnce sync.Once
+)
+
+// Current returns the mapping configured with the priority_map and
+// priority_uda keys, e.g.
+//
+//	priority_map=H:1-3@1,M:4-6@5,L:7-9@9
+//	priority_uda=importance
+//
+// Without a priority_map the standard H/M/L mapping is used, or a one to
+// one mapping of 1-9 when a priority UDA is set.
+func Current() Mapping {
+	currentOnce.Do(func() {
+		config := viper.GetString("priority_map")
+		udaName := viper.GetString("priority_uda")
+		if config == "" {
+			config = DefaultMap
+			if udaName != "" {
+				config = "1:1,2:2,3:3,4:4,5:5,6:6,7:7,8:8,9:9"
+			}
+		}
+
+		levels, err := Parse(config)
+		if err != nil {
+			slog.Error("Could not parse priority_map, using default", "err", err)
+			levels, _ = Parse(DefaultMap)
+		}
+		current = Mapping{UDA: udaName, Levels: levels}
+	})
+	return current
+}
+
+// Parse reads levels in the form label:min-max@value. The range can be a
+// single number and the value defaults to the start of the range.
+func Parse(config string) ([]Level, error) {
+	levels := []Level{}
+	seen := map[int]string{}
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		label, rangeAndValue, found := strings.Cut(entry, ":")
+		if !found || label == "" {
+			return nil, fmt.Errorf("invalid priority level %q", entry)
+		}
+		rangeStr, valueStr, hasValue := strings.Cut(rangeAndValue, "@")
+		minStr, maxStr, isRange := strings.Cut(rangeStr, "-")
+		if !isRange {
+			maxStr = minStr
+		}
+
+		level := Level{Label: label}
+		var err error
+		if level.Min, err = parseValue(minStr); err != nil {
+			return nil, err
+		}
+		if level.Max, err = parseValue(maxStr); err != nil {
+			return nil, err
+		}
+		if level.Min > level.Max {
+			return nil, fmt.Errorf("invalid priority range %q", rangeStr)
+		}
+		level.Value = level.Min
+		if hasValue {
+			if level.Value, err = parseValue(valueStr); err != nil {
+				return nil, err
+			}
+			if level.Value < level.Min || level.Value > level.Max {
+				return nil, fmt.Errorf("priority value %d is outside of range %q", level.Value, rangeStr)
+			}
+		}
+
+		for i := level.Min; i <= level.Max; i++ {
+			if other, exists := seen[i]; exists {
+				return nil, fmt.Errorf("priority %d is mapped to both %q and %q", i, other, label)
+			}
+			seen[i] = label
+		}
+		levels = append(levels, level)
+	}
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("no priority levels configured")
+	}
+	return levels, nil
+}
+
+func parseValue(str string) (int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(str))
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q: %w", str, err)
+	}
+	if value < 1 || value > 9 {
+		return 0, fmt.Errorf("priority %d is outside of 1-9", value)
+	}
+	return value, nil
+}
+
+// Label returns the local level for an iCalendar priority. Priorities
+// that aren't covered by any level use the closest one. Zero means
+// undefined and returns an empty label.
+func (m Mapping) Label(value int) string {
+	level := m.level(value)
+	if level == nil {
+		return ""
+	}
+	return level.Label
+}
+
+// Value returns the iCalendar priority written for a local level, or 0
+// if the level is unknown.
+func (m Mapping) Value(label string) int {
+	for _, level := range m.Levels {
+		if strings.EqualFold(level.Label, label) {
+			return level.Value
+		}
+	}
+	return 0
+}
+
+// IsLossless reports whether an iCalendar priority survives a round trip
+// through the local levels unchanged.
+func (m Mapping) IsLossless(value int) bool {
+	if value == 0 {
+		return true
+	}
+	return m.Value(m.Label(value)) == value
+}
+
+// Equivalent reports whether two iCalendar priorities map to the same
+// local level.
+func (m Mapping) Equivalent(a, b int) bool {
+	return m.Label(a) == m.Label(b)
+}
+
+func (m Mapping) level(value int) *Level {
+	if value <= 0 {
+		return nil
+	}
+	var closest *Level
+	closestDistance := 10
+	for i, level := range m.Levels {
+		if value >= level.Min && value <= level.Max {
+			return &m.Levels[i]
+		}
+		distance := min(abs(value-level.Min), abs(value-level.Max))
+		if distance < closestDistance {
+			closest = &m.Levels[i]
+			closestDistance = distance
+		}
+	}
+	return closest
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,91 @@
+package priority
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		config  string
+		want    []Level
+		wantErr bool
+	}{
+		{
+			config: DefaultMap,
+			want: []Level{
+				{Label: "H", Min: 1, Max: 4, Value: 1},
+				{Label: "M", Min: 5, Max: 5, Value: 5},
+				{Label: "L", Min: 6, Max: 9, Value: 9},
+			},
+		},
+		{
+			config: " H:1-3 , M:4-6@5,",
+			want: []Level{
+				{Label: "H", Min: 1, Max: 3, Value: 1},
+				{Label: "M", Min: 4, Max: 6, Value: 5},
+			},
+		},
+		{config: "", wantErr: true},
+		{config: "H", wantErr: true},
+		{config: ":1", wantErr: true},
+		{config: "H:0", wantErr: true},
+		{config: "H:10", wantErr: true},
+		{config: "H:4-1", wantErr: true},
+		{config: "H:1-4@5", wantErr: true},
+		{config: "H:1-4,M:4-5", wantErr: true},
+		{config: "H:one", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.config, func(t *testing.T) {
+			got, err := Parse(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping(t *testing.T) {
+	levels, err := Parse("H:1-3@1,M:5,L:7-9@9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Mapping{Levels: levels}
+
+	tests := []struct {
+		value    int
+		label    string
+		lossless bool
+	}{
+		{0, "", true},
+		{1, "H", true},
+		{2, "H", false},
+		{4, "H", false},
+		{5, "M", true},
+		{6, "M", false},
+		{9, "L", true},
+	}
+	for _, tt := range tests {
+		if got := m.Label(tt.value); got != tt.label {
+			t.Errorf("Label(%d) = %q, want %q", tt.value, got, tt.label)
+		}
+		if got := m.IsLossless(tt.value); got != tt.lossless {
+			t.Errorf("IsLossless(%d) = %v, want %v", tt.value, got, tt.lossless)
+		}
+	}
+
+	if got := m.Value("m"); got != 5 {
+		t.Errorf("Value(m) = %d, want 5", got)
+	}
+	if got := m.Value("urgent"); got != 0 {
+		t.Errorf("Value(urgent) = %d, want 0", got)
+	}
+	if !m.Equivalent(2, 3) || m.Equivalent(3, 5) {
+		t.Error("Equivalent doesn't follow the levels")
+	}
+}
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/spf13/viper"
+)
+
+// propagateRenames applies renamed calendars to the local project and
+// renamed projects to the calendar, so a rename is a single change
+// instead of every task moving. It returns whether anything was renamed.
+func (sp SyncProcess) propagateRenames(localTasks []task.Task, remoteTodos []remote.Todo) (renamed bool, err error) {
+	remoteRenames := sp.remote.RenamedCalendars()
+	for _, from := range slices.Sorted(maps.Keys(remoteRenames)) {
+		to := remoteRenames[from]
+		if existing, taken := sp.remote.Projects[to]; taken {
+			slog.Warn("Calendar was renamed after a project that is synced with another calendar, it is left alone", "path", sp.remote.Projects[from], "project", to, "synced", existing)
+			continue
+		}
+		if sp.Interactive && !Confirm(fmt.Sprintf("Calendar of project %q was renamed, would you like to rename the project to %q?", from, to)) {
+			continue
+		}
+		slog.Info("Renaming local project", "from", from, "to", to)
+		if err := local.RenameProject(sp.local, from, to); err != nil {
+			return renamed, fmt.Errorf("While renaming local project: %w", err)
+		}
+		if err := sp.remote.RebindProject(from, to); err != nil {
+			return renamed, err
+		}
+		renamed = true
+	}
+	if renamed {
+		localTasks, err = sp.local.GetAllTasks()
+		if err != nil {
+			return renamed, err
+		}
+	}
+
+	localRenames := findLocalRenames(sp.remote, localTasks, remoteTodos)
+	for _, from := range slices.Sorted(maps.Keys(localRenames)) {
+		to := localRenames[from]
+		if sp.Interactive && !Confirm(fmt.Sprintf("Project %q was renamed, would you like to rename its calendar to %q?", from, to)) {
+			continue
+		}
+		slog.Info("Renaming calendar", "path", sp.remote.Projects[from], "from", from, "to", to)
+		if err := sp.remote.RenameProject(from, to); err != nil {
+			return renamed, err
+		}
+		renamed = true
+	}
+	return renamed, nil
+}
+
+// findLocalRenames returns the projects that have been renamed locally,
+// with their new name. A project counts as renamed when every synced task
+// in its calendar now has the same project, and that project has no
+// calendar yet.
+func findLocalRenames(rs *remote.Service, localTasks []task.Task, remoteTodos []remote.Todo) map[string]string {
+	localTaskMap := createMapOfTasks(localTasks)
+	projects := map[string]string{}
+	candidates := map[string]bool{}
+	for i := range remoteTodos {
+		todo := &remoteTodos[i]
+		from := todo.Project()
+		if from == "" || todo.LocalId() == nil {
+			continue
+		}
+		lt, exists := localTaskMap[*todo.LocalId()]
+		if !exists {
+			// Deleted locally, the todo is removed by the sync
+			continue
+		}
+		to, seen := projects[from]
+		switch {
+		case !seen:
+			projects[from] = lt.Project()
+			candidates[from] = true
+		case to != lt.Project():
+			candidates[from] = false
+		}
+	}
+
+	renames := map[string]string{}
+	for from, to := range projects {
+		if !candidates[from] || to == "" || to == from {
+			continue
+		}
+		if _, taken := rs.Projects[to]; taken {
+			continue
+		}
+		renames[from] = to
+	}
+	for from, to := range renames {
+		for other, otherTo := range renames {
+			if other != from && otherTo == to {
+				// Two projects merged into one, the tasks are moved instead
+				delete(renames, from)
+				delete(renames, other)
+			}
+		}
+	}
+	return renames
+}
+
+// collectEmptyCalendars deletes the calendars of projects that have no
+// tasks left, when enabled with the gc_calendars key. The default
+// calendar is always kept.
+func (sp SyncProcess) collectEmptyCalendars() error {
+	if !viper.GetBool("gc_calendars") {
+		return nil
+	}
+	localTasks, err := sp.local.GetAllTasks()
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, t := range localTasks {
+		used[t.Project()] = true
+	}
+
+	for _, project := range slices.Sorted(maps.Keys(sp.remote.Projects)) {
+		if project == "" || used[project] {
+			continue
+		}
+		cal := sp.remote.Calendars[sp.remote.Projects[project]]
+		if cal.ReadOnly {
+			continue
+		}
+		items, err := sp.remote.Backend.ListItems(cal)
+		if err != nil {
+			return fmt.Errorf("While listing items of %s: %w", cal.Path, err)
+		}
+		if len(items) > 0 {
+			continue
+		}
+		if sp.Interactive && !Confirm(fmt.Sprintf("Calendar %q is empty, would you like to delete it?", cal.Name)) {
+			continue
+		}
+		if err := sp.remote.DeleteCalendar(cal); err != nil {
+			return err
+		}
+		slog.Info("Empty calendar deleted", "name", cal.Name, "path", cal.Path)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package sync
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+)
+
+func TestFindLocalRenames(t *testing.T) {
+	const id3 = "e4c1b2a3-9d8e-4f7a-8b6c-5d4e3f2a1b09"
+
+	type synced struct {
+		id, remoteProject, localProject string
+	}
+
+	tests := []struct {
+		name      string
+		tasks     []synced
+		calendars []string
+		deleted   []string
+		want      map[string]string
+	}{
+		{
+			name: "unchanged",
+			tasks: []synced{
+				{id1, "work", "work"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "every task of a project renamed",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "work", "job"},
+			},
+			want: map[string]string{"work": "job"},
+		},
+		{
+			name: "only some tasks moved",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "work", "work"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "tasks split over two projects",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "work", "office"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "new project already has a calendar",
+			tasks: []synced{
+				{id1, "work", "home"},
+			},
+			calendars: []string{"home"},
+			want:      map[string]string{},
+		},
+		{
+			name: "project removed from the tasks",
+			tasks: []synced{
+				{id1, "work", ""},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "tasks of the default calendar are ignored",
+			tasks: []synced{
+				{id1, "", "job"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "task deleted locally is ignored",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "work", "work"},
+			},
+			deleted: []string{id2},
+			want:    map[string]string{"work": "job"},
+		},
+		{
+			name: "two projects merged into one",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "office", "job"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "two projects renamed",
+			tasks: []synced{
+				{id1, "work", "job"},
+				{id2, "home", "house"},
+				{id3, "home", "house"},
+			},
+			want: map[string]string{"work": "job", "home": "house"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSync(t)
+			for _, project := range tt.calendars {
+				if _, err := sp.remote.FindOrCreateCalendar(project); err != nil {
+					t.Fatal(err)
+				}
+			}
+			localTasks := []task.Task{}
+			for _, s := range tt.tasks {
+				if _, err := sp.remote.CreateNewTodo(newTask(s.id, withId(s.id), withProject(s.remoteProject))); err != nil {
+					t.Fatal(err)
+				}
+				if !slices.Contains(tt.deleted, s.id) {
+					localTasks = append(localTasks, newTask(s.id, withId(s.id), withProject(s.localProject)))
+				}
+			}
+			remoteTodos, err := sp.remote.GetAllTodos()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := findLocalRenames(sp.remote, localTasks, remoteTodos)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPropagateRenames(t *testing.T) {
+	tests := []struct {
+		name            string
+		calendarName    string
+		localProject    string
+		wantRenamed     bool
+		wantProject     string
+		wantCalendar    string
+		wantCalendarFor string
+	}{
+		{
+			name:            "nothing renamed",
+			calendarName:    "work",
+			localProject:    "work",
+			wantProject:     "work",
+			wantCalendar:    "work",
+			wantCalendarFor: "work",
+		},
+		{
+			name:            "calendar renamed on the remote",
+			calendarName:    "job",
+			localProject:    "work",
+			wantRenamed:     true,
+			wantProject:     "job",
+			wantCalendar:    "job",
+			wantCalendarFor: "job",
+		},
+		{
+			name:            "project renamed locally",
+			calendarName:    "work",
+			localProject:    "job",
+			wantRenamed:     true,
+			wantProject:     "job",
+			wantCalendar:    "job",
+			wantCalendarFor: "job",
+		},
+		{
+			name:            "calendar renamed after a project with its own calendar",
+			calendarName:    "home",
+			localProject:    "work",
+			wantProject:     "work",
+			wantCalendar:    "home",
+			wantCalendarFor: "work",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSync(t)
+			if _, err := sp.remote.FindOrCreateCalendar("home"); err != nil {
+				t.Fatal(err)
+			}
+			id, err := sp.local.AddTask(newTask("report", withId(id1), withProject("work")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sp.remote.CreateNewTodo(newTask("report", withId(id1), withProject("work"))); err != nil {
+				t.Fatal(err)
+			}
+			path := sp.remote.Projects["work"]
+			cal := sp.remote.Calendars[path]
+			cal.Name = tt.calendarName
+			if err := sp.remote.UpdateCalendar(cal); err != nil {
+				t.Fatal(err)
+			}
+			localTask, _ := sp.local.GetTask(id)
+			if err := sp.local.UpdateTask(id, task.CreateShellTask(task.WithTask(localTask), task.WithProject(tt.localProject))); err != nil {
+				t.Fatal(err)
+			}
+
+			localTasks, err := sp.local.GetAllTasks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			remoteTodos, err := sp.remote.GetAllTodos()
+			if err != nil {
+				t.Fatal(err)
+			}
+			renamed, err := sp.propagateRenames(localTasks, remoteTodos)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if renamed != tt.wantRenamed {
+				t.Errorf("renamed = %v, want %v", renamed, tt.wantRenamed)
+			}
+			current, _ := sp.local.GetTask(id)
+			if got := current.Project(); got != tt.wantProject {
+				t.Errorf("local project = %q, want %q", got, tt.wantProject)
+			}
+			if got := sp.remote.Calendars[path].Name; got != tt.wantCalendar {
+				t.Errorf("calendar name = %q, want %q", got, tt.wantCalendar)
+			}
+			if got := sp.remote.Projects[tt.wantCalendarFor]; got != path {
+				t.Errorf("calendar of %q = %q, want %q", tt.wantCalendarFor, got, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/state"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+)
+
+// Status describes how far local tasks and the remote are out of sync
+type Status struct {
+	// LastRun is the most recent sync and LastSuccess the most recent one
+	// that didn't fail
+	LastRun     *state.Run `json:"lastRun,omitempty"`
+	LastSuccess *state.Run `json:"lastSuccess,omitempty"`
+	Reachable   bool       `json:"reachable"`
+	// Error is why the status couldn't be worked out
+	Error     string           `json:"error,omitempty"`
+	Calendars []StatusCalendar `json:"calendars"`
+	// Local are the local changes waiting to be sent to the remote,
+	// Remote the remote changes waiting to be applied locally
+	Local  PendingChanges `json:"local"`
+	Remote PendingChanges `json:"remote"`
+	// Conflicts are tasks changed on both sides since the last sync
+	Conflicts []StatusTask `json:"conflicts"`
+	// Quarantined are the tasks the last sync couldn't sync, with why
+	Quarantined map[string]string `json:"quarantined"`
+}
+
+// StatusCalendar is a calendar that is synced with a project
+type StatusCalendar struct {
+	Project string `json:"project"`
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Todos   int    `json:"todos"`
+}
+
+// StatusTask identifies a task
+type StatusTask struct {
+	Uuid        string `json:"uuid"`
+	Description string `json:"description"`
+}
+
+// PendingChanges counts the changes waiting on one side
+type PendingChanges struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+func (p PendingChanges) Total() int {
+	return p.Create + p.Update + p.Delete
+}
+
+// Exit codes of the status command
+const (
+	StatusInSync  = 0
+	StatusPending = 1
+	StatusError   = 2
+)
+
+// ExitCode returns StatusError when the remote can't be reached or the
+// last sync didn't go through, StatusPending when there are changes to
+// sync and StatusInSync otherwise
+func (s Status) ExitCode() int {
+	switch {
+	case !s.Reachable || s.Error != "" || len(s.Quarantined) > 0:
+		return StatusError
+	case s.LastRun != nil && s.LastRun.Error != "":
+		return StatusError
+	case s.Local.Total() > 0 || s.Remote.Total() > 0 || len(s.Conflicts) > 0:
+		return StatusPending
+	default:
+		return StatusInSync
+	}
+}
+
+// GetStatus works out what a sync would do without changing anything
+func GetStatus(ctx context.Context) Status {
+	status := Status{
+		Calendars:   []StatusCalendar{},
+		Conflicts:   []StatusTask{},
+		Quarantined: map[string]string{},
+	}
+
+	st, err := state.Get()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.readRuns(st)
+
+	rs, err := NewReadOnlyRemoteService(ctx)
+	if err != nil {
+		status.Error = fmt.Sprintf("While connecting to remote: %s", err)
+		return status
+	}
+	status.Reachable = true
+
+	store, err := NewLocalStore()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	if err := status.compare(store, rs); err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// readRuns takes the last runs and the tasks the last run couldn't sync
+// from the run history
+func (s *Status) readRuns(st *state.State) {
+	s.LastRun, s.LastSuccess = st.LastRun()
+	if s.LastRun != nil {
+		maps.Copy(s.Quarantined, s.LastRun.Failed)
+	}
+}
+
+// compare lists the synced calendars and counts the changes between the
+// local tasks and the remote todos
+func (s *Status) compare(store local.Store, rs *remote.Service) error {
+	localTasks, err := store.GetAllTasks()
+	if err != nil {
+		return fmt.Errorf("While getting local tasks: %w", err)
+	}
+	remoteTodos, err := rs.GetAllTodos()
+	if err != nil {
+		return fmt.Errorf("While getting remote todos: %w", err)
+	}
+
+	todos := map[string]int{}
+	remoteTasks := []task.Task{}
+	for i := range remoteTodos {
+		todos[remoteTodos[i].Calendar.Path]++
+		remoteTasks = append(remoteTasks, &remoteTodos[i])
+	}
+	for _, project := range slices.Sorted(maps.Keys(rs.Projects)) {
+		cal := rs.Calendars[rs.Projects[project]]
+		s.Calendars = append(s.Calendars, StatusCalendar{
+			Project: project,
+			Path:    cal.Path,
+			Name:    cal.Name,
+			Todos:   todos[cal.Path],
+		})
+	}
+
+	s.count(processTasks(localTasks, remoteTasks, rs.ProjectOfItem))
+	return nil
+}
+
+// count adds up the pending changes. Tasks changed on both sides since the
+// last successful sync are conflicts rather than updates.
+func (s *Status) count(groups processedTasksReturn) {
+	s.Local.Create += len(groups.newRemoteTasks)
+	s.Local.Delete += len(groups.remoteTasksToDelete)
+	s.Remote.Create += len(groups.newLocalTasks)
+	s.Remote.Delete += len(groups.localTasksToDelete)
+	s.Remote.Update += len(groups.movedTasks)
+
+	var lastSync time.Time
+	if s.LastSuccess != nil {
+		lastSync = s.LastSuccess.Finished()
+	}
+	for _, ttu := range groups.tasksToUpdate {
+		localChanged := ttu.localTask.LastModified().After(lastSync)
+		remoteChanged := ttu.remoteTask.LastModified().After(lastSync)
+		if s.LastSuccess != nil && localChanged && remoteChanged {
+			s.Conflicts = append(s.Conflicts, StatusTask{
+				Uuid:        *ttu.localTask.LocalId(),
+				Description: ttu.localTask.Description(),
+			})
+			continue
+		}
+		if ttu.updatedTask == ttu.remoteTask {
+			s.Remote.Update++
+		} else {
+			s.Local.Update++
+		}
+	}
+	slices.SortFunc(s.Conflicts, func(a, b StatusTask) int {
+		return strings.Compare(a.Uuid, b.Uuid)
+	})
+}
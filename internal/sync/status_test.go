@@ -0,0 +1,223 @@
+package sync
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/state"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/emersion/go-ical"
+)
+
+func newStatus() Status {
+	return Status{Reachable: true, Calendars: []StatusCalendar{}, Conflicts: []StatusTask{}, Quarantined: map[string]string{}}
+}
+
+func TestStatusReadRuns(t *testing.T) {
+	ok := state.Run{Started: syncTime, Duration: time.Second, Changes: 3}
+	later := state.Run{Started: syncTime.Add(time.Hour), Duration: time.Second}
+	failed := state.Run{Started: syncTime.Add(2 * time.Hour), Error: "remote unreachable"}
+	partial := state.Run{Started: syncTime.Add(3 * time.Hour), Failed: map[string]string{id1: "calendar is read-only"}}
+
+	tests := []struct {
+		name            string
+		runs            []state.Run
+		wantLast        *state.Run
+		wantSuccess     *state.Run
+		wantQuarantined map[string]string
+		wantExit        int
+	}{
+		{name: "never synced", wantQuarantined: map[string]string{}, wantExit: StatusInSync},
+		{name: "synced", runs: []state.Run{ok, later}, wantLast: &later, wantSuccess: &later, wantQuarantined: map[string]string{}, wantExit: StatusInSync},
+		{name: "last sync failed", runs: []state.Run{ok, failed}, wantLast: &failed, wantSuccess: &ok, wantQuarantined: map[string]string{}, wantExit: StatusError},
+		{name: "every sync failed", runs: []state.Run{failed}, wantLast: &failed, wantQuarantined: map[string]string{}, wantExit: StatusError},
+		{name: "tasks quarantined", runs: []state.Run{ok, failed, partial}, wantLast: &partial, wantSuccess: &partial, wantQuarantined: partial.Failed, wantExit: StatusError},
+		{name: "quarantine is lifted by the next run", runs: []state.Run{partial, later}, wantLast: &later, wantSuccess: &later, wantQuarantined: map[string]string{}, wantExit: StatusInSync},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := state.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range tt.runs {
+				if err := st.AddRun(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status := newStatus()
+			status.readRuns(st)
+
+			sameRun := func(name string, got, want *state.Run) {
+				if (got == nil) != (want == nil) || (got != nil && !got.Started.Equal(want.Started)) {
+					t.Errorf("%s = %+v, want %+v", name, got, want)
+				}
+			}
+			sameRun("LastRun", status.LastRun, tt.wantLast)
+			sameRun("LastSuccess", status.LastSuccess, tt.wantSuccess)
+			if !maps.Equal(status.Quarantined, tt.wantQuarantined) {
+				t.Errorf("Quarantined = %v, want %v", status.Quarantined, tt.wantQuarantined)
+			}
+			if got := status.ExitCode(); got != tt.wantExit {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestStatusCount(t *testing.T) {
+	lastSync := &state.Run{Started: syncTime}
+	update := func(desc string, id string, localMinutes int, remoteMinutes int, remoteWins bool) taskToUpdate {
+		localTask := newTask(desc, withId(id), modifiedAt(localMinutes))
+		remoteTask := newTask(desc+" changed", withId(id), modifiedAt(remoteMinutes))
+		if remoteWins {
+			return taskToUpdate{localTask: localTask, remoteTask: remoteTask, updatedTask: remoteTask}
+		}
+		return taskToUpdate{localTask: localTask, remoteTask: remoteTask, updatedTask: localTask}
+	}
+
+	tests := []struct {
+		name          string
+		lastSuccess   *state.Run
+		groups        processedTasksReturn
+		wantLocal     PendingChanges
+		wantRemote    PendingChanges
+		wantConflicts []string
+		wantExit      int
+	}{
+		{
+			name:        "in sync",
+			lastSuccess: lastSync,
+			wantExit:    StatusInSync,
+		},
+		{
+			name:        "creates, deletes and moves",
+			lastSuccess: lastSync,
+			groups: processedTasksReturn{
+				newRemoteTasks:      []task.Task{newTask("a"), newTask("b")},
+				remoteTasksToDelete: []task.Task{newTask("c")},
+				newLocalTasks:       []task.Task{newTask("d")},
+				localTasksToDelete:  []task.Task{newTask("e"), newTask("f")},
+				movedTasks:          []taskToUpdate{update("g", id1, 0, 5, true)},
+			},
+			wantLocal:  PendingChanges{Create: 2, Delete: 1},
+			wantRemote: PendingChanges{Create: 1, Update: 1, Delete: 2},
+			wantExit:   StatusPending,
+		},
+		{
+			name:        "changed locally",
+			lastSuccess: lastSync,
+			groups:      processedTasksReturn{tasksToUpdate: []taskToUpdate{update("a", id1, 10, -10, false)}},
+			wantLocal:   PendingChanges{Update: 1},
+			wantExit:    StatusPending,
+		},
+		{
+			name:        "changed remotely",
+			lastSuccess: lastSync,
+			groups:      processedTasksReturn{tasksToUpdate: []taskToUpdate{update("a", id1, -10, 10, true)}},
+			wantRemote:  PendingChanges{Update: 1},
+			wantExit:    StatusPending,
+		},
+		{
+			name:        "changed on both sides",
+			lastSuccess: lastSync,
+			groups: processedTasksReturn{tasksToUpdate: []taskToUpdate{
+				update("b", id2, 10, 20, true),
+				update("a", id1, 20, 10, false),
+			}},
+			wantConflicts: []string{id1 + " a", id2 + " b"},
+			wantExit:      StatusPending,
+		},
+		{
+			name:        "changed on both sides before the last sync",
+			lastSuccess: lastSync,
+			groups:      processedTasksReturn{tasksToUpdate: []taskToUpdate{update("a", id1, -20, -10, true)}},
+			wantRemote:  PendingChanges{Update: 1},
+			wantExit:    StatusPending,
+		},
+		{
+			name:      "never synced has no conflicts",
+			groups:    processedTasksReturn{tasksToUpdate: []taskToUpdate{update("a", id1, 20, 10, false)}},
+			wantLocal: PendingChanges{Update: 1},
+			wantExit:  StatusPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := newStatus()
+			status.LastRun, status.LastSuccess = tt.lastSuccess, tt.lastSuccess
+			status.count(tt.groups)
+
+			if status.Local != tt.wantLocal {
+				t.Errorf("Local = %+v, want %+v", status.Local, tt.wantLocal)
+			}
+			if status.Remote != tt.wantRemote {
+				t.Errorf("Remote = %+v, want %+v", status.Remote, tt.wantRemote)
+			}
+			conflicts := []string{}
+			for _, c := range status.Conflicts {
+				conflicts = append(conflicts, c.Uuid+" "+c.Description)
+			}
+			if len(conflicts) != len(tt.wantConflicts) {
+				t.Fatalf("Conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+			for i := range conflicts {
+				if conflicts[i] != tt.wantConflicts[i] {
+					t.Errorf("Conflicts = %v, want %v", conflicts, tt.wantConflicts)
+				}
+			}
+			if got := status.ExitCode(); got != tt.wantExit {
+				t.Errorf("ExitCode() = %d, want %d", got, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestStatusCompare(t *testing.T) {
+	sp := newTestSync(t)
+	rs := sp.remote
+
+	syncedTask(t, sp, "synced")
+	if _, err := sp.local.AddTask(newTask("local only")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rs.CreateNewTodo(newTask("deleted locally", withId(id2), withProject("work"))); err != nil {
+		t.Fatal(err)
+	}
+	data := remote.NewTodoCalendar(newTask("remote only"))
+	data.Children[0].Props.SetText(ical.PropUID, "khal-todo")
+	if _, err := rs.Backend.CreateItem(rs.Calendars[rs.Projects[""]], "khal-todo", data); err != nil {
+		t.Fatal(err)
+	}
+
+	status := newStatus()
+	if err := status.compare(sp.local, rs); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (PendingChanges{Create: 1, Delete: 1}); status.Local != want {
+		t.Errorf("Local = %+v, want %+v", status.Local, want)
+	}
+	if want := (PendingChanges{Create: 1}); status.Remote != want {
+		t.Errorf("Remote = %+v, want %+v", status.Remote, want)
+	}
+	if len(status.Calendars) != 2 {
+		t.Fatalf("Calendars = %+v", status.Calendars)
+	}
+	for i, want := range []struct {
+		project string
+		todos   int
+	}{{"", 2}, {"work", 1}} {
+		got := status.Calendars[i]
+		if got.Project != want.project || got.Todos != want.todos || got.Path != rs.Projects[want.project] {
+			t.Errorf("calendar %d = %+v, want project %q with %d todos", i, got, want.project, want.todos)
+		}
+	}
+}
@@ -1,39 +1,183 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/karsai5/tw-caldav/internal/auth"
 	"github.com/karsai5/tw-caldav/internal/caldav"
+	"github.com/karsai5/tw-caldav/internal/icsfile"
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/local/memory"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	remotememory "github.com/karsai5/tw-caldav/internal/remote/memory"
+	"github.com/karsai5/tw-caldav/internal/state"
 	"github.com/karsai5/tw-caldav/internal/sync/task"
 	"github.com/karsai5/tw-caldav/internal/tw"
+	"github.com/karsai5/tw-caldav/internal/vdir"
 
 	"github.com/spf13/viper"
 )
 
-func NewSyncProcess() (sp SyncProcess, err error) {
-	local := tw.Taskwarrior{}
-	remote, err := caldav.NewClient(viper.GetString("url"), viper.GetString("user"), viper.GetString("pass"))
+func NewSyncProcess(ctx context.Context) (sp SyncProcess, err error) {
+	if viper.GetString("backend") == "memory" {
+		// An empty local store makes every synced todo look deleted locally
+		return sp, fmt.Errorf("The memory backend can't be synced, it would delete every todo on the remote")
+	}
+	remoteName := viper.GetString("remote")
+	if remoteName == "memory" {
+		return sp, fmt.Errorf("The memory remote can't be synced, it would delete every synced task")
+	}
+	local, err := NewLocalStore()
+	if err != nil {
+		return sp, err
+	}
+	remote, err := NewRemoteService(ctx)
 	if err != nil {
 		return sp, err
 	}
 	return SyncProcess{
 		local:    local,
-		remote:   *remote,
+		remote:   remote,
 		synctime: time.Now(),
+		// A missing or moved file looks the same as a remote whose todos
+		// were all deleted
+		checkEmptyRemote: remoteName == "vdir" || remoteName == "ics",
 	}, err
 }
 
+// NewLocalStore returns the local store selected with the backend key.
+// The memory backend keeps tasks in memory only and starts empty on every
+// run, it can't be used to sync.
+func NewLocalStore() (local.Store, error) {
+	if viper.GetString("backend") == "memory" {
+		return memory.New(), nil
+	}
+	return tw.New()
+}
+
+// NewRemoteService returns the todos of the remote selected with the
+// remote key: "caldav" (the default), "vdir" to use the directory at
+// vdir_path, "ics" to use the single file at ics_path, or "memory" to keep
+// todos in memory only. The memory remote can't be synced.
+func NewRemoteService(ctx context.Context) (*remote.Service, error) {
+	backend, err := newRemoteBackend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewService(backend)
+}
+
+// NewReadOnlyRemoteService returns the todos of the remote selected with
+// the remote key, without creating the default calendar or saving project
+// bindings
+func NewReadOnlyRemoteService(ctx context.Context) (*remote.Service, error) {
+	backend, err := newRemoteBackend(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return remote.NewReadOnlyService(backend)
+}
+
+func newRemoteBackend(ctx context.Context) (remote.Backend, error) {
+	switch name := viper.GetString("remote"); name {
+	case "", "caldav":
+		address := viper.GetString("url")
+		if viper.GetString("user") == "" && strings.Contains(address, "@") && !strings.Contains(address, "://") {
+			// An email address is the username on most servers
+			viper.Set("user", address)
+		}
+		authenticator, err := auth.New()
+		if err != nil {
+			return nil, err
+		}
+		return caldav.NewClient(ctx, address, authenticator)
+	case "vdir":
+		return vdir.NewService(viper.GetString("vdir_path"))
+	case "ics":
+		return icsfile.NewService(viper.GetString("ics_path"))
+	case "memory":
+		return remotememory.New(), nil
+	default:
+		return nil, fmt.Errorf("Unknown remote %q", name)
+	}
+}
+
 type SyncProcess struct {
-	local       tw.Taskwarrior
-	remote      caldav.CalDavService
+	local       local.Store
+	remote      *remote.Service
 	synctime    time.Time
 	Interactive bool
+	// AllowEmptyRemote syncs with a remote without todos even though local
+	// tasks were synced to it, which deletes those tasks
+	AllowEmptyRemote bool
+	// checkEmptyRemote refuses to sync with an empty remote unless
+	// AllowEmptyRemote is set
+	checkEmptyRemote bool
+	// run records the sync in progress
+	run *state.Run
 }
 
+// Sync syncs local tasks with the remote and records the run in the run
+// history
 func (sp SyncProcess) Sync() error {
+	sp.run = &state.Run{Started: sp.synctime, Failed: map[string]string{}}
+	err := sp.sync()
 
+	sp.run.Duration = time.Since(sp.run.Started)
+	if err != nil {
+		sp.run.Error = err.Error()
+	}
+	st, stateErr := state.Get()
+	if stateErr == nil {
+		stateErr = st.AddRun(*sp.run)
+	}
+	if stateErr != nil {
+		slog.Error("Error saving run history", "err", stateErr)
+	}
+	return err
+}
+
+// record counts a task in the run, or notes why it couldn't be synced
+func (sp SyncProcess) record(t task.Task, err error) {
+	if sp.run == nil {
+		return
+	}
+	if err == nil {
+		sp.run.Changes++
+		return
+	}
+	key := t.Description()
+	if t.LocalId() != nil {
+		key = *t.LocalId()
+	} else if t.RemotePath() != nil {
+		key = *t.RemotePath()
+	}
+	sp.run.Failed[key] = err.Error()
+}
+
+// checkRemoteNotEmpty returns an error when the remote has no todos but
+// local tasks were synced to it, as syncing would delete all of them
+func (sp SyncProcess) checkRemoteNotEmpty(localTasks []task.Task, remoteTodos []remote.Todo) error {
+	if !sp.checkEmptyRemote || sp.AllowEmptyRemote || len(remoteTodos) > 0 {
+		return nil
+	}
+	synced := 0
+	for _, t := range localTasks {
+		if t.RemotePath() != nil {
+			synced++
+		}
+	}
+	if synced > 0 {
+		return fmt.Errorf("The remote has no todos but %d local tasks were synced to it, check the remote path or sync with --allow-empty-remote to delete them", synced)
+	}
+	return nil
+}
+
+func (sp SyncProcess) sync() error {
 	localTasks, err := sp.local.GetAllTasks()
 	if err != nil {
 		return err
@@ -41,12 +185,31 @@ func (sp SyncProcess) Sync() error {
 
 	remoteTodos, err := sp.remote.GetAllTodos()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := sp.checkRemoteNotEmpty(localTasks, remoteTodos); err != nil {
+		return err
+	}
+
+	renamed, err := sp.propagateRenames(localTasks, remoteTodos)
+	if err != nil {
+		return err
+	}
+	if renamed {
+		localTasks, err = sp.local.GetAllTasks()
+		if err != nil {
+			return err
+		}
 	}
 
-	slog.Info("Tasks found", "locally", len(localTasks), "remotely", len(remoteTodos))
+	remoteTasks := []task.Task{}
+	for i := range remoteTodos {
+		remoteTasks = append(remoteTasks, &remoteTodos[i])
+	}
+
+	slog.Info("Tasks found", "locally", len(localTasks), "remotely", len(remoteTasks))
 
-	taskGroups := processTasks(localTasks, remoteTodos)
+	taskGroups := processTasks(localTasks, remoteTasks, sp.remote.ProjectOfItem)
 
 	printTasks(taskGroups.newRemoteTasks, "Remote tasks to create")
 	printTasks(taskGroups.newLocalTasks, "Local tasks to create")
@@ -60,6 +223,17 @@ func (sp SyncProcess) Sync() error {
 		}
 	}
 
+	if size := len(taskGroups.movedTasks); size > 0 {
+		slog.Info("Remote tasks moved", "num", size)
+		err := sp.handleRemoteTaskMoves(taskGroups.movedTasks)
+		if err != nil {
+			slog.Error("Error updating moved tasks", "err", err)
+		}
+		for _, m := range taskGroups.movedTasks {
+			sp.record(m.localTask, err)
+		}
+	}
+
 	sp.handleTasks(taskGroups.newLocalTasks, sp.handleLocalTaskCreate, "Would you like to create local tasks?", "Creating local tasks")
 	sp.handleTasks(taskGroups.newRemoteTasks, sp.handleRemoteTaskCreate, "Would you like to create remote tasks?", "Creating remote tasks")
 
@@ -72,6 +246,7 @@ func (sp SyncProcess) Sync() error {
 			if err != nil {
 				slog.Error("Error updating task", "err", err)
 			}
+			sp.record(ttu.localTask, err)
 		}
 	}
 
@@ -92,6 +267,10 @@ func (sp SyncProcess) Sync() error {
 		}
 	}
 
+	if err := sp.collectEmptyCalendars(); err != nil {
+		slog.Error("Error deleting empty calendars", "err", err)
+	}
+
 	return nil
 }
 
@@ -102,6 +281,7 @@ func (sp SyncProcess) handleTasks(tasks []task.Task, handleFunc func(task.Task)
 			if err != nil {
 				slog.Error("Error processing task", "err", err)
 			}
+			sp.record(t, err)
 		}
 	}
 
@@ -131,6 +311,16 @@ func printTasks(tasks []task.Task, msg string) {
 func (sp SyncProcess) handleTaskUpdate(ttu taskToUpdate) error {
 	slog.Info("Updating task", "task", ttu.updatedTask.Description(), "path", *ttu.updatedTask.RemotePath(), "uuid", *ttu.updatedTask.LocalId())
 
+	// An edit made since the tasks were read would be overwritten, and lose
+	// against the newer remote on the next sync
+	current, err := sp.local.GetTask(*ttu.localTask.LocalId())
+	if err != nil {
+		return fmt.Errorf("While reading local task: %w", err)
+	}
+	if !current.LastModified().Equal(ttu.localTask.LastModified()) {
+		return fmt.Errorf("Task %s was changed locally during the sync, it is synced next time", *ttu.localTask.LocalId())
+	}
+
 	updatedTask, err := ttu.remoteTask.Update(ttu.updatedTask)
 	if err != nil {
 		return fmt.Errorf("While updating remote task: %w", err)
@@ -151,23 +341,38 @@ func (sp SyncProcess) handleTaskUpdate(ttu taskToUpdate) error {
 	return nil
 }
 
+// handleRemoteTaskMoves updates the remote path and project of tasks whose
+// todo has been moved on the remote, with a single write
+func (sp SyncProcess) handleRemoteTaskMoves(moves []taskToUpdate) error {
+	changes := []local.Change{}
+	for _, m := range moves {
+		slog.Info("Remote task moved", "task", m.updatedTask.Description(), "from", *m.localTask.RemotePath(), "to", *m.updatedTask.RemotePath())
+		changes = append(changes, local.Change{
+			Type: local.ChangeUpdate,
+			Id:   *m.localTask.LocalId(),
+			Task: m.updatedTask,
+		})
+	}
+	if _, err := sp.local.ApplyChanges(changes); err != nil {
+		return fmt.Errorf("While updating moved tasks: %w", err)
+	}
+	return nil
+}
+
 func (sp SyncProcess) AreTasksEqual(localTask task.Task, remoteTask task.Task) (bool, error) {
 	currentLocalTask, err := sp.local.GetTask(*localTask.LocalId())
 	if err != nil {
 		return false, err
 	}
-	currentRemoteTask, err := sp.remote.GetTodo(remoteTask.Project(), *remoteTask.RemotePath())
+	currentRemoteTask, err := sp.remote.GetTodo(remoteTask.Project(), *remoteTask.RemotePath(), *localTask.LocalId())
 	if err != nil {
 		return false, err
 	}
 
-	equal := task.Equal(&currentLocalTask, &currentRemoteTask)
-	if !equal {
-		slog.Debug("local", "task", task.PrintTask(&currentLocalTask))
-		slog.Debug("remot", "task", task.PrintTask(&currentRemoteTask))
-	}
+	diff := task.Diff(currentLocalTask, &currentRemoteTask)
+	debugDiff(diff)
 
-	return equal, nil
+	return len(diff) == 0, nil
 }
 
 func (sp SyncProcess) handleRemoteTaskCreate(lt task.Task) error {
@@ -194,7 +399,12 @@ func (sp SyncProcess) handleRemoteTaskCreate(lt task.Task) error {
 
 func (sp SyncProcess) handleLocalTaskCreate(t task.Task) error {
 	slog.Info("Creating local task", "task", t.Description())
-	localTaskToAdd := task.CreateShellTask(task.WithTask(t))
+	opts := []task.ShellTaskOption{task.WithTask(t)}
+	if id := localIdFromUID(t); id != "" {
+		// Found again by the next sync if the id can't be written back
+		opts = append(opts, task.WithLocalId(id))
+	}
+	localTaskToAdd := task.CreateShellTask(opts...)
 
 	uuid, err := sp.local.AddTask(localTaskToAdd)
 	if err != nil {
@@ -238,29 +448,44 @@ type processedTasksReturn struct {
 	localTasksToDelete  []task.Task
 	remoteTasksToDelete []task.Task
 	tasksToUpdate       []taskToUpdate
+	// movedTasks are tasks whose todo has been moved on the remote and
+	// that need nothing else, only the local task is updated
+	movedTasks []taskToUpdate
 }
 
-func processTasks(localTasks []tw.Task, remoteTodos []caldav.Todo) processedTasksReturn {
+// processTasks sorts tasks into the changes needed to sync them.
+// projectOf returns the project of the calendar an item path is in, it is
+// used to tell whether a task moved on the remote was moved locally too.
+func processTasks(localTasks []task.Task, remoteTasks []task.Task, projectOf func(path string) (string, bool)) processedTasksReturn {
 	localTasksToDelete := []task.Task{}
 	remoteTasksToDelete := []task.Task{}
 	remoteTasksToCreate := []task.Task{}
 	localTasksToCreate := []task.Task{}
 	tasksToUpdate := []taskToUpdate{}
+	movedTasks := []taskToUpdate{}
 
-	localTaskMap := mapOfLocalTasks(localTasks)
-	remoteTaskMap := mapOfRemoteTasks(remoteTodos)
+	localTaskMap := createMapOfTasks(localTasks)
+	remoteTaskMap := createMapOfTasks(remoteTasks)
 
-	// Get remote tasks with no id, these need to be created locally
-	for _, t := range remoteTodos {
-		if t.LocalId() == nil {
-			localTasksToCreate = append(localTasksToCreate, &t)
+	// Get remote tasks with no id, these need to be created locally unless
+	// an earlier sync created them but couldn't write the id back
+	identityMissing := map[string]bool{}
+	for _, t := range remoteTasks {
+		if t.LocalId() != nil {
+			continue
+		}
+		if id, found := pendingLocalId(t, localTaskMap); found {
+			remoteTaskMap[id] = t
+			identityMissing[id] = true
+			continue
 		}
+		localTasksToCreate = append(localTasksToCreate, t)
 	}
 
 	// Get local tasks with no path, these need to be created remotely
 	for _, t := range localTasks {
 		if t.RemotePath() == nil {
-			remoteTasksToCreate = append(remoteTasksToCreate, &t)
+			remoteTasksToCreate = append(remoteTasksToCreate, t)
 		}
 	}
 
@@ -285,14 +510,33 @@ func processTasks(localTasks []tw.Task, remoteTodos []caldav.Todo) processedTask
 	// Find tasks with changes
 	for uuid, t := range localTaskMap {
 		if remoteTask, remoteTaskExists := remoteTaskMap[uuid]; remoteTaskExists {
-			if !task.Equal(t, remoteTask) {
-				slog.Debug("Tasks are not equal, update required")
-				slog.Debug("local", "task", task.PrintTask(t))
-				slog.Debug("remot", "task", task.PrintTask(remoteTask))
+			isMoved := moved(t, remoteTask)
+			if isMoved {
+				slog.Debug("Remote task moved", "from", *t.RemotePath(), "to", *remoteTask.RemotePath())
+				opts := []task.ShellTaskOption{task.WithTask(t), task.WithRemotePath(*remoteTask.RemotePath())}
+				if project, known := projectOf(*t.RemotePath()); !known || project == t.Project() {
+					// Only moved on the remote, the task follows it
+					opts = append(opts, task.WithProject(remoteTask.Project()))
+				}
+				t = task.CreateShellTask(opts...)
+			}
+			if diff := task.Diff(t, remoteTask); len(diff) > 0 || identityMissing[uuid] {
+				slog.Debug("Tasks are not equal, update required", "task", t.Description())
+				debugDiff(diff)
+				updatedTask := getUpdateTask(t, remoteTask)
+				if identityMissing[uuid] {
+					updatedTask = task.CreateShellTask(task.WithTask(updatedTask), task.WithLocalId(uuid))
+				}
 				tasksToUpdate = append(tasksToUpdate, taskToUpdate{
-					localTask:   t,
+					localTask:   localTaskMap[uuid],
+					remoteTask:  remoteTask,
+					updatedTask: updatedTask,
+				})
+			} else if isMoved {
+				movedTasks = append(movedTasks, taskToUpdate{
+					localTask:   localTaskMap[uuid],
 					remoteTask:  remoteTask,
-					updatedTask: getUpdateTask(t, remoteTask),
+					updatedTask: t,
 				})
 			}
 		}
@@ -304,36 +548,50 @@ func processTasks(localTasks []tw.Task, remoteTodos []caldav.Todo) processedTask
 		localTasksToDelete:  localTasksToDelete,
 		remoteTasksToDelete: remoteTasksToDelete,
 		tasksToUpdate:       tasksToUpdate,
+		movedTasks:          movedTasks,
 	}
 }
 
-func getUpdateTask(a task.Task, b task.Task) task.Task {
-	taskToUpdate := a
-	if b.LastModified().After(a.LastModified()) {
-		taskToUpdate = b
+// pendingLocalId finds the local task created for a remote todo without
+// X-TASKWARRIOR-UUID, by the uuid derived from the UID of the todo
+func pendingLocalId(t task.Task, localTaskMap taskMapType) (string, bool) {
+	id := localIdFromUID(t)
+	if id == "" {
+		return "", false
 	}
-	return taskToUpdate
+	_, exists := localTaskMap[id]
+	return id, exists
 }
 
-func mapOfLocalTasks(tasks []tw.Task) taskMapType {
-	taskMap := make(taskMapType)
-	for _, t := range tasks {
-		if t.LocalId() == nil {
-			continue
-		}
-		taskMap[*t.LocalId()] = &t
+// localIdFromUID returns the uuid a local task created for a remote todo
+// gets, or "" when the todo has no UID
+func localIdFromUID(t task.Task) string {
+	todo, ok := t.(interface{ UID() string })
+	if !ok || todo.UID() == "" {
+		return ""
 	}
-	return taskMap
+	return remote.LocalIdFromUID(todo.UID())
 }
-func mapOfRemoteTasks(tasks []caldav.Todo) taskMapType {
-	taskMap := make(taskMapType)
-	for _, t := range tasks {
-		if t.LocalId() == nil {
-			continue
-		}
-		taskMap[*t.LocalId()] = &t
+
+// moved reports whether the todo of a synced task is no longer at the
+// path the local task knows it by
+func moved(localTask task.Task, remoteTask task.Task) bool {
+	return localTask.RemotePath() != nil && remoteTask.RemotePath() != nil && *localTask.RemotePath() != *remoteTask.RemotePath()
+}
+
+// debugDiff logs the fields that differ between a local and a remote task
+func debugDiff(diff []task.FieldDiff) {
+	for _, d := range diff {
+		slog.Debug("Field differs", "field", d.Name, "local", d.A, "remote", d.B)
 	}
-	return taskMap
+}
+
+func getUpdateTask(a task.Task, b task.Task) task.Task {
+	taskToUpdate := a
+	if b.LastModified().After(a.LastModified()) {
+		taskToUpdate = b
+	}
+	return taskToUpdate
 }
 
 func createMapOfTasks(tasks []task.Task) (taskMap taskMapType) {
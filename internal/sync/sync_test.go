@@ -0,0 +1,515 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/local/memory"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	remotememory "github.com/karsai5/tw-caldav/internal/remote/memory"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+
+	"github.com/spf13/viper"
+)
+
+var syncTime = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testTodo is a remote task that has a UID, like remote.Todo
+type testTodo struct {
+	task.ShellTask
+	uid string
+}
+
+func (t testTodo) UID() string {
+	return t.uid
+}
+
+type taskOption func(t *task.Internaltask)
+
+func withProject(project string) taskOption {
+	return func(t *task.Internaltask) { t.Project = project }
+}
+
+func withPath(path string) taskOption {
+	return func(t *task.Internaltask) { t.RemotePath = &path }
+}
+
+func withId(id string) taskOption {
+	return func(t *task.Internaltask) { t.LocalId = &id }
+}
+
+func modifiedAt(minutes int) taskOption {
+	return func(t *task.Internaltask) { t.LastModified = syncTime.Add(time.Duration(minutes) * time.Minute) }
+}
+
+func newTask(desc string, opts ...taskOption) task.ShellTask {
+	t := &task.Internaltask{Description: desc, Status: task.StatusPending, LastModified: syncTime}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return task.ShellTask{Task: t}
+}
+
+func descriptions(tasks []task.Task) []string {
+	descs := []string{}
+	for _, t := range tasks {
+		descs = append(descs, t.Description())
+	}
+	slices.Sort(descs)
+	return descs
+}
+
+func updatedDescriptions(updates []taskToUpdate) []string {
+	descs := []string{}
+	for _, u := range updates {
+		descs = append(descs, u.updatedTask.Description())
+	}
+	slices.Sort(descs)
+	return descs
+}
+
+const (
+	id1 = "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60"
+	id2 = "a2b0c7a4-0c3d-4b8e-8f7a-6e5d4c3b2a10"
+)
+
+func TestProcessTasks(t *testing.T) {
+	projects := map[string]string{"/cal/default/": "", "/cal/work/": "work", "/cal/home/": "home"}
+	projectOf := func(path string) (string, bool) {
+		for calendar, project := range projects {
+			if strings.HasPrefix(path, calendar) {
+				return project, true
+			}
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name         string
+		local        []task.Task
+		remote       []task.Task
+		newRemote    []string
+		newLocal     []string
+		deleteLocal  []string
+		deleteRemote []string
+		update       []string
+		moved        []string
+		checkUpdated func(t *testing.T, updates []taskToUpdate)
+		checkMoved   func(t *testing.T, moves []taskToUpdate)
+	}{
+		{
+			name:      "new local task is created remotely",
+			local:     []task.Task{newTask("local", withId(id1))},
+			newRemote: []string{"local"},
+		},
+		{
+			name:     "new remote todo is created locally",
+			remote:   []task.Task{testTodo{newTask("remote", withPath("/cal/default/x.ics")), "x"}},
+			newLocal: []string{"remote"},
+		},
+		{
+			name:   "synced and equal",
+			local:  []task.Task{newTask("same", withId(id1), withPath("/cal/default/a.ics"))},
+			remote: []task.Task{newTask("same", withId(id1), withPath("/cal/default/a.ics"))},
+		},
+		{
+			name:        "todo deleted on the remote",
+			local:       []task.Task{newTask("gone", withId(id1), withPath("/cal/default/a.ics"))},
+			deleteLocal: []string{"gone"},
+		},
+		{
+			name:         "task deleted locally",
+			remote:       []task.Task{newTask("gone", withId(id1), withPath("/cal/default/a.ics"))},
+			deleteRemote: []string{"gone"},
+		},
+		{
+			name:   "newer remote wins",
+			local:  []task.Task{newTask("old", withId(id1), withPath("/cal/default/a.ics"))},
+			remote: []task.Task{newTask("new", withId(id1), withPath("/cal/default/a.ics"), modifiedAt(5))},
+			update: []string{"new"},
+		},
+		{
+			name:   "newer local wins",
+			local:  []task.Task{newTask("new", withId(id1), withPath("/cal/default/a.ics"), modifiedAt(5))},
+			remote: []task.Task{newTask("old", withId(id1), withPath("/cal/default/a.ics"))},
+			update: []string{"new"},
+		},
+		{
+			name:   "moved on the remote",
+			local:  []task.Task{newTask("move", withId(id1), withPath("/cal/work/a.ics"), withProject("work"))},
+			remote: []task.Task{newTask("move", withId(id1), withPath("/cal/home/a.ics"), withProject("home"))},
+			moved:  []string{"move"},
+			checkMoved: func(t *testing.T, moves []taskToUpdate) {
+				if got := moves[0].updatedTask.Project(); got != "home" {
+					t.Errorf("project = %q, want home", got)
+				}
+				if got := *moves[0].updatedTask.RemotePath(); got != "/cal/home/a.ics" {
+					t.Errorf("path = %q", got)
+				}
+			},
+		},
+		{
+			name:   "moved on the remote and project changed locally",
+			local:  []task.Task{newTask("move", withId(id1), withPath("/cal/work/a.ics"), withProject("garden"), modifiedAt(5))},
+			remote: []task.Task{newTask("move", withId(id1), withPath("/cal/home/a.ics"), withProject("home"))},
+			update: []string{"move"},
+			checkUpdated: func(t *testing.T, updates []taskToUpdate) {
+				if got := updates[0].updatedTask.Project(); got != "garden" {
+					t.Errorf("project = %q, want garden", got)
+				}
+			},
+		},
+		{
+			name:   "moved on the remote from a calendar that isn't synced",
+			local:  []task.Task{newTask("move", withId(id1), withPath("/cal/old/a.ics"), withProject("old"))},
+			remote: []task.Task{newTask("move", withId(id1), withPath("/cal/home/a.ics"), withProject("home"))},
+			moved:  []string{"move"},
+			checkMoved: func(t *testing.T, moves []taskToUpdate) {
+				if got := moves[0].updatedTask.Project(); got != "home" {
+					t.Errorf("project = %q, want home", got)
+				}
+			},
+		},
+		{
+			name:   "moved and edited on the remote",
+			local:  []task.Task{newTask("move", withId(id1), withPath("/cal/work/a.ics"), withProject("work"))},
+			remote: []task.Task{newTask("moved", withId(id1), withPath("/cal/home/a.ics"), withProject("home"), modifiedAt(5))},
+			update: []string{"moved"},
+			checkUpdated: func(t *testing.T, updates []taskToUpdate) {
+				if got := updates[0].updatedTask.Project(); got != "home" {
+					t.Errorf("project = %q, want home", got)
+				}
+				if got := *updates[0].updatedTask.RemotePath(); got != "/cal/home/a.ics" {
+					t.Errorf("path = %q", got)
+				}
+			},
+		},
+		{
+			name:   "moved on the remote and edited locally",
+			local:  []task.Task{newTask("edited", withId(id1), withPath("/cal/work/a.ics"), withProject("work"), modifiedAt(5))},
+			remote: []task.Task{newTask("move", withId(id1), withPath("/cal/home/a.ics"), withProject("home"))},
+			update: []string{"edited"},
+			checkUpdated: func(t *testing.T, updates []taskToUpdate) {
+				if got := updates[0].updatedTask.Project(); got != "home" {
+					t.Errorf("project = %q, want home", got)
+				}
+				if got := *updates[0].updatedTask.RemotePath(); got != "/cal/home/a.ics" {
+					t.Errorf("path = %q", got)
+				}
+			},
+		},
+		{
+			name: "local task created for a todo whose id wasn't written back",
+			local: []task.Task{
+				newTask("half synced", withId(remote.LocalIdFromUID("other-client-uid")), withPath("/cal/default/b.ics")),
+			},
+			remote: []task.Task{testTodo{newTask("half synced", withPath("/cal/default/b.ics")), "other-client-uid"}},
+			update: []string{"half synced"},
+			checkUpdated: func(t *testing.T, updates []taskToUpdate) {
+				id := updates[0].updatedTask.LocalId()
+				if id == nil || *id != remote.LocalIdFromUID("other-client-uid") {
+					t.Errorf("local id = %v, want the id derived from the UID", id)
+				}
+			},
+		},
+		{
+			name: "mixed",
+			local: []task.Task{
+				newTask("keep", withId(id1), withPath("/cal/default/a.ics")),
+				newTask("push", withId(id2)),
+			},
+			remote: []task.Task{
+				newTask("keep", withId(id1), withPath("/cal/default/a.ics")),
+				testTodo{newTask("pull", withPath("/cal/default/c.ics")), "c"},
+			},
+			newRemote: []string{"push"},
+			newLocal:  []string{"pull"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := processTasks(tt.local, tt.remote, projectOf)
+
+			check := func(group string, got []string, want []string) {
+				if want == nil {
+					want = []string{}
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("%s = %v, want %v", group, got, want)
+				}
+			}
+			check("newRemoteTasks", descriptions(got.newRemoteTasks), tt.newRemote)
+			check("newLocalTasks", descriptions(got.newLocalTasks), tt.newLocal)
+			check("localTasksToDelete", descriptions(got.localTasksToDelete), tt.deleteLocal)
+			check("remoteTasksToDelete", descriptions(got.remoteTasksToDelete), tt.deleteRemote)
+			check("tasksToUpdate", updatedDescriptions(got.tasksToUpdate), tt.update)
+			check("movedTasks", updatedDescriptions(got.movedTasks), tt.moved)
+
+			if tt.checkUpdated != nil && len(got.tasksToUpdate) > 0 {
+				tt.checkUpdated(t, got.tasksToUpdate)
+			}
+			if tt.checkMoved != nil && len(got.movedTasks) > 0 {
+				tt.checkMoved(t, got.movedTasks)
+			}
+		})
+	}
+}
+
+func TestLocalIdFromUID(t *testing.T) {
+	tests := []struct {
+		uid  string
+		want string
+	}{
+		{"6D1F0F4E-7B1A-4C84-9A3E-1D2C3B4A5F60", id1},
+		{id2, id2},
+		{"20250601T120000Z-123@example.com", remote.LocalIdFromUID("20250601T120000Z-123@example.com")},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got := localIdFromUID(testTodo{newTask("t"), tt.uid})
+		if got != tt.want {
+			t.Errorf("localIdFromUID(%q) = %q, want %q", tt.uid, got, tt.want)
+		}
+	}
+
+	derived := remote.LocalIdFromUID("20250601T120000Z-123@example.com")
+	if derived != remote.LocalIdFromUID("20250601T120000Z-123@example.com") {
+		t.Error("ids derived from the same UID differ")
+	}
+	if derived == remote.LocalIdFromUID("20250601T120000Z-124@example.com") {
+		t.Error("ids derived from different UIDs are equal")
+	}
+	if localIdFromUID(newTask("no uid")) != "" {
+		t.Error("a task without UID got an id")
+	}
+}
+
+func TestPendingLocalId(t *testing.T) {
+	derived := remote.LocalIdFromUID("20250601T120000Z-123@example.com")
+	localTasks := taskMapType{
+		id1:     newTask("uuid uid", withId(id1)),
+		derived: newTask("email style uid", withId(derived)),
+	}
+
+	tests := []struct {
+		name      string
+		task      task.Task
+		wantId    string
+		wantFound bool
+	}{
+		{"uuid uid", testTodo{newTask("t"), "6D1F0F4E-7B1A-4C84-9A3E-1D2C3B4A5F60"}, id1, true},
+		{"non-uuid uid", testTodo{newTask("t"), "20250601T120000Z-123@example.com"}, derived, true},
+		{"uuid uid not created yet", testTodo{newTask("t"), id2}, id2, false},
+		{"non-uuid uid not created yet", testTodo{newTask("t"), "20250601T120000Z-124@example.com"}, remote.LocalIdFromUID("20250601T120000Z-124@example.com"), false},
+		{"empty uid", testTodo{newTask("t"), ""}, "", false},
+		{"no uid", newTask("t"), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, found := pendingLocalId(tt.task, localTasks)
+			if id != tt.wantId || found != tt.wantFound {
+				t.Errorf("got %q, %v, want %q, %v", id, found, tt.wantId, tt.wantFound)
+			}
+		})
+	}
+}
+
+// newTestSync returns a sync process between two in memory stores
+func newTestSync(t *testing.T) SyncProcess {
+	t.Helper()
+	rs, err := remote.NewService(remotememory.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SyncProcess{local: memory.New(), remote: rs, synctime: time.Now()}
+}
+
+// syncedTask adds a task on both sides and returns it as read locally
+// and remotely
+func syncedTask(t *testing.T, sp SyncProcess, desc string) (task.Task, task.Task) {
+	t.Helper()
+	id, err := sp.local.AddTask(newTask(desc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localTask, _ := sp.local.GetTask(id)
+	path, err := sp.remote.CreateNewTodo(localTask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.local.UpdateTask(id, task.CreateShellTask(task.WithTask(localTask), task.WithRemotePath(path))); err != nil {
+		t.Fatal(err)
+	}
+	localTask, _ = sp.local.GetTask(id)
+	remoteTask, err := sp.remote.GetTodo("", path, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return localTask, &remoteTask
+}
+
+func TestHandleTaskUpdate(t *testing.T) {
+	t.Run("update is written to both sides", func(t *testing.T) {
+		sp := newTestSync(t)
+		localTask, remoteTask := syncedTask(t, sp, "old")
+		updated := task.CreateShellTask(task.WithTask(localTask))
+		updated.Task.Description = "new"
+
+		err := sp.handleTaskUpdate(taskToUpdate{localTask: localTask, remoteTask: remoteTask, updatedTask: updated})
+		if err != nil {
+			t.Fatal(err)
+		}
+		current, _ := sp.local.GetTask(*localTask.LocalId())
+		todo, _ := sp.remote.GetTodo("", *remoteTask.RemotePath(), *localTask.LocalId())
+		if current.Description() != "new" || todo.Description() != "new" {
+			t.Errorf("local %q, remote %q, want new", current.Description(), todo.Description())
+		}
+	})
+
+	t.Run("local edit during the sync is kept", func(t *testing.T) {
+		sp := newTestSync(t)
+		localTask, remoteTask := syncedTask(t, sp, "old")
+		edited := task.CreateShellTask(task.WithTask(localTask))
+		edited.Task.Description = "edited locally"
+		if err := sp.local.UpdateTask(*localTask.LocalId(), edited); err != nil {
+			t.Fatal(err)
+		}
+		updated := task.CreateShellTask(task.WithTask(remoteTask))
+		updated.Task.Description = "from remote"
+
+		err := sp.handleTaskUpdate(taskToUpdate{localTask: localTask, remoteTask: remoteTask, updatedTask: updated})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		current, _ := sp.local.GetTask(*localTask.LocalId())
+		todo, _ := sp.remote.GetTodo("", *remoteTask.RemotePath(), *localTask.LocalId())
+		if current.Description() != "edited locally" || todo.Description() != "old" {
+			t.Errorf("local %q, remote %q", current.Description(), todo.Description())
+		}
+	})
+}
+
+func TestNewSyncProcessRefusesMemoryBackend(t *testing.T) {
+	viper.Set("backend", "memory")
+	t.Cleanup(func() { viper.Set("backend", "") })
+
+	if _, err := NewSyncProcess(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestNewSyncProcessRefusesMemoryRemote(t *testing.T) {
+	viper.Set("remote", "memory")
+	t.Cleanup(func() { viper.Set("remote", "") })
+
+	if _, err := NewSyncProcess(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSyncWithEmptyRemote(t *testing.T) {
+	tests := []struct {
+		name       string
+		check      bool
+		allow      bool
+		remoteTodo bool
+		wantErr    bool
+	}{
+		{name: "file remote without todos", check: true, wantErr: true},
+		{name: "file remote allowed to be empty", check: true, allow: true},
+		{name: "file remote with todos", check: true, remoteTodo: true},
+		{name: "caldav remote without todos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSync(t)
+			sp.checkEmptyRemote = tt.check
+			sp.AllowEmptyRemote = tt.allow
+			localTask, remoteTask := syncedTask(t, sp, "synced")
+			if tt.remoteTodo {
+				if _, err := sp.remote.CreateNewTodo(newTask("other", withId(id2))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := remoteTask.Delete(); err != nil {
+				t.Fatal(err)
+			}
+
+			err := sp.Sync()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			current, _ := sp.local.GetTask(*localTask.LocalId())
+			if kept := current.Status() != task.StatusDeleted; kept != tt.wantErr {
+				t.Errorf("local task kept = %v, want %v", kept, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncFollowsRemoteMove(t *testing.T) {
+	tests := []struct {
+		name         string
+		localProject string
+		wantProject  string
+	}{
+		{name: "moved on the remote", localProject: "work", wantProject: "home"},
+		{name: "project changed locally too", localProject: "garden", wantProject: "garden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSync(t)
+			home, err := sp.remote.FindOrCreateCalendar("home")
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := sp.local.AddTask(newTask("report", withId(id1), withProject("work")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sp.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			synced, _ := sp.local.GetTask(id)
+			if _, err := sp.remote.Backend.MoveItem(*synced.RemotePath(), home); err != nil {
+				t.Fatal(err)
+			}
+			if tt.localProject != "work" {
+				edited := task.CreateShellTask(task.WithTask(synced), task.WithProject(tt.localProject))
+				edited.Task.LastModified = time.Now().Add(time.Minute)
+				if err := sp.local.UpdateTask(id, edited); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sp.synctime = time.Now()
+			if err := sp.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			current, _ := sp.local.GetTask(id)
+			if current.Status() == task.StatusDeleted {
+				t.Fatal("local task was deleted")
+			}
+			if got := current.Project(); got != tt.wantProject {
+				t.Errorf("local project = %q, want %q", got, tt.wantProject)
+			}
+			todo, err := sp.remote.GetTodo(tt.wantProject, *current.RemotePath(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := todo.Project(); got != tt.wantProject {
+				t.Errorf("remote project = %q, want %q", got, tt.wantProject)
+			}
+			if got := *todo.RemotePath(); got != *current.RemotePath() {
+				t.Errorf("remote path = %q, local remote path = %q", got, *current.RemotePath())
+			}
+		})
+	}
+}
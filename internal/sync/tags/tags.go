@@ -0,0 +1,179 @@
+package tags
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/karsai5/tw-caldav/internal/state"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	configuredAliases     map[string]string
+	configuredAliasesOnce sync.Once
+)
+
+// getConfiguredAliases returns the aliases from the tag_aliases key,
+// e.g. tag_aliases=Work Stuff:work,Home Errands:errands, as a map of tag
+// to category
+func getConfiguredAliases() map[string]string {
+	configuredAliasesOnce.Do(func() {
+		configuredAliases = map[string]string{}
+		for _, entry := range strings.Split(viper.GetString("tag_aliases"), ",") {
+			category, tag, found := strings.Cut(entry, ":")
+			category = strings.TrimSpace(category)
+			tag = strings.TrimSpace(tag)
+			if !found || category == "" || tag == "" {
+				continue
+			}
+			if !IsValid(tag) {
+				slog.Error("Ignoring alias to an invalid tag", "tag", tag, "category", category)
+				continue
+			}
+			configuredAliases[tag] = category
+		}
+	})
+	return configuredAliases
+}
+
+// slugEnabled reports whether categories that aren't valid tags are
+// turned into tags, configured with the tag_slug key. When disabled such
+// categories are skipped.
+func slugEnabled() bool {
+	return viper.GetBool("tag_slug")
+}
+
+// IsValid reports whether taskwarrior can store a tag
+func IsValid(tag string) bool {
+	if tag == "" || strings.HasPrefix(tag, "+") || strings.HasPrefix(tag, "-") {
+		return false
+	}
+	return !strings.ContainsFunc(tag, isInvalidRune)
+}
+
+func isInvalidRune(r rune) bool {
+	return unicode.IsSpace(r) || r == ',' || r == ':' || r == '(' || r == ')' || r == '"' || r == '\''
+}
+
+// Slug turns a category name into a valid tag
+func Slug(category string) string {
+	var sb strings.Builder
+	lastUnderscore := false
+	for _, r := range strings.TrimSpace(category) {
+		if isInvalidRune(r) {
+			if !lastUnderscore {
+				sb.WriteRune('_')
+			}
+			lastUnderscore = true
+			continue
+		}
+		sb.WriteRune(r)
+		lastUnderscore = r == '_'
+	}
+	slug := strings.Trim(sb.String(), "_+-")
+	if slug == "" {
+		return "category"
+	}
+	return slug
+}
+
+// Mapped reports whether a remote category maps to a tag. Categories that
+// don't are skipped when reading a todo and kept when writing it.
+func Mapped(category string) bool {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return false
+	}
+	if IsValid(category) || slugEnabled() {
+		return true
+	}
+	for _, aliased := range getConfiguredAliases() {
+		if aliased == category {
+			return true
+		}
+	}
+	return false
+}
+
+// FromCategory returns the tag for a remote category. Categories that
+// are valid tags are used as is, others use their alias or are slugged
+// and the slug remembered so that ToCategory can reverse it.
+func FromCategory(category string) (string, bool) {
+	category = strings.TrimSpace(category)
+	if category == "" {
+		return "", false
+	}
+	if IsValid(category) {
+		return category, true
+	}
+
+	for tag, aliased := range getConfiguredAliases() {
+		if aliased == category {
+			return tag, true
+		}
+	}
+
+	if !slugEnabled() {
+		slog.Warn("Category is not a valid tag, skipping it", "category", category)
+		return "", false
+	}
+
+	s, err := state.Get()
+	if err != nil {
+		slog.Error("Could not load tag aliases", "err", err)
+		return "", false
+	}
+
+	tag := ""
+	s.Read(func(s *state.State) {
+		for t, aliased := range s.TagAliases {
+			if aliased == category {
+				tag = t
+			}
+		}
+	})
+	if tag != "" {
+		return tag, true
+	}
+
+	err = s.Update(func(s *state.State) {
+		base := Slug(category)
+		tag = base
+		for i := 2; ; i++ {
+			_, takenByState := s.TagAliases[tag]
+			_, takenByConfig := getConfiguredAliases()[tag]
+			if !takenByState && !takenByConfig {
+				break
+			}
+			tag = fmt.Sprintf("%s_%d", base, i)
+		}
+		s.TagAliases[tag] = category
+	})
+	if err != nil {
+		slog.Error("Could not save tag alias", "tag", tag, "category", category, "err", err)
+	}
+	slog.Info("Category mapped to tag", "category", category, "tag", tag)
+	return tag, true
+}
+
+// ToCategory returns the remote category for a tag, reversing any alias
+func ToCategory(tag string) string {
+	if category, exists := getConfiguredAliases()[tag]; exists {
+		return category
+	}
+	s, err := state.Get()
+	if err != nil {
+		return tag
+	}
+	category := tag
+	s.Read(func(s *state.State) {
+		if aliased, exists := s.TagAliases[tag]; exists {
+			category = aliased
+		}
+	})
+	return category
+}
@@ -0,0 +1,64 @@
+package tags
+
+import "testing"
+
+func TestIsValid(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"work", true},
+		{"work-stuff", true},
+		{"work_stuff", true},
+		{"über", true},
+		{"", false},
+		{"+work", false},
+		{"-work", false},
+		{"work stuff", false},
+		{"a,b", false},
+		{"a:b", false},
+		{"(a)", false},
+		{`"a"`, false},
+	}
+	for _, tt := range tests {
+		if got := IsValid(tt.tag); got != tt.want {
+			t.Errorf("IsValid(%q) = %v, want %v", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		category string
+		want     string
+	}{
+		{"Work Stuff", "Work_Stuff"},
+		{"  Work   Stuff  ", "Work_Stuff"},
+		{"a, b: (c)", "a_b_c"},
+		{"+urgent", "urgent"},
+		{"___", "category"},
+		{"", "category"},
+	}
+	for _, tt := range tests {
+		if got := Slug(tt.category); got != tt.want {
+			t.Errorf("Slug(%q) = %q, want %q", tt.category, got, tt.want)
+		}
+	}
+}
+
+func TestMapped(t *testing.T) {
+	tests := []struct {
+		category string
+		want     bool
+	}{
+		{"work", true},
+		{" work ", true},
+		{"Work Stuff", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := Mapped(tt.category); got != tt.want {
+			t.Errorf("Mapped(%q) = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
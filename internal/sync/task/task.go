@@ -1,6 +1,9 @@
 package task
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
 type Task interface {
 	Description() string
@@ -9,6 +12,11 @@ type Task interface {
 	Priority() Priority
 	Tags() []string
 	LastModified() time.Time
+	Created() *time.Time
+	Completed() *time.Time
+	Progress() *int
+	UDAs() map[string]string
+	Alarms() []time.Duration
 
 	RemotePath() *string
 	LocalId() *string
@@ -18,20 +26,16 @@ type Task interface {
 	Delete() error
 }
 
-
+// Priority is an iCalendar priority, 1 is the highest, 9 the lowest and
+// 0 is undefined. Stores return the value written for the local level the
+// priority maps to, so equal levels compare equal.
 type Priority int8
 
 func (p Priority) String() string {
-	switch p {
-	case 9:
-		return "L"
-	case 5:
-		return "M"
-	case 1:
-		return "H"
-	default:
+	if p == PriorityUnset {
 		return ""
 	}
+	return strconv.Itoa(int(p))
 }
 
 const (
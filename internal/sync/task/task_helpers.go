@@ -1,40 +1,99 @@
 package task
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
+	"maps"
 	"slices"
 	"strings"
 )
 
-func GetHash(t Task) string {
-	hash := md5.Sum([]byte(PrintTask(t)))
-	hashString := hex.EncodeToString(hash[:])
-	return hashString
+// Field is a synced field of a task, as it is compared
+type Field struct {
+	Name  string
+	Value string
 }
 
-func PrintTask(t Task) string {
-	slices.Sort(t.Tags())
-	parts := []string{
-		fmt.Sprintf("desc:%s", t.Description()),
-		fmt.Sprintf("proj:%s", t.Project()),
-		fmt.Sprintf("priority:%s", t.Priority().String()),
-		fmt.Sprintf("tags:%s", strings.Join(t.Tags(), ",")),
-		fmt.Sprintf("status:%s", t.Status().String()),
+// Fields returns the synced fields of a task. Fields without a value are
+// left out.
+func Fields(t Task) []Field {
+	tags := slices.Sorted(slices.Values(t.Tags()))
+	fields := []Field{
+		{"desc", t.Description()},
+		{"proj", t.Project()},
+		{"priority", t.Priority().String()},
+		{"tags", strings.Join(tags, ",")},
+		{"status", t.Status().String()},
 	}
 	if t.Due() != nil {
-		parts = append(parts, fmt.Sprintf("due:%s", t.Due().UTC().String()))
+		fields = append(fields, Field{"due", t.Due().UTC().String()})
+	}
+	if t.Progress() != nil {
+		fields = append(fields, Field{"progress", fmt.Sprint(*t.Progress())})
+	}
+	udaNames := slices.Sorted(maps.Keys(t.UDAs()))
+	for _, name := range udaNames {
+		fields = append(fields, Field{"uda." + name, t.UDAs()[name]})
+	}
+	if len(t.Alarms()) > 0 {
+		alarms := []string{}
+		for _, a := range t.Alarms() {
+			alarms = append(alarms, a.String())
+		}
+		fields = append(fields, Field{"alarms", strings.Join(alarms, ",")})
 	}
 	if t.RemotePath() != nil {
-		parts = append(parts, fmt.Sprintf("remote:%s", *t.RemotePath()))
+		fields = append(fields, Field{"remote", *t.RemotePath()})
 	}
 	if t.LocalId() != nil {
-		parts = append(parts, fmt.Sprintf("local:%s", *t.LocalId()))
+		fields = append(fields, Field{"local", *t.LocalId()})
+	}
+	return fields
+}
+
+func PrintTask(t Task) string {
+	parts := []string{}
+	for _, f := range Fields(t) {
+		parts = append(parts, fmt.Sprintf("%s:%s", f.Name, f.Value))
 	}
 	return strings.Join(parts, " ")
 }
 
+// FieldDiff is a field that differs between two tasks. Present is false
+// on the side that doesn't have the field.
+type FieldDiff struct {
+	Name     string
+	A, B     string
+	PresentA bool
+	PresentB bool
+}
+
+// Diff returns the fields that differ between two tasks, in the order
+// Fields returns them
+func Diff(a Task, b Task) []FieldDiff {
+	fieldsA := Fields(a)
+	fieldsB := Fields(b)
+	valuesB := map[string]string{}
+	for _, f := range fieldsB {
+		valuesB[f.Name] = f.Value
+	}
+
+	diffs := []FieldDiff{}
+	seen := map[string]bool{}
+	for _, f := range fieldsA {
+		seen[f.Name] = true
+		valueB, present := valuesB[f.Name]
+		if !present || valueB != f.Value {
+			diffs = append(diffs, FieldDiff{Name: f.Name, A: f.Value, B: valueB, PresentA: true, PresentB: present})
+		}
+	}
+	for _, f := range fieldsB {
+		if !seen[f.Name] {
+			diffs = append(diffs, FieldDiff{Name: f.Name, B: f.Value, PresentB: true})
+		}
+	}
+	return diffs
+}
+
 func Equal(a Task, b Task) bool {
-	return GetHash(a) == GetHash(b)
+	return len(Diff(a, b)) == 0
 }
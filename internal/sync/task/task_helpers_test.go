@@ -0,0 +1,190 @@
+package task
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var due = time.Date(2025, 6, 14, 9, 0, 0, 0, time.UTC)
+
+// fullTask returns a task with every synced field set, change adjusts it
+func fullTask(change func(t *Internaltask)) ShellTask {
+	progress := 50
+	path := "/cal/home/6d1f0f4e.ics"
+	id := "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60"
+	due := due
+	t := &Internaltask{
+		Description: "Water the plants",
+		Project:     "home",
+		Due:         &due,
+		Priority:    PriorityHigh,
+		Tags:        []string{"garden", "weekly"},
+		Progress:    &progress,
+		UDAs:        map[string]string{"estimate": "3", "area": "outside"},
+		Alarms:      []time.Duration{-time.Hour, 0},
+		RemotePath:  &path,
+		LocalId:     &id,
+		Status:      StatusPending,
+	}
+	if change != nil {
+		change(t)
+	}
+	return ShellTask{Task: t}
+}
+
+func TestFields(t *testing.T) {
+	got := PrintTask(fullTask(nil))
+	want := "desc:Water the plants proj:home priority:1 tags:garden,weekly status:pending " +
+		"due:2025-06-14 09:00:00 +0000 UTC progress:50 uda.area:outside uda.estimate:3 alarms:-1h0m0s,0s " +
+		"remote:/cal/home/6d1f0f4e.ics local:6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60"
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+
+	names := []string{}
+	for _, f := range Fields(ShellTask{Task: &Internaltask{Description: "bare"}}) {
+		names = append(names, f.Name)
+	}
+	if want := []string{"desc", "proj", "priority", "tags", "status"}; !slices.Equal(names, want) {
+		t.Errorf("fields of a bare task = %v, want %v", names, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	sydney, _ := time.LoadLocation("Australia/Sydney")
+
+	tests := []struct {
+		name   string
+		change func(t *Internaltask)
+		want   []FieldDiff
+	}{
+		{name: "equal"},
+		{
+			name:   "description",
+			change: func(t *Internaltask) { t.Description = "Water the garden" },
+			want:   []FieldDiff{{Name: "desc", A: "Water the plants", B: "Water the garden", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "project",
+			change: func(t *Internaltask) { t.Project = "" },
+			want:   []FieldDiff{{Name: "proj", A: "home", B: "", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "priority",
+			change: func(t *Internaltask) { t.Priority = PriorityUnset },
+			want:   []FieldDiff{{Name: "priority", A: "1", B: "", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "tags",
+			change: func(t *Internaltask) { t.Tags = []string{"garden"} },
+			want:   []FieldDiff{{Name: "tags", A: "garden,weekly", B: "garden", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "tags in another order",
+			change: func(t *Internaltask) { t.Tags = []string{"weekly", "garden"} },
+		},
+		{
+			name:   "status",
+			change: func(t *Internaltask) { t.Status = StatusComplete },
+			want:   []FieldDiff{{Name: "status", A: "pending", B: "complete", PresentA: true, PresentB: true}},
+		},
+		{
+			name: "due",
+			change: func(t *Internaltask) {
+				later := due.Add(time.Minute)
+				t.Due = &later
+			},
+			want: []FieldDiff{{Name: "due", A: "2025-06-14 09:00:00 +0000 UTC", B: "2025-06-14 09:01:00 +0000 UTC", PresentA: true, PresentB: true}},
+		},
+		{
+			name: "due in another zone",
+			change: func(t *Internaltask) {
+				local := due.In(sydney)
+				t.Due = &local
+			},
+		},
+		{
+			name:   "due removed",
+			change: func(t *Internaltask) { t.Due = nil },
+			want:   []FieldDiff{{Name: "due", A: "2025-06-14 09:00:00 +0000 UTC", PresentA: true}},
+		},
+		{
+			name: "progress",
+			change: func(t *Internaltask) {
+				done := 100
+				t.Progress = &done
+			},
+			want: []FieldDiff{{Name: "progress", A: "50", B: "100", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "uda",
+			change: func(t *Internaltask) { t.UDAs = map[string]string{"estimate": "5", "area": "outside"} },
+			want:   []FieldDiff{{Name: "uda.estimate", A: "3", B: "5", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "uda added",
+			change: func(t *Internaltask) { t.UDAs = map[string]string{"estimate": "3", "area": "outside", "energy": "low"} },
+			want:   []FieldDiff{{Name: "uda.energy", B: "low", PresentB: true}},
+		},
+		{
+			name:   "alarms",
+			change: func(t *Internaltask) { t.Alarms = []time.Duration{-time.Hour} },
+			want:   []FieldDiff{{Name: "alarms", A: "-1h0m0s,0s", B: "-1h0m0s", PresentA: true, PresentB: true}},
+		},
+		{
+			name:   "remote path",
+			change: func(t *Internaltask) { t.RemotePath = nil },
+			want:   []FieldDiff{{Name: "remote", A: "/cal/home/6d1f0f4e.ics", PresentA: true}},
+		},
+		{
+			name: "local id",
+			change: func(t *Internaltask) {
+				id := "a2b0c7a4-0c3d-4b8e-8f7a-6e5d4c3b2a10"
+				t.LocalId = &id
+			},
+			want: []FieldDiff{{Name: "local", A: "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60", B: "a2b0c7a4-0c3d-4b8e-8f7a-6e5d4c3b2a10", PresentA: true, PresentB: true}},
+		},
+		{
+			name: "fields that aren't synced",
+			change: func(t *Internaltask) {
+				created := due.Add(-time.Hour)
+				t.LastModified = due
+				t.Created = &created
+				t.Completed = &created
+			},
+		},
+		{
+			name: "several fields in field order",
+			change: func(t *Internaltask) {
+				t.LocalId = nil
+				t.Description = "Water the garden"
+			},
+			want: []FieldDiff{
+				{Name: "desc", A: "Water the plants", B: "Water the garden", PresentA: true, PresentB: true},
+				{Name: "local", A: "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60", PresentA: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := fullTask(nil)
+			b := fullTask(tt.change)
+
+			got := Diff(a, b)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Diff() = %+v\nwant %+v", got, tt.want)
+			}
+			if Equal(a, b) != (len(tt.want) == 0) {
+				t.Errorf("Equal() = %v", Equal(a, b))
+			}
+			if Equal(b, a) != Equal(a, b) {
+				t.Error("Equal() isn't symmetric")
+			}
+			if len(Diff(b, a)) != len(got) {
+				t.Errorf("Diff(b, a) = %+v, want as many fields as Diff(a, b)", Diff(b, a))
+			}
+		})
+	}
+}
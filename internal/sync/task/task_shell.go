@@ -26,6 +26,11 @@ func WithTask(t Task) ShellTaskOption {
 			Priority:     t.Priority(),
 			Tags:         t.Tags(),
 			LastModified: t.LastModified(),
+			Created:      t.Created(),
+			Completed:    t.Completed(),
+			Progress:     t.Progress(),
+			UDAs:         t.UDAs(),
+			Alarms:       t.Alarms(),
 			RemotePath:   t.RemotePath(),
 			LocalId:      t.LocalId(),
 			Status:       t.Status(),
@@ -38,6 +43,18 @@ func WithLocalId(uuid string) ShellTaskOption {
 		shellTask.Task.LocalId = &uuid
 	}
 }
+func WithAlarms(alarms []time.Duration) ShellTaskOption {
+	return func(shellTask *ShellTask) {
+		shellTask.Task.Alarms = alarms
+	}
+}
+
+func WithProject(project string) ShellTaskOption {
+	return func(shellTask *ShellTask) {
+		shellTask.Task.Project = project
+	}
+}
+
 func WithRemotePath(path string) ShellTaskOption {
 	return func(shellTask *ShellTask) {
 		shellTask.Task.RemotePath = &path
@@ -51,6 +68,11 @@ type Internaltask struct {
 	Priority     Priority
 	Tags         []string
 	LastModified time.Time
+	Created      *time.Time
+	Completed    *time.Time
+	Progress     *int
+	UDAs         map[string]string
+	Alarms       []time.Duration
 
 	RemotePath *string
 	LocalId    *string
@@ -81,6 +103,31 @@ func (s ShellTask) LastModified() time.Time {
 	return s.Task.LastModified
 }
 
+// Created implements Task.
+func (s ShellTask) Created() *time.Time {
+	return s.Task.Created
+}
+
+// Completed implements Task.
+func (s ShellTask) Completed() *time.Time {
+	return s.Task.Completed
+}
+
+// Progress implements Task.
+func (s ShellTask) Progress() *int {
+	return s.Task.Progress
+}
+
+// UDAs implements Task.
+func (s ShellTask) UDAs() map[string]string {
+	return s.Task.UDAs
+}
+
+// Alarms implements Task.
+func (s ShellTask) Alarms() []time.Duration {
+	return s.Task.Alarms
+}
+
 // LocalId implements Task.
 func (s ShellTask) LocalId() *string {
 	return s.Task.LocalId
@@ -0,0 +1,51 @@
+package uda
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// AlarmUDA returns the name of the string UDA that alarms are stored in,
+// configured with the alarm_uda key. Alarms aren't synced back to
+// taskwarrior when it is empty.
+func AlarmUDA() string {
+	return viper.GetString("alarm_uda")
+}
+
+// ParseAlarms reads a comma separated list of durations before the due
+// date, as stored in the alarm UDA
+func ParseAlarms(value string) ([]time.Duration, error) {
+	alarms := []time.Duration{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d, err := ParseDuration(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alarm %q: %w", part, err)
+		}
+		alarms = append(alarms, d)
+	}
+	return SortAlarms(alarms), nil
+}
+
+// FormatAlarms writes alarms in the form stored in the alarm UDA
+func FormatAlarms(alarms []time.Duration) string {
+	parts := []string{}
+	for _, a := range SortAlarms(alarms) {
+		parts = append(parts, FormatDuration(a))
+	}
+	return strings.Join(parts, ",")
+}
+
+// SortAlarms sorts alarms and removes duplicates
+func SortAlarms(alarms []time.Duration) []time.Duration {
+	sorted := slices.Clone(alarms)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
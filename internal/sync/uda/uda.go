@@ -0,0 +1,205 @@
+package uda
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	"github.com/spf13/viper"
+)
+
+type Type string
+
+const (
+	TypeString   Type = "string"
+	TypeNumeric  Type = "numeric"
+	TypeDate     Type = "date"
+	TypeDuration Type = "duration"
+)
+
+// Mapping binds a taskwarrior UDA to an iCalendar property
+type Mapping struct {
+	Name     string
+	Property string
+	Type     Type
+}
+
+var (
+	mappings     []Mapping
+	mappingsOnce sync.Once
+)
+
+// udaMapPrefix starts the keys that map a UDA to an iCalendar property
+const udaMapPrefix = "uda_map_"
+
+// Mappings returns the UDA mappings configured with uda_map_<name> keys,
+// one per UDA, e.g.
+//
+//	uda_map_estimate=
+//	uda_map_ticket=URL
+//
+// UDAs without a property are mapped to X-TASKWARRIOR-<NAME>. The type of
+// each UDA is read from the taskwarrior configuration.
+func Mappings() []Mapping {
+	mappingsOnce.Do(func() {
+		parsed, err := ParseMappings(configuredMappings(), taskwarrior.UDAType)
+		if err != nil {
+			slog.Error("Could not load uda mappings, UDAs will not be synced", "err", err)
+			return
+		}
+		mappings = parsed
+	})
+	return mappings
+}
+
+// SyncProgress reports whether the optional progress UDA is mapped to
+// PERCENT-COMPLETE. It needs uda.progress defined in .taskrc.
+func SyncProgress() bool {
+	return viper.GetBool("sync_progress")
+}
+
+// configuredMappings returns the property of each UDA with a uda_map_
+// key in the config file or a TW_CALDAV_UDA_MAP_ environment variable
+func configuredMappings() map[string]string {
+	config := map[string]string{}
+	for _, key := range viper.AllKeys() {
+		if name, found := strings.CutPrefix(key, udaMapPrefix); found {
+			config[name] = viper.GetString(key)
+		}
+	}
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name, found := strings.CutPrefix(strings.ToLower(key), "tw_caldav_"+udaMapPrefix); found {
+			config[name] = value
+		}
+	}
+	return config
+}
+
+// ParseMappings turns a map of UDA name to property into mappings, sorted
+// by name
+func ParseMappings(config map[string]string, udaType func(name string) (string, error)) ([]Mapping, error) {
+	parsed := []Mapping{}
+	for _, name := range slices.Sorted(maps.Keys(config)) {
+		property := strings.ToUpper(strings.TrimSpace(config[name]))
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if property == "" {
+			property = "X-TASKWARRIOR-" + strings.ToUpper(name)
+		}
+
+		typ, err := udaType(name)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "" {
+			return nil, fmt.Errorf("uda %q is not defined in taskwarrior", name)
+		}
+
+		switch Type(typ) {
+		case TypeString, TypeNumeric, TypeDate, TypeDuration:
+		default:
+			return nil, fmt.Errorf("uda %q has unsupported type %q", name, typ)
+		}
+
+		parsed = append(parsed, Mapping{Name: name, Property: property, Type: Type(typ)})
+	}
+	return parsed, nil
+}
+
+// Normalise converts a value to the form used when comparing and writing
+// UDAs, so that the same value coming from either side is identical.
+func Normalise(typ Type, value string) (string, error) {
+	switch typ {
+	case TypeNumeric:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid numeric value %q: %w", value, err)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case TypeDate:
+		t, err := parseDate(value)
+		if err != nil {
+			return "", err
+		}
+		return t.UTC().Format(taskwarrior.TimeLayout), nil
+	case TypeDuration:
+		d, err := ParseDuration(value)
+		if err != nil {
+			return "", err
+		}
+		return FormatDuration(d), nil
+	default:
+		return value, nil
+	}
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{taskwarrior.TimeLayout, "20060102T150405", "20060102", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date value %q", value)
+}
+
+var durationRegex = regexp.MustCompile(`^([+-])?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// ParseDuration parses an ISO 8601 duration as written by taskwarrior
+// and iCalendar. Years and months are approximated the same way
+// taskwarrior does, as 365 and 30 days.
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	matches := durationRegex.FindStringSubmatch(value)
+	if matches == nil || strings.HasSuffix(value, "P") || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration value %q", value)
+	}
+
+	units := []time.Duration{
+		365 * 24 * time.Hour,
+		30 * 24 * time.Hour,
+		7 * 24 * time.Hour,
+		24 * time.Hour,
+		time.Hour,
+		time.Minute,
+		time.Second,
+	}
+
+	var d time.Duration
+	for i, unit := range units {
+		if matches[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(matches[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	if matches[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// FormatDuration writes a duration in a form understood by both
+// taskwarrior and iCalendar
+func FormatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	return fmt.Sprintf("%sPT%dS", sign, int64(d/time.Second))
+}
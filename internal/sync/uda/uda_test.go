@@ -0,0 +1,160 @@
+package uda
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseMappings(t *testing.T) {
+	types := map[string]string{
+		"estimate": "numeric",
+		"client":   "string",
+		"ticket":   "string",
+		"start_by": "date",
+		"effort":   "duration",
+		"ok":       "",
+	}
+	udaType := func(name string) (string, error) {
+		typ, exists := types[name]
+		if !exists {
+			return "", fmt.Errorf("no uda %s", name)
+		}
+		return typ, nil
+	}
+
+	tests := []struct {
+		name    string
+		config  map[string]string
+		want    []Mapping
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			config: map[string]string{},
+			want:   []Mapping{},
+		},
+		{
+			name:   "default property",
+			config: map[string]string{"estimate": ""},
+			want:   []Mapping{{Name: "estimate", Property: "X-TASKWARRIOR-ESTIMATE", Type: TypeNumeric}},
+		},
+		{
+			name:   "standard property",
+			config: map[string]string{"ticket": " url "},
+			want:   []Mapping{{Name: "ticket", Property: "URL", Type: TypeString}},
+		},
+		{
+			name:   "sorted by name",
+			config: map[string]string{"start_by": "", "effort": "", "client": "LOCATION"},
+			want: []Mapping{
+				{Name: "client", Property: "LOCATION", Type: TypeString},
+				{Name: "effort", Property: "X-TASKWARRIOR-EFFORT", Type: TypeDuration},
+				{Name: "start_by", Property: "X-TASKWARRIOR-START_BY", Type: TypeDate},
+			},
+		},
+		{
+			name:    "undefined uda",
+			config:  map[string]string{"ok": ""},
+			wantErr: true,
+		},
+		{
+			name:    "type lookup fails",
+			config:  map[string]string{"missing": ""},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMappings(tt.config, udaType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	tests := []struct {
+		typ     Type
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{TypeString, " as is ", " as is ", false},
+		{TypeNumeric, "1.50", "1.5", false},
+		{TypeNumeric, " 3 ", "3", false},
+		{TypeNumeric, "three", "", true},
+		{TypeDate, "20250613T101500Z", "20250613T101500Z", false},
+		{TypeDate, "2025-06-13T20:15:00+10:00", "20250613T101500Z", false},
+		{TypeDate, "20250613", "20250613T000000Z", false},
+		{TypeDate, "tomorrow", "", true},
+		{TypeDuration, "P1DT2H", "PT93600S", false},
+		{TypeDuration, "PT90M", "PT5400S", false},
+		{TypeDuration, "soon", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.typ, tt.value), func(t *testing.T) {
+			got, err := Normalise(tt.typ, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT15M", 15 * time.Minute, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"p1y", 365 * 24 * time.Hour, false},
+		{"P1M", 30 * 24 * time.Hour, false},
+		{"P1DT1H1M1S", 25*time.Hour + time.Minute + time.Second, false},
+		{"P", 0, true},
+		{"P1DT", 0, true},
+		{"15 minutes", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAlarms(t *testing.T) {
+	got, err := ParseAlarms("PT1H, -PT15M,,PT1H")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{-15 * time.Minute, time.Hour}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if formatted := FormatAlarms(got); formatted != "-PT900S,PT3600S" {
+		t.Errorf("FormatAlarms = %q", formatted)
+	}
+	if _, err := ParseAlarms("PT1H,later"); err == nil {
+		t.Error("expected an error for an invalid alarm")
+	}
+}
@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/local/memory"
+	"github.com/karsai5/tw-caldav/internal/remote"
+	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/vdir"
+)
+
+func TestSyncWithVdir(t *testing.T) {
+	root := t.TempDir()
+	backend, err := vdir.NewService(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := remote.NewService(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sp := SyncProcess{local: memory.New(), remote: rs, synctime: time.Now()}
+
+	id, err := sp.local.AddTask(newTask("Water the plants", withId(id1), withProject("home")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sp.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	synced, _ := sp.local.GetTask(id)
+	if synced.RemotePath() == nil || *synced.RemotePath() != "home/"+id1+".ics" {
+		t.Fatalf("remote path = %v", synced.RemotePath())
+	}
+	file := filepath.Join(root, "home", id1+".ics")
+	if _, err := os.Stat(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another client adds a todo, and leaves a file behind it can't parse
+	files := map[string]string{
+		"khal.ics": "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//khal//EN\r\nBEGIN:VTODO\r\n" +
+			"UID:khal-todo\r\nDTSTAMP:20250613T090000Z\r\nSUMMARY:Buy milk\r\nEND:VTODO\r\nEND:VCALENDAR\r\n",
+		"broken.ics": "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:never closed\r\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, "home", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sp.synctime = time.Now()
+	if err := sp.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := sp.local.GetAllTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := descriptions(tasks); len(got) != 2 || got[0] != "Buy milk" || got[1] != "Water the plants" {
+		t.Fatalf("local tasks = %v", got)
+	}
+	for _, lt := range tasks {
+		if lt.Project() != "home" {
+			t.Errorf("project of %q = %q, want home", lt.Description(), lt.Project())
+		}
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	sp.synctime = time.Now()
+	if err := sp.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := sp.local.GetTask(id)
+	if current.Status() != task.StatusDeleted {
+		t.Error("local task of the removed file wasn't deleted")
+	}
+}
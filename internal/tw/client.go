@@ -3,103 +3,317 @@ package tw
 import (
 	"fmt"
 	"log/slog"
-	"regexp"
+	"maps"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/karsai5/tw-caldav/internal/local"
+	"github.com/karsai5/tw-caldav/internal/sync/priority"
+	"github.com/karsai5/tw-caldav/internal/sync/tags"
 	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
 	"github.com/karsai5/tw-caldav/internal/utils/conv"
 	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
 )
 
 type Taskwarrior struct {
+	store store
+}
+
+// New returns the local backend selected with the backend key. Either
+// "cli" (the default) to run the task binary, or "taskchampion" to use
+// the Taskwarrior 3 replica at taskchampion_path directly.
+func New() (*Taskwarrior, error) {
+	switch backend := viper.GetString("backend"); backend {
+	case "", "cli":
+		return &Taskwarrior{store: cliStore{}}, nil
+	case "taskchampion":
+		replica, err := newReplicaStore(viper.GetString("taskchampion_path"))
+		if err != nil {
+			return nil, fmt.Errorf("While opening taskchampion replica: %w", err)
+		}
+		return &Taskwarrior{store: replica}, nil
+	default:
+		return nil, fmt.Errorf("Unknown backend %q", backend)
+	}
 }
 
-func (tw *Taskwarrior) GetTask(uuid string) (Task, error) {
-	rawTasks, err := taskwarrior.List(fmt.Sprintf("uuid:%s", uuid))
+func (tw *Taskwarrior) getStore() store {
+	if tw == nil || tw.store == nil {
+		return cliStore{}
+	}
+	return tw.store
+}
+
+var _ local.Store = &Taskwarrior{}
+
+// GetTask implements local.Store.
+func (tw *Taskwarrior) GetTask(uuid string) (task.Task, error) {
+	t, err := tw.getTask(uuid)
 	if err != nil {
-		return Task{}, fmt.Errorf("While getting tasks from taskwarrior: %w", err)
+		return nil, err
 	}
-	if len(rawTasks) != 1 {
-		return Task{}, fmt.Errorf("Wrong number of tasks returned, expected 1 got %d", len(rawTasks))
+	return t, nil
+}
+
+func (tw *Taskwarrior) getTask(uuid string) (*Task, error) {
+	rawTask, err := tw.getStore().get(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("While getting tasks from taskwarrior: %w", err)
 	}
-	return Task{task: rawTasks[0]}, err
+	return &Task{task: rawTask, tw: tw}, nil
 }
 
-func (t *Taskwarrior) GetAllTasks() (tasks []Task, err error) {
-	// rawTasks, err := taskwarrior.List("+PENDING or +COMPLETED")
-	rawTasks, err := taskwarrior.List("+PENDING or (+COMPLETED and modified.after:2025-06-13)")
+// GetAllTasks implements local.Store.
+func (tw *Taskwarrior) GetAllTasks() (tasks []task.Task, err error) {
+	rawTasks, err := tw.getStore().list()
 	if err != nil {
 		return tasks, fmt.Errorf("While getting tasks from taskwarrior: %w", err)
 	}
 	for _, t := range rawTasks {
-		tasks = append(tasks, Task{task: t})
+		tasks = append(tasks, &Task{task: t, tw: tw})
 	}
 	return tasks, err
 }
 
-func (tw *Taskwarrior) AddTask(t task.Task) (uuid string, err error) {
-	addCmdOpts := append([]string{
-		"add",
-		t.Description(),
-	}, createCmdOptionsForMetadata(t)...)
-
-	out, err := taskwarrior.Run(addCmdOpts...)
+// FindTasks returns the tasks matching a taskwarrior filter, such as
+// "project:home +next". An empty filter returns every task, including
+// deleted ones.
+func (tw *Taskwarrior) FindTasks(filter string) (tasks []task.Task, err error) {
+	rawTasks, err := tw.getStore().filter(filter)
 	if err != nil {
-		return "", fmt.Errorf("While adding task: %w", err)
+		return tasks, fmt.Errorf("While getting tasks from taskwarrior: %w", err)
+	}
+	for _, t := range rawTasks {
+		tasks = append(tasks, &Task{task: t, tw: tw})
 	}
+	return tasks, nil
+}
 
-	taskNumber, err := extractNumber(out)
+// UpdateTask implements local.Store.
+func (tw *Taskwarrior) UpdateTask(uuid string, u task.Task) error {
+	existing, err := tw.getTask(uuid)
 	if err != nil {
-		return "", fmt.Errorf("While getting tasknumber: %w", err)
+		return err
 	}
+	_, err = existing.Update(u)
+	return err
+}
 
-	uuid, err = taskwarrior.Run("_get", fmt.Sprintf("%d.uuid", taskNumber))
+// DeleteTask implements local.Store.
+func (tw *Taskwarrior) DeleteTask(uuid string) error {
+	if err := tw.getStore().delete(uuid); err != nil {
+		return fmt.Errorf("Error deleting task: %w", err)
+	}
+	return nil
+}
+
+// ApplyChanges implements local.Store. All changes are written with a
+// single import.
+func (tw *Taskwarrior) ApplyChanges(changes []local.Change) ([]string, error) {
+	batch := Batch{}
+	ids := []string{}
+	for _, c := range changes {
+		switch c.Type {
+		case local.ChangeAdd:
+			ids = append(ids, batch.Add(c.Task))
+		case local.ChangeUpdate, local.ChangeDelete:
+			existing, err := tw.getTask(c.Id)
+			if err != nil {
+				return nil, err
+			}
+			if c.Type == local.ChangeUpdate {
+				batch.Update(existing, c.Task)
+			} else {
+				batch.Delete(existing)
+			}
+			ids = append(ids, c.Id)
+		}
+	}
+	if err := tw.Apply(&batch); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// RenameProject implements local.ProjectRenamer. Every task of the
+// project is changed, whatever its status, with a single import.
+func (tw *Taskwarrior) RenameProject(from, to string) error {
+	rawTasks, err := tw.getStore().project(from)
 	if err != nil {
-		return "", fmt.Errorf("While getting uuid of task: %w", err)
+		return fmt.Errorf("While getting tasks of project: %w", err)
+	}
+	now := time.Now().UTC()
+	batch := Batch{}
+	for _, raw := range rawTasks {
+		raw.Project = to
+		raw.Modified = now
+		batch.tasks = append(batch.tasks, raw)
+	}
+	if err := tw.Apply(&batch); err != nil {
+		return fmt.Errorf("While renaming project: %w", err)
 	}
+	return nil
+}
 
-	uuid = strings.TrimSpace(uuid)
+func (tw *Taskwarrior) AddTask(t task.Task) (uuid string, err error) {
+	batch := Batch{}
+	uuid = batch.Add(t)
+	if err := tw.Apply(&batch); err != nil {
+		return "", fmt.Errorf("While adding task: %w", err)
+	}
+	slog.Debug("Adding task", "uuid", uuid)
+	return uuid, nil
+}
+
+// Batch collects changes to tasks so they can be written to taskwarrior
+// with a single task import
+type Batch struct {
+	tasks []taskwarrior.Task
+}
 
-	slog.Debug("Adding task", "id", taskNumber, "uuid", uuid)
+// Add queues a new task and returns the uuid it will be created with. The
+// task's LocalId is used as the uuid when set.
+func (b *Batch) Add(t task.Task) string {
+	raw := taskwarrior.Task{UUID: uuid.NewString()}
+	if t.LocalId() != nil {
+		raw.UUID = *t.LocalId()
+	}
+	applyTask(&raw, t)
+	b.tasks = append(b.tasks, raw)
+	return raw.UUID
+}
+
+// Update queues changes to an existing task. Fields tw-caldav doesn't
+// sync, like annotations or dependencies, are kept.
+func (b *Batch) Update(existing *Task, u task.Task) {
+	raw := existing.task
+	raw.Extra = maps.Clone(existing.task.Extra)
+	applyTask(&raw, u)
+	b.tasks = append(b.tasks, raw)
+}
+
+// Delete queues marking an existing task as deleted
+func (b *Batch) Delete(existing *Task) {
+	now := time.Now().UTC()
+	raw := existing.task
+	raw.Status = "deleted"
+	raw.End = &now
+	raw.Modified = now
+	b.tasks = append(b.tasks, raw)
+}
 
-	return uuid, err
+func (b *Batch) Len() int {
+	return len(b.tasks)
 }
 
-func createCmdOptionsForMetadata(t task.Task) []string {
-	opts := []string{
-		fmt.Sprintf("description:%q", t.Description()),
-		fmt.Sprintf("remotepath:%q", conv.SafeStringPtr(t.RemotePath())),
-		fmt.Sprintf("project:%q", escapeQuotes(t.Project())),
-		fmt.Sprintf("priority:%s", t.Priority().String()),
-		fmt.Sprintf("status:%s", t.Status().String()),
+// Apply writes all changes in the batch to taskwarrior
+func (tw *Taskwarrior) Apply(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
 	}
+	if err := tw.getStore().importTasks(b.tasks...); err != nil {
+		return err
+	}
+	slog.Debug("Tasks imported", "num", b.Len())
+	b.tasks = nil
+	return nil
+}
 
-	if t.Due() != nil {
-		opts = append(opts, fmt.Sprintf("due:%s", t.Due().Format(time.RFC3339)))
-	} else {
-		opts = append(opts, "due:''")
+// applyTask copies everything that is synced from t onto a raw
+// taskwarrior task
+func applyTask(raw *taskwarrior.Task, t task.Task) {
+	now := time.Now().UTC()
+
+	raw.Description = t.Description()
+	raw.Project = t.Project()
+	raw.RemotePath = conv.SafeStringPtr(t.RemotePath())
+	raw.Due = t.Due()
+	raw.Modified = now
+
+	switch t.Status() {
+	case task.StatusComplete:
+		raw.Status = "completed"
+	case task.StatusDeleted:
+		raw.Status = "deleted"
+	default:
+		raw.Status = "pending"
+	}
+
+	if t.Created() != nil {
+		raw.Entry = t.Created()
+	} else if raw.Entry == nil {
+		raw.Entry = &now
 	}
 
-	safeTags := []string{}
+	if raw.Status == "pending" {
+		raw.End = nil
+	} else if t.Completed() != nil {
+		raw.End = t.Completed()
+	} else if raw.End == nil {
+		raw.End = &now
+	}
+
+	applyPriority(raw, t.Priority())
+
+	if uda.SyncProgress() {
+		raw.Progress = nil
+		if t.Progress() != nil {
+			progress := float64(*t.Progress())
+			raw.Progress = &progress
+		}
+	}
+
+	for _, m := range uda.Mappings() {
+		raw.SetUDA(m.Name, udaValue(m, t.UDAs()))
+	}
+
+	if name := uda.AlarmUDA(); name != "" {
+		if alarms := uda.FormatAlarms(t.Alarms()); alarms != "" {
+			raw.SetUDA(name, alarms)
+		} else {
+			raw.SetUDA(name, nil)
+		}
+	}
+
+	raw.Tags = []string{}
 	for _, tag := range t.Tags() {
-		if strings.Contains(tag, " ") {
-			slog.Error("Cannot add tag with spaces", "tag", tag)
+		if !tags.IsValid(tag) {
+			slog.Error("Cannot add invalid tag, enable tag_slug to convert it", "tag", tag)
 			continue
 		}
-		safeTags = append(safeTags, tag)
+		raw.Tags = append(raw.Tags, tag)
 	}
-	opts = append(opts, fmt.Sprintf("tags:%q", strings.Join(safeTags, ",")))
-	return opts
 }
 
-func extractNumber(s string) (int, error) {
-	re := regexp.MustCompile(`\d+`)
-	numStr := re.FindString(s)
-	return strconv.Atoi(numStr)
+func applyPriority(raw *taskwarrior.Task, p task.Priority) {
+	mapping := priority.Current()
+	level := mapping.Label(int(p))
+	if mapping.UDA == "" {
+		raw.Priority = level
+		return
+	}
+	if p == task.PriorityUnset {
+		raw.SetUDA(mapping.UDA, nil)
+	} else {
+		raw.SetUDA(mapping.UDA, level)
+	}
 }
 
-func escapeQuotes(str string) string {
-	return strings.ReplaceAll(str, `"`, `\"`)
+// udaValue returns the value of a mapped UDA in the type taskwarrior
+// exports it as, or nil if the task doesn't have it
+func udaValue(m uda.Mapping, udas map[string]string) any {
+	value, exists := udas[m.Name]
+	if !exists {
+		return nil
+	}
+	if m.Type == uda.TypeNumeric {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
 }
@@ -0,0 +1,90 @@
+package tw
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	"github.com/spf13/viper"
+)
+
+// completedSince returns the oldest modification of a completed task that
+// is still synced, set with the completed_since key as a date or as a
+// duration before now, e.g. P30D. The zero time, the default, syncs every
+// completed task.
+func completedSince(now time.Time) (time.Time, error) {
+	value := viper.GetString("completed_since")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return date, nil
+	}
+	d, err := uda.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("While reading completed_since: expected a date or a duration, got %q", value)
+	}
+	return now.Add(-d), nil
+}
+
+// store is where tasks are read from and written to
+type store interface {
+	// list returns the tasks that take part in syncing
+	list() ([]taskwarrior.Task, error)
+	// filter returns the tasks matching a taskwarrior filter, every task
+	// when the filter is empty
+	filter(filter string) ([]taskwarrior.Task, error)
+	// project returns every task of a project, whatever its status
+	project(name string) ([]taskwarrior.Task, error)
+	get(uuid string) (taskwarrior.Task, error)
+	importTasks(tasks ...taskwarrior.Task) error
+	delete(uuid string) error
+}
+
+// cliStore runs the task binary for every read and write
+type cliStore struct{}
+
+func (cliStore) list() ([]taskwarrior.Task, error) {
+	since, err := completedSince(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if since.IsZero() {
+		return taskwarrior.List("+PENDING or +COMPLETED")
+	}
+	return taskwarrior.List(fmt.Sprintf("+PENDING or (+COMPLETED and modified.after:%s)", since.UTC().Format(taskwarrior.TimeLayout)))
+}
+
+func (cliStore) filter(filter string) ([]taskwarrior.Task, error) {
+	return taskwarrior.List(filter)
+}
+
+func (cliStore) project(name string) ([]taskwarrior.Task, error) {
+	return taskwarrior.List(fmt.Sprintf("project.is:%s", name))
+}
+
+func (cliStore) get(uuid string) (taskwarrior.Task, error) {
+	rawTasks, err := taskwarrior.List(fmt.Sprintf("uuid:%s", uuid))
+	if err != nil {
+		return taskwarrior.Task{}, err
+	}
+	if len(rawTasks) != 1 {
+		return taskwarrior.Task{}, fmt.Errorf("Wrong number of tasks returned, expected 1 got %d", len(rawTasks))
+	}
+	return rawTasks[0], nil
+}
+
+func (cliStore) importTasks(tasks ...taskwarrior.Task) error {
+	_, err := taskwarrior.Import(tasks...)
+	return err
+}
+
+func (cliStore) delete(uuid string) error {
+	out, err := taskwarrior.Run("rc.confirmation=off", fmt.Sprintf("uuid:%s", uuid), "delete")
+	if err != nil {
+		return fmt.Errorf("%s: %w", out, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package tw
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
+	"github.com/karsai5/tw-caldav/pkg/taskchampion"
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+)
+
+// replicaStore reads and writes the Taskwarrior 3 replica directly
+type replicaStore struct {
+	replica *taskchampion.Replica
+}
+
+func newReplicaStore(path string) (*replicaStore, error) {
+	if path == "" {
+		path = taskchampion.DefaultPath
+	}
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, rest)
+	}
+
+	replica, err := taskchampion.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	replica.DateUDAs = []string{}
+	for _, m := range uda.Mappings() {
+		if m.Type == uda.TypeDate {
+			replica.DateUDAs = append(replica.DateUDAs, m.Name)
+		}
+	}
+	return &replicaStore{replica: replica}, nil
+}
+
+func (s *replicaStore) list() ([]taskwarrior.Task, error) {
+	since, err := completedSince(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	all, err := s.replica.All()
+	if err != nil {
+		return nil, err
+	}
+	tasks := []taskwarrior.Task{}
+	for _, t := range all {
+		switch {
+		case t.Status == "pending":
+			tasks = append(tasks, t)
+		case t.Status == "completed" && t.Modified.After(since):
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
+}
+
+// filter has the task binary evaluate filters, TaskChampion has no
+// filter language of its own
+func (s *replicaStore) filter(filter string) ([]taskwarrior.Task, error) {
+	if filter == "" {
+		return s.replica.All()
+	}
+	return taskwarrior.List(filter)
+}
+
+// project reads the replica itself, unlike filter, so syncing never runs
+// the task binary
+func (s *replicaStore) project(name string) ([]taskwarrior.Task, error) {
+	all, err := s.replica.All()
+	if err != nil {
+		return nil, err
+	}
+	tasks := []taskwarrior.Task{}
+	for _, t := range all {
+		if t.Project == name {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
+}
+
+func (s *replicaStore) get(uuid string) (taskwarrior.Task, error) {
+	return s.replica.Get(uuid)
+}
+
+func (s *replicaStore) importTasks(tasks ...taskwarrior.Task) error {
+	return s.replica.Import(tasks...)
+}
+
+func (s *replicaStore) delete(uuid string) error {
+	return s.replica.Delete(uuid)
+}
@@ -0,0 +1,89 @@
+package tw
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+)
+
+// newTestReplicaStore creates an empty replica with the schema of
+// Taskwarrior 3.x
+func newTestReplicaStore(t *testing.T) *replicaStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "taskchampion.sqlite3")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`CREATE TABLE operations (id INTEGER PRIMARY KEY AUTOINCREMENT, data STRING)`,
+		`CREATE TABLE sync_meta (key STRING PRIMARY KEY, value STRING)`,
+		`CREATE TABLE tasks (uuid STRING PRIMARY KEY, data STRING)`,
+		`CREATE TABLE working_set (id INTEGER PRIMARY KEY, uuid STRING)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := newReplicaStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.replica.Close() })
+	return s
+}
+
+func TestRenameProjectReplica(t *testing.T) {
+	// Renaming must not need the task binary
+	t.Setenv("PATH", t.TempDir())
+
+	s := newTestReplicaStore(t)
+	entry := time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC)
+	end := entry.Add(time.Hour)
+	tasks := []taskwarrior.Task{
+		{UUID: "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60", Description: "Water the plants", Project: "home", Status: "pending", Entry: &entry, Modified: entry},
+		{UUID: "a2b0c7a4-0c3d-4b8e-8f7a-6e5d4c3b2a10", Description: "Mow the lawn", Project: "home", Status: "completed", Entry: &entry, End: &end, Modified: end},
+		{UUID: "3f0c1d2e-8a9b-4c5d-8e7f-6a5b4c3d2e1f", Description: "Fix the gate", Project: "home.garden", Status: "pending", Entry: &entry, Modified: entry},
+		{UUID: "9e8d7c6b-5a4f-4e3d-8c2b-1a0f9e8d7c6b", Description: "Do the tax return", Project: "work", Status: "deleted", Entry: &entry, End: &end, Modified: end},
+	}
+	if err := s.importTasks(tasks...); err != nil {
+		t.Fatal(err)
+	}
+
+	tw := &Taskwarrior{store: s}
+	if err := tw.RenameProject("home", "house"); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.replica.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, raw := range all {
+		got = append(got, raw.Description+"|"+raw.Project+"|"+raw.Status)
+		if raw.Project == "house" && !raw.Modified.After(end) {
+			t.Errorf("modified of %q wasn't set", raw.Description)
+		}
+	}
+	slices.Sort(got)
+	want := []string{
+		"Do the tax return|work|deleted",
+		"Fix the gate|home.garden|pending",
+		"Mow the lawn|house|completed",
+		"Water the plants|house|pending",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	if err := tw.RenameProject("nothing", "house"); err != nil {
+		t.Errorf("renaming an empty project: %v", err)
+	}
+}
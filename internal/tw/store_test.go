@@ -0,0 +1,38 @@
+package tw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCompletedSince(t *testing.T) {
+	now := time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "", want: time.Time{}},
+		{value: "2025-06-01", want: time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)},
+		{value: "P30D", want: now.AddDate(0, 0, -30)},
+		{value: "PT12H", want: now.Add(-12 * time.Hour)},
+		{value: "last week", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			viper.Set("completed_since", tt.value)
+			t.Cleanup(func() { viper.Set("completed_since", "") })
+
+			got, err := completedSince(now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,21 @@
 package tw
 
 import (
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
 	"time"
 
+	"github.com/karsai5/tw-caldav/internal/sync/priority"
 	"github.com/karsai5/tw-caldav/internal/sync/task"
+	"github.com/karsai5/tw-caldav/internal/sync/uda"
 	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
 )
 
 type Task struct {
 	task taskwarrior.Task
+	tw   *Taskwarrior
 }
 
 // Status implements task.Task.
@@ -35,11 +41,7 @@ func (t *Task) Due() *time.Time {
 }
 
 func (t *Task) Delete() error {
-	out, err := taskwarrior.Run("rc.confirmation=off", fmt.Sprintf("uuid:%s", *t.LocalId()), "delete")
-	if err != nil {
-		return fmt.Errorf("Error deleting task: %s: %w", out, err)
-	}
-	return nil
+	return t.tw.DeleteTask(*t.LocalId())
 }
 
 // LastModified implements task.Task.
@@ -47,11 +49,69 @@ func (t *Task) LastModified() time.Time {
 	return t.task.Modified
 }
 
+// Created implements task.Task.
+func (t *Task) Created() *time.Time {
+	return t.task.Entry
+}
+
+// Completed implements task.Task.
+func (t *Task) Completed() *time.Time {
+	return t.task.End
+}
+
+// Progress implements task.Task.
+func (t *Task) Progress() *int {
+	if !uda.SyncProgress() || t.task.Progress == nil {
+		return nil
+	}
+	progress := int(math.Round(*t.task.Progress))
+	return &progress
+}
+
+// UDAs implements task.Task.
+func (t *Task) UDAs() map[string]string {
+	udas := map[string]string{}
+	for _, m := range uda.Mappings() {
+		value, exists := t.task.UDA(m.Name)
+		if !exists || value == "" {
+			continue
+		}
+		normalised, err := uda.Normalise(m.Type, value)
+		if err != nil {
+			slog.Error("Could not read uda", "uda", m.Name, "err", err)
+			continue
+		}
+		udas[m.Name] = normalised
+	}
+	return udas
+}
+
+// Alarms implements task.Task.
+func (t *Task) Alarms() []time.Duration {
+	name := uda.AlarmUDA()
+	if name == "" {
+		return nil
+	}
+	value, _ := t.task.UDA(name)
+	alarms, err := uda.ParseAlarms(value)
+	if err != nil {
+		slog.Error("Could not read alarms", "uda", name, "err", err)
+		return nil
+	}
+	return alarms
+}
+
 // LastSynced implements task.Task.
 func (t *Task) LastSynced() *time.Time {
 	return t.task.LastSync
 }
 
+// Raw implements local.RawTask, the task is returned as task export
+// writes it
+func (t *Task) Raw() ([]byte, error) {
+	return json.MarshalIndent(t.task, "", "  ")
+}
+
 // LocalId implements task.Task.
 func (t *Task) LocalId() *string {
 	return &t.task.UUID
@@ -59,18 +119,19 @@ func (t *Task) LocalId() *string {
 
 // Priority implements task.Task.
 func (t *Task) Priority() task.Priority {
-
-	switch t.task.Priority {
-	case "H":
-		return task.PriorityHigh
-	case "M":
-		return task.PriorityMedium
-	case "L":
-		return task.PriorityLow
-	default:
+	mapping := priority.Current()
+	level := t.task.Priority
+	if mapping.UDA != "" {
+		level, _ = t.task.UDA(mapping.UDA)
+	}
+	if level == "" {
 		return task.PriorityUnset
 	}
-
+	value := mapping.Value(level)
+	if value == 0 {
+		slog.Warn("Unknown priority, not syncing it", "priority", level, "uuid", t.task.UUID)
+	}
+	return task.Priority(value)
 }
 
 // Project implements task.Task.
@@ -93,15 +154,18 @@ func (t *Task) Tags() []string {
 
 // Update implements task.Task.
 func (t *Task) Update(u task.Task) (task.Task, error) {
-	modCmdOpts := append(
-		[]string{fmt.Sprintf("uuid:%s", *t.LocalId()), "mod"},
-		createCmdOptionsForMetadata(u)...,
-	)
-
-	out, err := taskwarrior.Run(modCmdOpts...)
+	current, err := t.tw.getTask(t.task.UUID)
 	if err != nil {
-		return nil, fmt.Errorf("While updating local task: %s: %w", string(out), err)
+		return nil, err
+	}
+	if !current.task.Modified.Equal(t.task.Modified) {
+		return nil, fmt.Errorf("Task %s was changed in taskwarrior since it was read", t.task.UUID)
 	}
 
+	batch := Batch{}
+	batch.Update(current, u)
+	if err := t.tw.Apply(&batch); err != nil {
+		return nil, fmt.Errorf("While updating local task: %w", err)
+	}
 	return u, nil
 }
@@ -0,0 +1,27 @@
+// Package origin finds the server in the url key, which may be a
+// hostname, an email address or a url.
+package origin
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Parse returns the scheme and host of the server at address. A hostname
+// or the domain of an email address is assumed to use https.
+func Parse(address string) (*url.URL, error) {
+	address = strings.TrimSpace(address)
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("While parsing url: %w", err)
+		}
+		return &url.URL{Scheme: u.Scheme, Host: u.Host}, nil
+	}
+	host := address
+	if _, domain, found := strings.Cut(address, "@"); found {
+		host = domain
+	}
+	return &url.URL{Scheme: "https", Host: host}, nil
+}
@@ -0,0 +1,25 @@
+package origin
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"https://dav.example.com/remote.php/dav/", "https://dav.example.com"},
+		{"http://localhost:5232/user/", "http://localhost:5232"},
+		{"dav.example.com", "https://dav.example.com"},
+		{"user@example.com", "https://example.com"},
+		{" example.com ", "https://example.com"},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.address, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package vdir stores todos in a vdir, a directory of calendar
+// directories holding one .ics file per item, as used by vdirsyncer and
+// khal.
+package vdir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+
+	"github.com/emersion/go-ical"
+)
+
+const (
+	itemExtension   = ".ics"
+	displayNameFile = "displayname"
+	colorFile       = "color"
+)
+
+func NewService(root string) (*Service, error) {
+	if rest, found := strings.CutPrefix(root, "~/"); found {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		root = filepath.Join(home, rest)
+	}
+	if root == "" {
+		return nil, fmt.Errorf("No vdir path configured")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("While creating vdir: %w", err)
+	}
+	return &Service{Root: root}, nil
+}
+
+// Service reads and writes todos in a vdir. Paths of calendars and items
+// are relative to Root and use forward slashes, like CalDAV paths.
+type Service struct {
+	Root string
+}
+
+var _ remote.Backend = &Service{}
+
+// ListCalendars implements remote.Backend.
+func (s *Service) ListCalendars() ([]remote.Calendar, error) {
+	entries, err := os.ReadDir(s.Root)
+	if err != nil {
+		return nil, fmt.Errorf("While reading vdir: %w", err)
+	}
+	calendars := []remote.Calendar{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		name := entry.Name()
+		if displayName, err := os.ReadFile(filepath.Join(s.Root, name, displayNameFile)); err == nil {
+			if trimmed := strings.TrimSpace(string(displayName)); trimmed != "" {
+				name = trimmed
+			}
+		}
+		color := ""
+		if data, err := os.ReadFile(filepath.Join(s.Root, entry.Name(), colorFile)); err == nil {
+			color = strings.TrimSpace(string(data))
+		}
+		calendars = append(calendars, remote.Calendar{
+			Path:       entry.Name() + "/",
+			Name:       name,
+			Components: []string{ical.CompToDo},
+			Color:      color,
+		})
+	}
+	return calendars, nil
+}
+
+// CreateCalendar implements remote.Backend. The calendar directory is
+// named after the calendar.
+func (s *Service) CreateCalendar(name string) (remote.Calendar, error) {
+	dir := calendarDirName(name)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(s.Root, dir)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		dir = fmt.Sprintf("%s-%d", calendarDirName(name), i)
+	}
+
+	slog.Debug("Creating calendar", "name", name, "path", dir)
+	if err := os.Mkdir(filepath.Join(s.Root, dir), 0o755); err != nil {
+		return remote.Calendar{}, fmt.Errorf("While creating calendar: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.Root, dir, displayNameFile), []byte(name), 0o644); err != nil {
+		return remote.Calendar{}, fmt.Errorf("While writing calendar name: %w", err)
+	}
+
+	return remote.Calendar{
+		Path:       dir + "/",
+		Name:       name,
+		Components: []string{ical.CompToDo},
+	}, nil
+}
+
+// UpdateCalendar implements remote.Backend. The directory keeps its
+// name, the calendar name is kept in the displayname file.
+func (s *Service) UpdateCalendar(cal remote.Calendar) error {
+	dir, err := s.calendarDir(cal.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, displayNameFile), []byte(cal.Name), 0o644); err != nil {
+		return fmt.Errorf("While writing calendar name: %w", err)
+	}
+	if cal.Color == "" {
+		if err := os.Remove(filepath.Join(dir, colorFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("While removing calendar color: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(dir, colorFile), []byte(cal.Color), 0o644); err != nil {
+		return fmt.Errorf("While writing calendar color: %w", err)
+	}
+	return nil
+}
+
+// DeleteCalendar implements remote.Backend.
+func (s *Service) DeleteCalendar(cal remote.Calendar) error {
+	dir, err := s.calendarDir(cal.Path)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Deleting calendar", "path", cal.Path)
+	return os.RemoveAll(dir)
+}
+
+// calendarDir returns the directory of an existing calendar
+func (s *Service) calendarDir(calPath string) (string, error) {
+	cleaned := path.Clean("/" + calPath)
+	if cleaned == "/" || strings.Count(cleaned, "/") != 1 {
+		return "", fmt.Errorf("Invalid vdir calendar path %q", calPath)
+	}
+	dir := filepath.Join(s.Root, filepath.FromSlash(cleaned))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("Calendar %s not found", calPath)
+	}
+	return dir, nil
+}
+
+func calendarDirName(name string) string {
+	dir := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	dir = strings.TrimLeft(dir, ".")
+	if dir == "" {
+		return "calendar"
+	}
+	return dir
+}
+
+// ListItems implements remote.Backend. Items that can't be parsed are
+// logged and left out instead of failing the whole listing.
+func (s *Service) ListItems(cal remote.Calendar) ([]remote.Item, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Root, filepath.FromSlash(cal.Path)))
+	if err != nil {
+		return nil, fmt.Errorf("While reading calendar: %w", err)
+	}
+	items := []remote.Item{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), itemExtension) {
+			continue
+		}
+		item, err := s.GetItem(cal.Path + entry.Name())
+		if err != nil {
+			slog.Warn("Skipping vdir item", "path", cal.Path+entry.Name(), "err", err)
+			continue
+		}
+		if !hasTodo(item.Data) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// CreateItem implements remote.Backend.
+func (s *Service) CreateItem(cal remote.Calendar, uid string, data *ical.Calendar) (remote.Item, error) {
+	itemPath := cal.Path + itemFileName(uid)
+	file, err := s.filePath(itemPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	if _, err := os.Stat(file); err == nil {
+		return remote.Item{}, fmt.Errorf("Item %s already exists", itemPath)
+	}
+	return s.UpdateItem(itemPath, data)
+}
+
+func itemFileName(uid string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, uid)
+	return name + itemExtension
+}
+
+func hasTodo(cal *ical.Calendar) bool {
+	for _, child := range cal.Children {
+		if child.Name == ical.CompToDo {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) filePath(itemPath string) (string, error) {
+	cleaned := path.Clean("/" + itemPath)
+	if cleaned == "/" || strings.Count(cleaned, "/") != 2 {
+		return "", fmt.Errorf("Invalid vdir item path %q", itemPath)
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// GetItem implements remote.Backend.
+func (s *Service) GetItem(itemPath string) (remote.Item, error) {
+	file, err := s.filePath(itemPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return remote.Item{}, fmt.Errorf("While reading item: %w", err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return remote.Item{}, fmt.Errorf("While parsing %s: %w", itemPath, err)
+	}
+	return remote.Item{
+		Path:    itemPath,
+		ETag:    etag(data),
+		ModTime: info.ModTime(),
+		Data:    cal,
+	}, nil
+}
+
+func etag(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:16])
+}
+
+// UpdateItem implements remote.Backend.
+func (s *Service) UpdateItem(itemPath string, data *ical.Calendar) (remote.Item, error) {
+	file, err := s.filePath(itemPath)
+	if err != nil {
+		return remote.Item{}, err
+	}
+	buf := new(bytes.Buffer)
+	if err := ical.NewEncoder(buf).Encode(data); err != nil {
+		return remote.Item{}, fmt.Errorf("While encoding item: %w", err)
+	}
+	slog.Debug("Writing vdir item", "path", itemPath)
+
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return remote.Item{}, fmt.Errorf("While writing item: %w", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return remote.Item{}, err
+	}
+	return remote.Item{
+		Path:    itemPath,
+		ETag:    etag(buf.Bytes()),
+		ModTime: time.Now(),
+		Data:    data,
+	}, nil
+}
+
+// MoveItem implements remote.Backend.
+func (s *Service) MoveItem(itemPath string, to remote.Calendar) (string, error) {
+	newPath := to.Path + path.Base(itemPath)
+	fromFile, err := s.filePath(itemPath)
+	if err != nil {
+		return "", err
+	}
+	toFile, err := s.filePath(newPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(toFile); err == nil {
+		return "", fmt.Errorf("Item %s already exists", newPath)
+	}
+	if err := os.Rename(fromFile, toFile); err != nil {
+		return "", err
+	}
+	return newPath, nil
+}
+
+// DeleteItem implements remote.Backend.
+func (s *Service) DeleteItem(itemPath string) error {
+	file, err := s.filePath(itemPath)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
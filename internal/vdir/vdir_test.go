@@ -0,0 +1,228 @@
+package vdir
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/internal/remote"
+
+	"github.com/emersion/go-ical"
+)
+
+func newTodo(uid string, summary string) *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//test//EN")
+	todo := ical.NewComponent(ical.CompToDo)
+	todo.Props.SetText(ical.PropUID, uid)
+	todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Date(2025, 6, 13, 9, 0, 0, 0, time.UTC))
+	todo.Props.SetText(ical.PropSummary, summary)
+	cal.Children = append(cal.Children, todo)
+	return cal
+}
+
+func summary(t *testing.T, item remote.Item) string {
+	t.Helper()
+	for _, child := range item.Data.Children {
+		if child.Name == ical.CompToDo {
+			text, err := child.Props.Text(ical.PropSummary)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return text
+		}
+	}
+	t.Fatalf("item %s has no todo", item.Path)
+	return ""
+}
+
+func itemPaths(items []remote.Item) []string {
+	paths := []string{}
+	for _, item := range items {
+		paths = append(paths, item.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s, err := NewService(filepath.Join(t.TempDir(), "vdir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCalendars(t *testing.T) {
+	s := newTestService(t)
+
+	work, err := s.CreateCalendar("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.CreateCalendar("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd, err := s.CreateCalendar("../a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.Path != "work/" || again.Path != "work-2/" || odd.Path != "-a-b/" {
+		t.Errorf("paths = %q, %q, %q", work.Path, again.Path, odd.Path)
+	}
+
+	work.Name = "job"
+	work.Color = "#FF0000"
+	if err := s.UpdateCalendar(work); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteCalendar(again); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(s.Root, ".hidden"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	calendars, err := s.ListCalendars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []remote.Calendar{
+		{Path: "-a-b/", Name: "../a/b", Components: []string{ical.CompToDo}},
+		{Path: "work/", Name: "job", Components: []string{ical.CompToDo}, Color: "#FF0000"},
+	}
+	if len(calendars) != len(want) {
+		t.Fatalf("got %v, want %v", calendars, want)
+	}
+	for i := range want {
+		got := calendars[i]
+		if got.Path != want[i].Path || got.Name != want[i].Name || got.Color != want[i].Color || !slices.Equal(got.Components, want[i].Components) {
+			t.Errorf("calendar %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	work.Color = ""
+	if err := s.UpdateCalendar(work); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "work", colorFile)); !os.IsNotExist(err) {
+		t.Errorf("color file kept: %v", err)
+	}
+	if err := s.UpdateCalendar(remote.Calendar{Path: "../outside/"}); err == nil {
+		t.Error("calendar outside the vdir was updated")
+	}
+}
+
+func TestItems(t *testing.T) {
+	s := newTestService(t)
+	work, err := s.CreateCalendar("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := s.CreateCalendar("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := s.CreateItem(work, "a/b", newTodo("a/b", "Water the plants"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Path != "work/a_b.ics" {
+		t.Errorf("path = %q", created.Path)
+	}
+	if _, err := s.CreateItem(work, "a/b", newTodo("a/b", "again")); err == nil {
+		t.Error("item was created twice")
+	}
+
+	got, err := s.GetItem(created.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary(t, got) != "Water the plants" || got.ETag != created.ETag {
+		t.Errorf("got %q with etag %q, want etag %q", summary(t, got), got.ETag, created.ETag)
+	}
+
+	updated, err := s.UpdateItem(created.Path, newTodo("a/b", "Water the garden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ETag == created.ETag {
+		t.Error("etag didn't change")
+	}
+
+	moved, err := s.MoveItem(created.Path, home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != "home/a_b.ics" {
+		t.Errorf("moved to %q", moved)
+	}
+	items, err := s.ListItems(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(items); !slices.Equal(paths, []string{"home/a_b.ics"}) {
+		t.Fatalf("items = %v", paths)
+	}
+	if summary(t, items[0]) != "Water the garden" {
+		t.Errorf("summary = %q", summary(t, items[0]))
+	}
+
+	if err := s.DeleteItem(moved); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetItem(moved); err == nil {
+		t.Error("deleted item was found")
+	}
+	if _, err := s.GetItem("../../etc/passwd"); err == nil {
+		t.Error("item outside the vdir was read")
+	}
+}
+
+func TestListItemsSkipsOtherFiles(t *testing.T) {
+	s := newTestService(t)
+	cal, err := s.CreateCalendar("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateItem(cal, "todo", newTodo("todo", "Water the plants")); err != nil {
+		t.Fatal(err)
+	}
+
+	event := ical.NewCalendar()
+	event.Props.SetText(ical.PropVersion, "2.0")
+	event.Props.SetText(ical.PropProductID, "-//test//EN")
+	eventComp := ical.NewEvent()
+	eventComp.Props.SetText(ical.PropUID, "event")
+	eventComp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
+	eventComp.Props.SetDateTime(ical.PropDateTimeStart, time.Now())
+	event.Children = append(event.Children, eventComp.Component)
+	if _, err := s.UpdateItem("work/event.ics", event); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(s.Root, "work")
+	files := map[string]string{
+		"broken.ics": "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nSUMMARY:never closed\r\n",
+		"notes.txt":  "not an item",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := s.ListItems(cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if paths := itemPaths(items); !slices.Equal(paths, []string{"work/todo.ics"}) {
+		t.Errorf("items = %v, want only the todo", paths)
+	}
+}
@@ -0,0 +1,232 @@
+package taskchampion
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+)
+
+const (
+	tagPrefix        = "tag_"
+	annotationPrefix = "annotation_"
+	dependencyPrefix = "dep_"
+
+	// presentValue is the value taskwarrior stores for tags and
+	// dependencies, only the key carries information
+	presentValue = "x"
+)
+
+// builtinDates are the attributes taskwarrior stores as dates, apart from
+// those with their own field in taskwarrior.Task
+var builtinDates = []string{"scheduled", "until", "start"}
+
+type annotation struct {
+	Entry       string `json:"entry"`
+	Description string `json:"description"`
+}
+
+func (r *Replica) isDate(key string) bool {
+	return slices.Contains(builtinDates, key) || slices.Contains(r.DateUDAs, key)
+}
+
+// toTask converts a TaskChampion task map to the export format
+func (r *Replica) toTask(uuid string, taskMap map[string]string) (taskwarrior.Task, error) {
+	t := taskwarrior.Task{UUID: uuid}
+	annotations := []annotation{}
+	depends := []string{}
+
+	for key, value := range taskMap {
+		var err error
+		switch {
+		case key == "description":
+			t.Description = value
+		case key == "project":
+			t.Project = value
+		case key == "status":
+			t.Status = value
+		case key == "priority":
+			t.Priority = value
+		case key == "remotepath":
+			t.RemotePath = value
+		case key == "caldavid":
+			t.CalDavId = value
+		case key == "entry":
+			t.Entry, err = parseTimestamp(value)
+		case key == "end":
+			t.End, err = parseTimestamp(value)
+		case key == "due":
+			t.Due, err = parseTimestamp(value)
+		case key == "lastsync":
+			t.LastSync, err = parseTimestamp(value)
+		case key == "modified":
+			var modified *time.Time
+			modified, err = parseTimestamp(value)
+			if modified != nil {
+				t.Modified = *modified
+			}
+		case key == "wait":
+			var wait *time.Time
+			wait, err = parseTimestamp(value)
+			if wait != nil {
+				t.Wait = wait.Format(taskwarrior.TimeLayout)
+			}
+		case key == "progress":
+			var progress float64
+			progress, err = strconv.ParseFloat(value, 64)
+			t.Progress = &progress
+		case strings.HasPrefix(key, tagPrefix):
+			t.Tags = append(t.Tags, strings.TrimPrefix(key, tagPrefix))
+		case strings.HasPrefix(key, dependencyPrefix):
+			depends = append(depends, strings.TrimPrefix(key, dependencyPrefix))
+		case strings.HasPrefix(key, annotationPrefix):
+			var entry *time.Time
+			entry, err = parseTimestamp(strings.TrimPrefix(key, annotationPrefix))
+			if entry != nil {
+				annotations = append(annotations, annotation{
+					Entry:       entry.Format(taskwarrior.TimeLayout),
+					Description: value,
+				})
+			}
+		case r.isDate(key):
+			var date *time.Time
+			date, err = parseTimestamp(value)
+			if date != nil {
+				err = t.SetUDA(key, date.Format(taskwarrior.TimeLayout))
+			}
+		default:
+			err = t.SetUDA(key, value)
+		}
+		if err != nil {
+			return t, fmt.Errorf("while reading %s of task %s: %w", key, uuid, err)
+		}
+	}
+
+	slices.Sort(t.Tags)
+	if len(annotations) > 0 {
+		slices.SortFunc(annotations, func(a, b annotation) int { return strings.Compare(a.Entry, b.Entry) })
+		t.SetUDA("annotations", annotations)
+	}
+	if len(depends) > 0 {
+		slices.Sort(depends)
+		t.SetUDA("depends", depends)
+	}
+	return t, nil
+}
+
+// fromTask converts a task in the export format to a TaskChampion task map
+func (r *Replica) fromTask(t taskwarrior.Task) (map[string]string, error) {
+	taskMap := map[string]string{}
+	setString := func(key string, value string) {
+		if value != "" {
+			taskMap[key] = value
+		}
+	}
+	setTime := func(key string, value *time.Time) {
+		if value != nil && !value.IsZero() {
+			taskMap[key] = formatTimestamp(*value)
+		}
+	}
+
+	setString("description", t.Description)
+	setString("project", t.Project)
+	setString("status", t.Status)
+	setString("priority", t.Priority)
+	setString("remotepath", t.RemotePath)
+	setString("caldavid", t.CalDavId)
+	setTime("entry", t.Entry)
+	setTime("end", t.End)
+	setTime("due", t.Due)
+	setTime("lastsync", t.LastSync)
+	setTime("modified", &t.Modified)
+	if t.Wait != "" {
+		wait, err := time.Parse(taskwarrior.TimeLayout, t.Wait)
+		if err != nil {
+			return nil, fmt.Errorf("while converting wait of task %s: %w", t.UUID, err)
+		}
+		setTime("wait", &wait)
+	}
+	if t.Progress != nil {
+		taskMap["progress"] = strconv.FormatFloat(*t.Progress, 'f', -1, 64)
+	}
+	for _, tag := range t.Tags {
+		taskMap[tagPrefix+tag] = presentValue
+	}
+
+	for key, raw := range t.Extra {
+		if err := r.setExtra(taskMap, key, raw); err != nil {
+			return nil, fmt.Errorf("while converting %s of task %s: %w", key, t.UUID, err)
+		}
+	}
+	return taskMap, nil
+}
+
+func (r *Replica) setExtra(taskMap map[string]string, key string, raw json.RawMessage) error {
+	switch key {
+	case "annotations":
+		annotations := []annotation{}
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			return err
+		}
+		for _, a := range annotations {
+			entry, err := time.Parse(taskwarrior.TimeLayout, a.Entry)
+			if err != nil {
+				return err
+			}
+			taskMap[annotationPrefix+formatTimestamp(entry)] = a.Description
+		}
+		return nil
+	case "depends":
+		depends := []string{}
+		if err := json.Unmarshal(raw, &depends); err != nil {
+			// Older versions of taskwarrior export a comma separated string
+			var joined string
+			if err := json.Unmarshal(raw, &joined); err != nil {
+				return err
+			}
+			depends = strings.Split(joined, ",")
+		}
+		for _, dep := range depends {
+			taskMap[dependencyPrefix+strings.TrimSpace(dep)] = presentValue
+		}
+		return nil
+	case "id", "urgency":
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err != nil {
+		// Numbers and anything else are stored as they appear
+		taskMap[key] = string(raw)
+		return nil
+	}
+	if r.isDate(key) {
+		date, err := time.Parse(taskwarrior.TimeLayout, str)
+		if err != nil {
+			return err
+		}
+		str = formatTimestamp(date)
+	}
+	taskMap[key] = str
+	return nil
+}
+
+func parseTimestamp(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %w", value, err)
+	}
+	t := time.Unix(seconds, 0).UTC()
+	return &t, nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
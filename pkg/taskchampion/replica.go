@@ -0,0 +1,273 @@
+// Package taskchampion reads and writes the TaskChampion replica that
+// Taskwarrior 3 keeps its tasks in, without running the task binary.
+//
+// Every change is recorded as an operation, the same way taskwarrior
+// records them, so task undo and task sync keep working.
+package taskchampion
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+
+	_ "modernc.org/sqlite"
+)
+
+// DefaultPath is where Taskwarrior 3 keeps its replica
+const DefaultPath = "~/.task/taskchampion.sqlite3"
+
+type Replica struct {
+	db *sql.DB
+
+	// DateUDAs lists UDAs of type date. TaskChampion stores dates as unix
+	// timestamps, they are converted to and from the export format.
+	DateUDAs []string
+}
+
+// Open opens an existing replica, it is never created
+func Open(path string) (*Replica, error) {
+	dsn := fmt.Sprintf("file:%s?mode=rw&_pragma=busy_timeout(5000)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("while opening replica: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("while opening replica %s: %w", path, err)
+	}
+
+	var tables int
+	err = db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('tasks', 'operations', 'working_set')`).Scan(&tables)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("while checking replica schema: %w", err)
+	}
+	if tables != 3 {
+		db.Close()
+		return nil, fmt.Errorf("%s is not a taskchampion replica", path)
+	}
+
+	return &Replica{db: db}, nil
+}
+
+func (r *Replica) Close() error {
+	return r.db.Close()
+}
+
+// All returns every task in the replica
+func (r *Replica) All() ([]taskwarrior.Task, error) {
+	rows, err := r.db.Query(`SELECT uuid, data FROM tasks`)
+	if err != nil {
+		return nil, fmt.Errorf("while reading tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []taskwarrior.Task{}
+	for rows.Next() {
+		var uuid, data string
+		if err := rows.Scan(&uuid, &data); err != nil {
+			return nil, err
+		}
+		t, err := r.decode(uuid, data)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Get returns a single task, or an error if it doesn't exist
+func (r *Replica) Get(uuid string) (taskwarrior.Task, error) {
+	var data string
+	err := r.db.QueryRow(`SELECT data FROM tasks WHERE uuid = ?`, uuid).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return taskwarrior.Task{}, fmt.Errorf("task %s not found in replica", uuid)
+	}
+	if err != nil {
+		return taskwarrior.Task{}, fmt.Errorf("while reading task: %w", err)
+	}
+	return r.decode(uuid, data)
+}
+
+func (r *Replica) decode(uuid string, data string) (taskwarrior.Task, error) {
+	taskMap := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &taskMap); err != nil {
+		return taskwarrior.Task{}, fmt.Errorf("while parsing task %s: %w", uuid, err)
+	}
+	return r.toTask(uuid, taskMap)
+}
+
+// Import writes complete tasks, the same way task import does. All
+// changes are recorded as operations after a single undo point.
+func (r *Replica) Import(tasks ...taskwarrior.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("while starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := addOperation(tx, undoPoint()); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, t := range tasks {
+		newMap, err := r.fromTask(t)
+		if err != nil {
+			return err
+		}
+
+		oldMap, exists, err := readTaskMap(tx, t.UUID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := addOperation(tx, createOperation(t.UUID)); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range changedKeys(oldMap, newMap) {
+			op := updateOperation(t.UUID, key, oldMap, newMap, now)
+			if err := addOperation(tx, op); err != nil {
+				return err
+			}
+		}
+
+		if err := writeTaskMap(tx, t.UUID, newMap); err != nil {
+			return err
+		}
+		if err := updateWorkingSet(tx, t.UUID, newMap["status"]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("while saving changes to replica: %w", err)
+	}
+	return nil
+}
+
+// Delete marks a task as deleted, like task delete
+func (r *Replica) Delete(uuid string) error {
+	t, err := r.Get(uuid)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	t.Status = "deleted"
+	t.End = &now
+	t.Modified = now
+	return r.Import(t)
+}
+
+func readTaskMap(tx *sql.Tx, uuid string) (map[string]string, bool, error) {
+	var data string
+	err := tx.QueryRow(`SELECT data FROM tasks WHERE uuid = ?`, uuid).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return map[string]string{}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("while reading task %s: %w", uuid, err)
+	}
+	taskMap := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &taskMap); err != nil {
+		return nil, false, fmt.Errorf("while parsing task %s: %w", uuid, err)
+	}
+	return taskMap, true, nil
+}
+
+func writeTaskMap(tx *sql.Tx, uuid string, taskMap map[string]string) error {
+	data, err := json.Marshal(taskMap)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO tasks (uuid, data) VALUES (?, ?)`, uuid, string(data))
+	if err != nil {
+		return fmt.Errorf("while writing task %s: %w", uuid, err)
+	}
+	return nil
+}
+
+// updateWorkingSet gives pending tasks an id, like taskwarrior does when
+// a task is added. Ids of other tasks are cleared by taskwarrior's own
+// garbage collection.
+func updateWorkingSet(tx *sql.Tx, uuid string, status string) error {
+	if status != "pending" && status != "recurring" {
+		return nil
+	}
+	var count int
+	if err := tx.QueryRow(`SELECT count(*) FROM working_set WHERE uuid = ?`, uuid).Scan(&count); err != nil {
+		return fmt.Errorf("while reading working set: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := tx.Exec(`INSERT INTO working_set (id, uuid) VALUES ((SELECT coalesce(max(id), 0) + 1 FROM working_set), ?)`, uuid)
+	if err != nil {
+		return fmt.Errorf("while updating working set: %w", err)
+	}
+	return nil
+}
+
+func changedKeys(oldMap, newMap map[string]string) []string {
+	keys := map[string]bool{}
+	for key, value := range newMap {
+		if old, exists := oldMap[key]; !exists || old != value {
+			keys[key] = true
+		}
+	}
+	for key := range oldMap {
+		if _, exists := newMap[key]; !exists {
+			keys[key] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(keys))
+}
+
+func addOperation(tx *sql.Tx, op any) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO operations (data) VALUES (?)`, string(data)); err != nil {
+		return fmt.Errorf("while recording operation: %w", err)
+	}
+	return nil
+}
+
+func undoPoint() any {
+	return "UndoPoint"
+}
+
+func createOperation(uuid string) any {
+	return map[string]any{"Create": map[string]string{"uuid": uuid}}
+}
+
+func updateOperation(uuid string, key string, oldMap, newMap map[string]string, at time.Time) any {
+	update := map[string]any{
+		"uuid":      uuid,
+		"property":  key,
+		"old_value": nil,
+		"value":     nil,
+		"timestamp": at.Format(time.RFC3339Nano),
+	}
+	if old, exists := oldMap[key]; exists {
+		update["old_value"] = old
+	}
+	if value, exists := newMap[key]; exists {
+		update["value"] = value
+	}
+	return map[string]any{"Update": update}
+}
@@ -0,0 +1,427 @@
+package taskchampion
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/karsai5/tw-caldav/pkg/taskwarrior"
+)
+
+// schema is the replica schema created by Taskwarrior 3.x
+var schema = []string{
+	`CREATE TABLE operations (id INTEGER PRIMARY KEY AUTOINCREMENT, data STRING)`,
+	`CREATE TABLE sync_meta (key STRING PRIMARY KEY, value STRING)`,
+	`CREATE TABLE tasks (uuid STRING PRIMARY KEY, data STRING)`,
+	`CREATE TABLE working_set (id INTEGER PRIMARY KEY, uuid STRING)`,
+	`ALTER TABLE operations ADD COLUMN uuid GENERATED ALWAYS AS (coalesce(json_extract(data, "$.Update.uuid"), json_extract(data, "$.Create.uuid"), json_extract(data, "$.Delete.uuid"))) VIRTUAL`,
+	`ALTER TABLE operations ADD COLUMN synced bool DEFAULT false`,
+	`CREATE INDEX operations_by_uuid ON operations (uuid)`,
+	`CREATE INDEX operations_by_synced ON operations (synced)`,
+}
+
+const (
+	plantsUUID = "6d1f0f4e-7b1a-4c84-9a3e-1d2c3b4a5f60"
+	taxUUID    = "a2b0c7a4-0c3d-4b8e-8f7a-6e5d4c3b2a10"
+)
+
+// plants is a task the way task 3.x stores it after
+//
+//	task add Water the plants project:home +garden due:2025-06-14 estimate:3
+//	task 1 annotate Use the rain water
+//	task 1 modify depends:2
+var plants = map[string]string{
+	"description":           "Water the plants",
+	"project":               "home",
+	"status":                "pending",
+	"entry":                 "1749772800",
+	"modified":              "1749776400",
+	"due":                   "1749859200",
+	"estimate":              "3",
+	"tag_garden":            "x",
+	"dep_" + taxUUID:        "x",
+	"annotation_1749776400": "Use the rain water",
+}
+
+var tax = map[string]string{
+	"description": "Do the tax return",
+	"status":      "completed",
+	"entry":       "1749772800",
+	"modified":    "1749772900",
+	"end":         "1749772900",
+}
+
+// newReplica creates a replica holding plants and tax
+func newReplica(t *testing.T) (*Replica, *sql.DB) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "taskchampion.sqlite3")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for uuid, taskMap := range map[string]map[string]string{plantsUUID: plants, taxUUID: tax} {
+		data, _ := json.Marshal(taskMap)
+		if _, err := db.Exec(`INSERT INTO tasks (uuid, data) VALUES (?, ?)`, uuid, string(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO working_set (id, uuid) VALUES (1, ?)`, plantsUUID); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, db
+}
+
+func storedTask(t *testing.T, db *sql.DB, uuid string) map[string]string {
+	t.Helper()
+	var data string
+	if err := db.QueryRow(`SELECT data FROM tasks WHERE uuid = ?`, uuid).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+	taskMap := map[string]string{}
+	if err := json.Unmarshal([]byte(data), &taskMap); err != nil {
+		t.Fatal(err)
+	}
+	return taskMap
+}
+
+// operations returns the operations recorded, updates are written as
+// property=old->new
+func operations(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT data, synced FROM operations ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	ops := []string{}
+	for rows.Next() {
+		var data string
+		var synced bool
+		if err := rows.Scan(&data, &synced); err != nil {
+			t.Fatal(err)
+		}
+		if synced {
+			t.Errorf("operation %s is marked as synced", data)
+		}
+		var op struct {
+			Create *struct{ UUID string }
+			Update *struct {
+				UUID      string
+				Property  string
+				OldValue  *string `json:"old_value"`
+				Value     *string
+				Timestamp string
+			}
+		}
+		if data == `"UndoPoint"` {
+			ops = append(ops, "UndoPoint")
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), &op); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case op.Create != nil:
+			ops = append(ops, "Create")
+		case op.Update != nil:
+			if _, err := time.Parse(time.RFC3339Nano, op.Update.Timestamp); err != nil {
+				t.Errorf("timestamp of %s: %v", data, err)
+			}
+			str := func(s *string) string {
+				if s == nil {
+					return "null"
+				}
+				return *s
+			}
+			ops = append(ops, op.Update.Property+"="+str(op.Update.OldValue)+"->"+str(op.Update.Value))
+		default:
+			t.Errorf("unexpected operation %s", data)
+		}
+	}
+	return ops
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "other.sqlite3")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE tasks (uuid STRING PRIMARY KEY, data STRING)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("opened a database that isn't a replica")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.sqlite3")); err == nil {
+		t.Error("opened a replica that doesn't exist")
+	}
+}
+
+func TestGet(t *testing.T) {
+	r, _ := newReplica(t)
+	r.DateUDAs = []string{}
+
+	got, err := r.Get(plantsUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Description != "Water the plants" || got.Project != "home" || got.Status != "pending" {
+		t.Errorf("got %+v", got)
+	}
+	if got.Due == nil || !got.Due.Equal(time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("due = %v", got.Due)
+	}
+	if !got.Modified.Equal(time.Date(2025, 6, 13, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("modified = %v", got.Modified)
+	}
+	if !slices.Equal(got.Tags, []string{"garden"}) {
+		t.Errorf("tags = %v", got.Tags)
+	}
+	if estimate, _ := got.UDA("estimate"); estimate != "3" {
+		t.Errorf("estimate = %q", estimate)
+	}
+	if depends := string(got.Extra["depends"]); depends != `["`+taxUUID+`"]` {
+		t.Errorf("depends = %s", depends)
+	}
+	if annotations := string(got.Extra["annotations"]); annotations != `[{"entry":"20250613T010000Z","description":"Use the rain water"}]` {
+		t.Errorf("annotations = %s", annotations)
+	}
+
+	if _, err := r.Get("0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"); err == nil {
+		t.Error("got a task that doesn't exist")
+	}
+
+	all, err := r.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Errorf("All() returned %d tasks, want 2", len(all))
+	}
+}
+
+func TestImport(t *testing.T) {
+	modified := time.Date(2025, 6, 14, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		task       func(t *testing.T, r *Replica) taskwarrior.Task
+		uuid       string
+		want       map[string]string
+		wantOps    []string
+		workingSet []string
+	}{
+		{
+			name: "unchanged task isn't rewritten",
+			task: func(t *testing.T, r *Replica) taskwarrior.Task {
+				got, err := r.Get(plantsUUID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return got
+			},
+			uuid:       plantsUUID,
+			want:       plants,
+			wantOps:    []string{"UndoPoint"},
+			workingSet: []string{plantsUUID},
+		},
+		{
+			name: "export format round trips",
+			task: func(t *testing.T, r *Replica) taskwarrior.Task {
+				got, err := r.Get(plantsUUID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := json.Marshal(got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				exported := taskwarrior.Task{}
+				if err := json.Unmarshal(data, &exported); err != nil {
+					t.Fatal(err)
+				}
+				return exported
+			},
+			uuid:       plantsUUID,
+			want:       plants,
+			wantOps:    []string{"UndoPoint"},
+			workingSet: []string{plantsUUID},
+		},
+		{
+			name: "changed properties are recorded",
+			task: func(t *testing.T, r *Replica) taskwarrior.Task {
+				got, err := r.Get(plantsUUID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got.Description = "Water the garden"
+				got.Tags = nil
+				got.RemotePath = "/cal/home/a.ics"
+				got.Modified = modified
+				return got
+			},
+			uuid: plantsUUID,
+			want: func() map[string]string {
+				want := map[string]string{}
+				for key, value := range plants {
+					want[key] = value
+				}
+				delete(want, "tag_garden")
+				want["description"] = "Water the garden"
+				want["remotepath"] = "/cal/home/a.ics"
+				want["modified"] = "1749888000"
+				return want
+			}(),
+			wantOps: []string{
+				"UndoPoint",
+				"description=Water the plants->Water the garden",
+				"modified=1749776400->1749888000",
+				"remotepath=null->/cal/home/a.ics",
+				"tag_garden=x->null",
+			},
+			workingSet: []string{plantsUUID},
+		},
+		{
+			name: "new task is created",
+			task: func(t *testing.T, r *Replica) taskwarrior.Task {
+				entry := time.Date(2025, 6, 14, 8, 0, 0, 0, time.UTC)
+				return taskwarrior.Task{
+					UUID:        "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10",
+					Description: "Buy milk",
+					Status:      "pending",
+					Entry:       &entry,
+					Modified:    modified,
+					Tags:        []string{"shop"},
+				}
+			},
+			uuid: "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10",
+			want: map[string]string{
+				"description": "Buy milk",
+				"status":      "pending",
+				"entry":       "1749888000",
+				"modified":    "1749888000",
+				"tag_shop":    "x",
+			},
+			wantOps: []string{
+				"UndoPoint",
+				"Create",
+				"description=null->Buy milk",
+				"entry=null->1749888000",
+				"modified=null->1749888000",
+				"status=null->pending",
+				"tag_shop=null->x",
+			},
+			workingSet: []string{plantsUUID, "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10"},
+		},
+		{
+			name: "completed task isn't added to the working set",
+			task: func(t *testing.T, r *Replica) taskwarrior.Task {
+				return taskwarrior.Task{
+					UUID:        "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10",
+					Description: "Bought milk",
+					Status:      "completed",
+					Modified:    modified,
+				}
+			},
+			uuid: "0b4d4c1e-5d2a-4c7e-9a53-2f1f5b2a7c10",
+			want: map[string]string{
+				"description": "Bought milk",
+				"status":      "completed",
+				"modified":    "1749888000",
+			},
+			wantOps: []string{
+				"UndoPoint",
+				"Create",
+				"description=null->Bought milk",
+				"modified=null->1749888000",
+				"status=null->completed",
+			},
+			workingSet: []string{plantsUUID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, db := newReplica(t)
+			r.DateUDAs = []string{}
+
+			if err := r.Import(tt.task(t, r)); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := storedTask(t, db, tt.uuid); !mapsEqual(got, tt.want) {
+				t.Errorf("stored %v, want %v", got, tt.want)
+			}
+			if got := operations(t, db); !slices.Equal(got, tt.wantOps) {
+				t.Errorf("operations %v, want %v", got, tt.wantOps)
+			}
+			if got := workingSet(t, db); !slices.Equal(got, tt.workingSet) {
+				t.Errorf("working set %v, want %v", got, tt.workingSet)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	r, db := newReplica(t)
+	if err := r.Delete(plantsUUID); err != nil {
+		t.Fatal(err)
+	}
+
+	got := storedTask(t, db, plantsUUID)
+	if got["status"] != "deleted" || got["end"] == "" {
+		t.Errorf("stored %v", got)
+	}
+	ops := operations(t, db)
+	if !slices.Contains(ops, "status=pending->deleted") || slices.Contains(ops, "Create") {
+		t.Errorf("operations %v", ops)
+	}
+}
+
+func workingSet(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT uuid FROM working_set ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	uuids := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			t.Fatal(err)
+		}
+		uuids = append(uuids, uuid)
+	}
+	return uuids
+}
+
+func mapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, exists := b[key]; !exists || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -1,11 +1,13 @@
 package taskwarrior
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
 	"os/exec"
+	"reflect"
 	"strings"
 	"time"
 )
@@ -16,7 +18,8 @@ type Task struct {
 	Id          int        `json:"id"`
 	Description string     `json:"description"`
 	Due         *time.Time `json:"due"`
-	Entry       string     `json:"entry"`
+	Entry       *time.Time `json:"entry"`
+	End         *time.Time `json:"end"`
 	Modified    time.Time  `json:"modified"`
 	Project     string     `json:"project"`
 	Status      string     `json:"status"`
@@ -28,6 +31,11 @@ type Task struct {
 	Priority    string     `json:"priority"`
 	RemotePath  string     `json:"remotepath"`
 	LastSync    *time.Time `json:"lastsync"`
+	Progress    *float64   `json:"progress"`
+
+	// Extra holds every field of the exported task that isn't mapped to
+	// one of the fields above, such as UDAs, annotations or recurrence.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 func (t *Task) UnmarshalJSON(data []byte) error {
@@ -35,6 +43,8 @@ func (t *Task) UnmarshalJSON(data []byte) error {
 	aux := &struct {
 		Modified string `json:"modified"`
 		Due      string `json:"due"`
+		Entry    string `json:"entry"`
+		End      string `json:"end"`
 		LastSync string `json:"lastsync"`
 		*Alias
 	}{
@@ -59,6 +69,21 @@ func (t *Task) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	err = t.setExtra(data)
+	if err != nil {
+		return err
+	}
+
+	t.Entry, err = parseOptionalTime(aux.Entry)
+	if err != nil {
+		return err
+	}
+
+	t.End, err = parseOptionalTime(aux.End)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -86,6 +111,131 @@ func (t *Task) setLastSync(str string) error {
 	return nil
 }
 
+// MarshalJSON writes the task in the format used by task export and
+// task import. Fields in Extra are written as they were read.
+func (t Task) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{}
+	for name, value := range t.Extra {
+		fields[name] = value
+	}
+
+	setString := func(name string, value string) {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	setTime := func(name string, value *time.Time) {
+		if value != nil && !value.IsZero() {
+			fields[name] = value.UTC().Format(TimeLayout)
+		}
+	}
+
+	setString("uuid", t.UUID)
+	setString("description", t.Description)
+	setString("project", t.Project)
+	setString("status", t.Status)
+	setString("wait", t.Wait)
+	setString("caldavid", t.CalDavId)
+	setString("priority", t.Priority)
+	setString("remotepath", t.RemotePath)
+	setTime("due", t.Due)
+	setTime("entry", t.Entry)
+	setTime("end", t.End)
+	setTime("modified", &t.Modified)
+	setTime("lastsync", t.LastSync)
+	if len(t.Tags) > 0 {
+		fields["tags"] = t.Tags
+	}
+	if t.Progress != nil {
+		fields["progress"] = *t.Progress
+	}
+
+	return json.Marshal(fields)
+}
+
+// SetUDA sets the value of a field that isn't known to Task. A nil value
+// removes the field.
+func (t *Task) SetUDA(name string, value any) error {
+	if value == nil {
+		delete(t.Extra, name)
+		return nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("while setting uda %q: %w", name, err)
+	}
+	if t.Extra == nil {
+		t.Extra = map[string]json.RawMessage{}
+	}
+	t.Extra[name] = raw
+	return nil
+}
+
+func (t *Task) setExtra(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, name := range knownFields() {
+		delete(fields, name)
+	}
+	if len(fields) == 0 {
+		t.Extra = nil
+		return nil
+	}
+	t.Extra = fields
+	return nil
+}
+
+// knownFields returns the json names of the fields decoded into Task
+func knownFields() []string {
+	fields := []string{}
+	taskType := reflect.TypeOf(Task{})
+	for i := range taskType.NumField() {
+		name, _, _ := strings.Cut(taskType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// UDA returns the value of a field that isn't known to Task, such as a
+// user defined attribute, as a string. Numbers are returned as they
+// appear in the export.
+func (t *Task) UDA(name string) (string, bool) {
+	raw, exists := t.Extra[name]
+	if !exists {
+		return "", false
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, true
+	}
+	return string(raw), true
+}
+
+// UDAType returns the type of a user defined attribute as configured in
+// taskwarrior, or an empty string if no such UDA is defined.
+func UDAType(name string) (string, error) {
+	out, err := Run("_get", fmt.Sprintf("rc.uda.%s.type", name))
+	if err != nil {
+		return "", fmt.Errorf("while getting type of uda %q: %w", name, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func parseOptionalTime(str string) (*time.Time, error) {
+	if str == "" {
+		return nil, nil
+	}
+	parsedTime, err := time.Parse(TimeLayout, str)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedTime, nil
+}
+
 func (t *Task) setModified(str string) error {
 	parsedTime, err := time.Parse(TimeLayout, str)
 	if err != nil {
@@ -121,6 +271,27 @@ func Run(cmds ...string) (string, error) {
 	return string(out), nil
 }
 
+// Import writes complete tasks with task import. Tasks with the uuid of
+// an existing task replace it.
+func Import(tasks ...Task) (string, error) {
+	if len(tasks) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(tasks)
+	if err != nil {
+		return "", fmt.Errorf("while converting tasks to json: %w", err)
+	}
+
+	slog.Debug("Importing tasks into taskwarrior", "num", len(tasks))
+	cmd := exec.Command("task", "rc.confirmation=off", "rc.recurrence.confirmation=off", "import")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("while importing tasks: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return string(out), nil
+}
+
 func List(filter string) (tasks []Task, err error) {
 	cmdArgs := []string{}
 	if filter != "" {